@@ -0,0 +1,139 @@
+package aead
+
+import (
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	kdf "github.com/Varunram/essentials/kdf"
+	"github.com/Varunram/essentials/logger"
+)
+
+// Cipher seals and opens messages with a key derived from a passphrase. The additional data
+// passed to Seal isn't stored in the ciphertext, the same additional data must be passed to
+// Open. This can be used to bind a ciphertext to eg. a record ID or an account pubkey
+type Cipher interface {
+	// Name returns the name the cipher is registered under
+	Name() string
+	// Seal encrypts and authenticates the plaintext and authenticates the additional data
+	Seal(plaintext, aad []byte) ([]byte, error)
+	// Open decrypts the ciphertext if the ciphertext and the additional data are authentic
+	Open(ciphertext, aad []byte) ([]byte, error)
+}
+
+// Upgrader is implemented by ciphers that can still open ciphertexts written in older formats
+type Upgrader interface {
+	// OpenOutdated is Open, also returning whether the ciphertext was in an older format
+	OpenOutdated(ciphertext, aad []byte) ([]byte, bool, error)
+}
+
+// Constructor returns a Cipher using the passphrase and the KDF params
+type Constructor func(passphrase string, params kdf.Params) Cipher
+
+// ErrUnknownCipher is returned when no cipher is registered under the requested name
+var ErrUnknownCipher = errors.New("unknown cipher, did you import its package?")
+
+var (
+	ciphersMu sync.RWMutex
+	ciphers   = make(map[string]Constructor)
+)
+
+// Register makes a cipher available by name. It is called from the init function of the
+// packages implementing Cipher, so those need to be imported for New to find them
+func Register(name string, constructor Constructor) {
+	ciphersMu.Lock()
+	defer ciphersMu.Unlock()
+	if constructor == nil {
+		panic("aead: Register constructor is nil")
+	}
+	if _, dup := ciphers[name]; dup {
+		panic("aead: Register called twice for cipher " + name)
+	}
+	ciphers[name] = constructor
+}
+
+// New returns the cipher registered under name using the default KDF params
+func New(name string, passphrase string) (Cipher, error) {
+	return NewWithParams(name, passphrase, kdf.Default)
+}
+
+// NewWithParams returns the cipher registered under name using the passed KDF params
+func NewWithParams(name string, passphrase string, params kdf.Params) (Cipher, error) {
+	ciphersMu.RLock()
+	constructor, ok := ciphers[name]
+	ciphersMu.RUnlock()
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownCipher, name)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid kdf params")
+	}
+	return constructor(passphrase, params), nil
+}
+
+// Names returns the sorted names of the registered ciphers
+func Names() []string {
+	ciphersMu.RLock()
+	defer ciphersMu.RUnlock()
+	var names []string
+	for name := range ciphers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AdditionalData returns the data that is authenticated alongside a ciphertext, which is its
+// header followed by the caller's additional data. A new slice is returned so that neither of
+// the passed slices is modified
+func AdditionalData(header []byte, aad []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(aad))
+	ad = append(ad, header...)
+	return append(ad, aad...)
+}
+
+// SealFile seals the plaintext with the passed cipher and atomically writes it to filename,
+// keeping the previous version of the file if backup is set
+func SealFile(c Cipher, filename string, plaintext []byte, aad []byte, backup bool) error {
+	data, err := c.Seal(plaintext, aad)
+	if err != nil {
+		logger.Error("error while encrypting file", logger.Err(err))
+		return errors.Wrap(err, "Error while encrypting file")
+	}
+	return WriteFile(filename, data, backup)
+}
+
+// OpenFile reads filename and opens it with the passed cipher. If the cipher is an Upgrader
+// and the file was written in an older format, the file is sealed again in the current format
+// without keeping a backup
+func OpenFile(c Cipher, filename string, aad []byte) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		logger.Error("could not read from file", logger.Err(err))
+		return nil, err
+	}
+
+	upgrader, ok := c.(Upgrader)
+	if !ok {
+		plaintext, err := c.Open(data, aad)
+		if err != nil {
+			logger.Error("could not decrypt data", logger.Err(err))
+		}
+		return plaintext, err
+	}
+
+	plaintext, outdated, err := upgrader.OpenOutdated(data, aad)
+	if err != nil {
+		logger.Error("could not decrypt data", logger.Err(err))
+		return plaintext, err
+	}
+	if outdated {
+		// the data is already decrypted so failing to upgrade the file isn't fatal
+		if err := SealFile(c, filename, plaintext, aad, false); err != nil {
+			logger.Error("could not re-encrypt outdated file", logger.Err(err))
+		}
+	}
+	return plaintext, nil
+}
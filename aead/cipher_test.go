@@ -0,0 +1,96 @@
+// +build all travis
+
+package aead
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	kdf "github.com/Varunram/essentials/kdf"
+)
+
+// xorCipher is a toy cipher used to test the registry and the file helpers. Ciphertexts
+// starting with 0 are treated as outdated
+type xorCipher struct {
+	key byte
+}
+
+func (c xorCipher) Name() string { return "xor" }
+
+func (c xorCipher) Seal(plaintext, aad []byte) ([]byte, error) {
+	out := []byte{1}
+	for _, b := range plaintext {
+		out = append(out, b^c.key)
+	}
+	return out, nil
+}
+
+func (c xorCipher) Open(ciphertext, aad []byte) ([]byte, error) {
+	plaintext, _, err := c.OpenOutdated(ciphertext, aad)
+	return plaintext, err
+}
+
+func (c xorCipher) OpenOutdated(ciphertext, aad []byte) ([]byte, bool, error) {
+	var out []byte
+	for _, b := range ciphertext[1:] {
+		out = append(out, b^c.key)
+	}
+	return out, ciphertext[0] == 0, nil
+}
+
+func init() {
+	Register("xor", func(passphrase string, params kdf.Params) Cipher {
+		return xorCipher{key: byte(len(passphrase))}
+	})
+}
+
+func TestCipher(t *testing.T) {
+	c, err := New("xor", "cool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, name := range Names() {
+		if name == "xor" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("registered cipher not listed")
+	}
+	if _, err := New("blah", "cool"); err == nil {
+		t.Fatalf("unknown cipher not detected")
+	}
+	if _, err := NewWithParams("xor", "cool", kdf.Params{}); err == nil {
+		t.Fatalf("invalid kdf params not detected")
+	}
+
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+	err = SealFile(c, "test_files/test.key", []byte("Hello World"), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := OpenFile(c, "test_files/test.key", nil)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("file doesn't round trip")
+	}
+
+	// outdated files are sealed again when opened
+	outdated, _ := c.Seal([]byte("Hello World"), nil)
+	outdated[0] = 0
+	err = ioutil.WriteFile("test_files/outdated.key", outdated, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = OpenFile(c, "test_files/outdated.key", nil)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("outdated file not opened")
+	}
+	upgraded, _ := ioutil.ReadFile("test_files/outdated.key")
+	if bytes.Equal(upgraded, outdated) {
+		t.Fatalf("outdated file not sealed again")
+	}
+}
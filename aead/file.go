@@ -0,0 +1,119 @@
+package aead
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// BackupSuffix is appended to the name of a file to get the name of its backup
+const BackupSuffix = ".bak"
+
+// WriteFile atomically replaces filename with data. The data is written to a temporary file
+// with 0600 permissions in the same directory, synced to disk and renamed over filename, so
+// a crash leaves either the old or the new version in place. If backup is set, the previous
+// version of the file is kept as filename + BackupSuffix
+func WriteFile(filename string, data []byte, backup bool) error {
+	return WriteFileFunc(filename, backup, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteFileFunc is WriteFile with the contents written by write, so that they don't have to
+// be held in memory. filename is left untouched if write fails
+func WriteFileFunc(filename string, backup bool, write func(w io.Writer) error) error {
+	return writeFile(filename, backup, write, nil)
+}
+
+// writeFile is WriteFileFunc that calls verify, if set, with the name of the synced temporary
+// file before it replaces filename
+func writeFile(filename string, backup bool, write func(w io.Writer) error, verify func(name string) error) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	// ioutil.TempFile creates the file with 0600 permissions
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		logger.Error("error while creating file", logger.Err(err))
+		return errors.Wrap(err, "Error while creating file")
+	}
+
+	tmpName := tmp.Name()
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		logger.Error("error while writing file", logger.Err(err))
+		return errors.Wrap(err, "Error while writing file")
+	}
+
+	if verify != nil {
+		if err := verify(tmpName); err != nil {
+			os.Remove(tmpName)
+			return err
+		}
+	}
+
+	if backup {
+		if err := backupFile(filename); err != nil {
+			os.Remove(tmpName)
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		logger.Error("error while replacing file", logger.Err(err))
+		return errors.Wrap(err, "Error while replacing file")
+	}
+
+	SyncDir(dir)
+	return nil
+}
+
+// backupFile copies filename to filename + BackupSuffix if it exists. The copy is written
+// atomically as well so a crash doesn't leave a partial backup behind
+func backupFile(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		logger.Error("could not read file for backup", logger.Err(err))
+		return errors.Wrap(err, "could not read file for backup")
+	}
+	defer f.Close()
+	return WriteFileFunc(filename+BackupSuffix, false, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
+
+// SyncDir syncs a directory so that a rename in it is durable. Not all platforms support
+// syncing directories, so errors are only logged
+func SyncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		logger.Error("could not open directory for syncing", logger.Err(err))
+		return
+	}
+	if err := d.Sync(); err != nil {
+		logger.Error("could not sync directory", logger.Err(err))
+	}
+	if err := d.Close(); err != nil {
+		logger.Error("could not close directory", logger.Err(err))
+	}
+}
@@ -0,0 +1,85 @@
+// +build all travis
+
+package aead
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	err := WriteFile("test_files/seed.key", []byte("first"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat("test_files/seed.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Fatalf("file written with permissions %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat("test_files/seed.key" + BackupSuffix); !os.IsNotExist(err) {
+		t.Fatalf("backup created for a file that didn't exist")
+	}
+
+	err = WriteFile("test_files/seed.key", []byte("second"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile("test_files/seed.key")
+	if string(data) != "second" {
+		t.Fatalf("file not replaced")
+	}
+	data, _ = ioutil.ReadFile("test_files/seed.key" + BackupSuffix)
+	if string(data) != "first" {
+		t.Fatalf("previous version not backed up")
+	}
+
+	err = WriteFile("test_files/seed.key", []byte("third"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile("test_files/seed.key" + BackupSuffix)
+	if string(data) != "first" {
+		t.Fatalf("backup overwritten when backups are disabled")
+	}
+
+	err = WriteFile("blah/blah.key", []byte("first"), false)
+	if err == nil {
+		t.Fatalf("not erroring out on file creation error, quitting!")
+	}
+
+	// a file failing verification doesn't replace the original
+	errVerify := errors.New("verify")
+	err = writeFile("test_files/seed.key", false, func(w io.Writer) error {
+		_, err := w.Write([]byte("fourth"))
+		return err
+	}, func(name string) error {
+		data, _ := ioutil.ReadFile(name)
+		if string(data) != "fourth" {
+			t.Fatalf("verifying unexpected data: %s", data)
+		}
+		return errVerify
+	})
+	if err != errVerify {
+		t.Fatalf("expected the verify error, got %v", err)
+	}
+	data, _ = ioutil.ReadFile("test_files/seed.key")
+	if string(data) != "third" {
+		t.Fatalf("file replaced despite failing verification")
+	}
+
+	// no temporary files must be left behind
+	files, _ := ioutil.ReadDir("test_files")
+	if len(files) != 2 {
+		t.Fatalf("temporary files left behind")
+	}
+}
@@ -0,0 +1,89 @@
+package aead
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// KeyExt is the extension of the encrypted key files written by the wallet and issuer packages
+const KeyExt = ".key"
+
+// ErrVerifyFailed is returned when a re-encrypted file doesn't open to the original plaintext
+var ErrVerifyFailed = errors.New("re-encrypted data doesn't match the original")
+
+// Rotate opens the ciphertext with from, seals the plaintext with to and checks that the new
+// ciphertext opens to the same plaintext. This can be used to change the passphrase, the KDF
+// params or the cipher of a ciphertext
+func Rotate(ciphertext []byte, from, to Cipher, aad []byte) ([]byte, error) {
+	plaintext, err := from.Open(ciphertext, aad)
+	if err != nil {
+		logger.Error("could not decrypt data with the old cipher", logger.Err(err))
+		return nil, errors.Wrap(err, "could not decrypt data with the old cipher")
+	}
+
+	sealed, err := to.Seal(plaintext, aad)
+	if err != nil {
+		logger.Error("could not encrypt data with the new cipher", logger.Err(err))
+		return nil, errors.Wrap(err, "could not encrypt data with the new cipher")
+	}
+
+	check, err := to.Open(sealed, aad)
+	if err != nil {
+		logger.Error("could not verify re-encrypted data", logger.Err(err))
+		return nil, errors.Wrap(ErrVerifyFailed, err.Error())
+	}
+	if !bytes.Equal(check, plaintext) {
+		return nil, ErrVerifyFailed
+	}
+
+	return sealed, nil
+}
+
+// RotateFile re-encrypts filename from one cipher to another. The original is only replaced
+// once the new ciphertext has been verified, and is kept as a backup if backup is set
+func RotateFile(filename string, from, to Cipher, aad []byte, backup bool) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		logger.Error("could not read from file", logger.Err(err))
+		return errors.Wrap(err, "could not read from file")
+	}
+
+	sealed, err := Rotate(data, from, to, aad)
+	if err != nil {
+		return errors.Wrap(err, "could not rotate "+filename)
+	}
+
+	return WriteFile(filename, sealed, backup)
+}
+
+// RotateDir re-encrypts every file in dir with the given extension (eg. KeyExt) from one cipher
+// to another, keeping backups if backup is set. It stops at the first file that can't be
+// rotated and returns the files that were rotated before it, the files that were rotated stay
+// rotated
+func RotateDir(dir string, ext string, from, to Cipher, backup bool) ([]string, error) {
+	var rotated []string
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logger.Error("could not read directory", logger.Err(err))
+		return rotated, errors.Wrap(err, "could not read directory")
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ext) {
+			continue
+		}
+		filename := filepath.Join(dir, file.Name())
+		if err := RotateFile(filename, from, to, nil, backup); err != nil {
+			return rotated, err
+		}
+		rotated = append(rotated, filename)
+	}
+
+	return rotated, nil
+}
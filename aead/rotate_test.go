@@ -0,0 +1,57 @@
+// +build all travis
+
+package aead
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRotate(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	from := xorCipher{key: 1}
+	to := xorCipher{key: 2}
+	for _, name := range []string{"1.key", "2.key"} {
+		err := SealFile(from, "test_files/"+name, []byte("Hello World"), nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := SealFile(from, "test_files/other.txt", []byte("Hello World"), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := RotateDir("test_files", KeyExt, from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files, got %d", len(rotated))
+	}
+	for _, filename := range rotated {
+		plaintext, err := OpenFile(to, filename, nil)
+		if err != nil || string(plaintext) != "Hello World" {
+			t.Fatalf("rotated file doesn't open with the new cipher")
+		}
+		plaintext, err = OpenFile(from, filename+BackupSuffix, nil)
+		if err != nil || string(plaintext) != "Hello World" {
+			t.Fatalf("backup of rotated file doesn't open with the old cipher")
+		}
+	}
+	plaintext, err := OpenFile(from, "test_files/other.txt", nil)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("file with another extension was rotated")
+	}
+
+	err = RotateFile("test_files/blah.key", from, to, nil, false)
+	if err == nil {
+		t.Fatalf("not erroring out on missing file, quitting!")
+	}
+	_, err = RotateDir("blah", KeyExt, from, to, false)
+	if err == nil {
+		t.Fatalf("not erroring out on missing directory, quitting!")
+	}
+}
@@ -0,0 +1,434 @@
+package aead
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+
+	kdf "github.com/Varunram/essentials/kdf"
+	"github.com/Varunram/essentials/logger"
+)
+
+// package aead contains helpers that are shared by the aes and cc20 packages
+
+// The stream functions implement the STREAM construction (https://eprint.iacr.org/2015/189.pdf)
+// which splits a large plaintext into chunks that are sealed individually. The nonce of each
+// chunk is nonce prefix || counter (4 bytes, big endian) || last chunk flag (1 byte) so
+// chunks that are reordered, dropped or truncated from the end fail to authenticate.
+
+// ChunkSize is the default size of a plaintext chunk
+const ChunkSize = 64 * 1024
+
+// NonceOverhead is the number of nonce bytes used for the counter and the final chunk flag.
+// The nonce prefix passed to NewWriter and NewReader must be NonceSize() - NonceOverhead long
+const NonceOverhead = 5
+
+// ErrInvalidChunk is returned when a chunk fails to authenticate, which happens if the stream
+// was tampered with, reordered or truncated before its final chunk
+var ErrInvalidChunk = errors.New("chunk failed to authenticate")
+
+// ErrStreamTooLong is returned when a stream exceeds the number of chunks the counter allows
+var ErrStreamTooLong = errors.New("stream too long")
+
+// ErrStreamClosed is returned when writing to a closed stream
+var ErrStreamClosed = errors.New("stream already closed")
+
+// ErrUnknownVersion is returned when a stream header has an unexpected version byte
+var ErrUnknownVersion = errors.New("unknown stream version")
+
+// ErrNotStream is returned when data doesn't start with a stream header, eg. files written
+// in the single message format of a Cipher
+var ErrNotStream = errors.New("data is not an encrypted stream")
+
+// streamMagic starts every stream header. The single message envelopes of the aes and cc20
+// packages start with a version byte only, so the magic tells streams apart from them
+var streamMagic = []byte("AEST")
+
+// chunkNonce returns the nonce of a chunk
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, len(prefix)+NonceOverhead)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// checkParams checks whether the nonce prefix and the chunk size can be used with the aead
+func checkParams(a cipher.AEAD, prefix []byte, chunkSize int) error {
+	if len(prefix)+NonceOverhead != a.NonceSize() {
+		return errors.New("nonce prefix has the wrong length")
+	}
+	if chunkSize <= 0 {
+		return errors.New("chunk size must be positive")
+	}
+	return nil
+}
+
+// Writer seals everything written to it in chunks and writes them to the underlying writer.
+// Close must be called to write the final chunk, without it the stream is detected as truncated
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	aad     []byte
+	buf     []byte
+	size    int
+	counter uint32
+	closed  bool
+}
+
+// NewWriter returns a Writer that seals chunks of chunkSize bytes. The aad is bound to every chunk
+func NewWriter(w io.Writer, a cipher.AEAD, prefix []byte, chunkSize int, aad []byte) (*Writer, error) {
+	if err := checkParams(a, prefix, chunkSize); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:      w,
+		aead:   a,
+		prefix: append([]byte{}, prefix...),
+		aad:    append([]byte{}, aad...),
+		buf:    make([]byte, 0, chunkSize),
+		size:   chunkSize,
+	}, nil
+}
+
+// Write buffers p and seals every full chunk. A full chunk is only flushed once more data
+// arrives since we don't know whether it is the final one before that
+func (s *Writer) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, ErrStreamClosed
+	}
+
+	n := 0
+	for len(p) > 0 {
+		if len(s.buf) == s.size {
+			if err := s.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := s.size - len(s.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		s.buf = append(s.buf, p[:m]...)
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close seals and writes the final chunk. It doesn't close the underlying writer
+func (s *Writer) Close() error {
+	if s.closed {
+		return ErrStreamClosed
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+// flush seals the buffered chunk and writes it out
+func (s *Writer) flush(last bool) error {
+	if s.counter == math.MaxUint32 && !last {
+		return ErrStreamTooLong
+	}
+
+	sealed := s.aead.Seal(nil, chunkNonce(s.prefix, s.counter, last), s.buf, s.aad)
+	if _, err := s.w.Write(sealed); err != nil {
+		logger.Error("could not write sealed chunk", logger.Err(err))
+		return errors.Wrap(err, "could not write sealed chunk")
+	}
+
+	s.counter++
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Reader opens a stream written by Writer. Every chunk is authenticated before it is returned,
+// but callers must read until io.EOF to know that the stream wasn't truncated
+type Reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	aad     []byte
+	sealed  []byte
+	plain   []byte
+	counter uint32
+	done    bool
+}
+
+// NewReader returns a Reader that opens chunks sealed with the same parameters passed to NewWriter
+func NewReader(r io.Reader, a cipher.AEAD, prefix []byte, chunkSize int, aad []byte) (*Reader, error) {
+	if err := checkParams(a, prefix, chunkSize); err != nil {
+		return nil, err
+	}
+	return &Reader{
+		r:      bufio.NewReader(r),
+		aead:   a,
+		prefix: append([]byte{}, prefix...),
+		aad:    append([]byte{}, aad...),
+		sealed: make([]byte, chunkSize+a.Overhead()),
+	}, nil
+}
+
+// Read returns opened plaintext, reading and authenticating the next chunk when needed
+func (s *Reader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk. A chunk is the final one if nothing follows it
+func (s *Reader) next() error {
+	// a short read means this has to be the final chunk
+	n, err := io.ReadFull(s.r, s.sealed)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		logger.Error("could not read sealed chunk", logger.Err(err))
+		return errors.Wrap(err, "could not read sealed chunk")
+	}
+
+	last := n < len(s.sealed)
+	if !last {
+		if _, perr := s.r.Peek(1); perr == io.EOF {
+			last = true
+		} else if perr != nil {
+			logger.Error("could not read sealed chunk", logger.Err(perr))
+			return errors.Wrap(perr, "could not read sealed chunk")
+		}
+	}
+
+	if !last && s.counter == math.MaxUint32 {
+		return ErrStreamTooLong
+	}
+
+	plain, err := s.aead.Open(nil, chunkNonce(s.prefix, s.counter, last), s.sealed[:n], s.aad)
+	if err != nil {
+		logger.Error("could not open chunk", logger.Err(err))
+		return ErrInvalidChunk
+	}
+
+	s.counter++
+	s.plain = plain
+	s.done = last
+	return nil
+}
+
+// NewAEADFunc returns an AEAD instance for the given key
+type NewAEADFunc func(key []byte) (cipher.AEAD, error)
+
+// streamHeader returns magic || version || kdf header || nonce prefix
+func streamHeader(version byte, kdfHeader []byte, prefix []byte) []byte {
+	header := make([]byte, 0, len(streamMagic)+1+len(kdfHeader)+len(prefix))
+	header = append(header, streamMagic...)
+	header = append(header, version)
+	header = append(header, kdfHeader...)
+	header = append(header, prefix...)
+	return header
+}
+
+// NewEncryptWriter writes the stream header
+// magic (4 bytes) || version (1 byte) || kdf header || nonce prefix
+// to w and returns a Writer sealing chunks with a key derived from the passphrase. The header
+// is bound to every chunk
+func NewEncryptWriter(w io.Writer, version byte, newAEAD NewAEADFunc, passphrase string,
+	params kdf.Params) (*Writer, error) {
+	salt, err := kdf.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	kdfHeader, err := params.Header(salt)
+	if err != nil {
+		logger.Error("invalid kdf params", logger.Err(err))
+		return nil, errors.Wrap(err, "invalid kdf params")
+	}
+
+	key, err := kdf.Key(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, a.NonceSize()-NonceOverhead)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		logger.Error("could not generate random nonce", logger.Err(err))
+		return nil, errors.Wrap(err, "could not generate random nonce")
+	}
+
+	header := streamHeader(version, kdfHeader, prefix)
+	if _, err := w.Write(header); err != nil {
+		logger.Error("could not write stream header", logger.Err(err))
+		return nil, errors.Wrap(err, "could not write stream header")
+	}
+
+	return NewWriter(w, a, prefix, ChunkSize, header)
+}
+
+// NewDecryptReader reads a stream header written by NewEncryptWriter from r and returns a
+// Reader opening the chunks that follow it. ErrNotStream is returned before deriving the key
+// if r doesn't start with the stream magic
+func NewDecryptReader(r io.Reader, version byte, newAEAD NewAEADFunc, passphrase string) (*Reader, error) {
+	v := make([]byte, len(streamMagic)+1)
+	if _, err := io.ReadFull(r, v); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotStream
+		}
+		logger.Error("could not read stream header", logger.Err(err))
+		return nil, errors.Wrap(err, "could not read stream header")
+	}
+	if !bytes.Equal(v[:len(streamMagic)], streamMagic) {
+		return nil, ErrNotStream
+	}
+	if v[len(streamMagic)] != version {
+		return nil, ErrUnknownVersion
+	}
+
+	params, salt, kdfHeader, err := kdf.ReadHeader(r)
+	if err != nil {
+		logger.Error("could not read stream header", logger.Err(err))
+		return nil, errors.Wrap(err, "could not read stream header")
+	}
+
+	key, err := kdf.Key(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, a.NonceSize()-NonceOverhead)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		logger.Error("could not read stream header", logger.Err(err))
+		return nil, errors.Wrap(err, "could not read stream header")
+	}
+
+	return NewReader(r, a, prefix, ChunkSize, streamHeader(version, kdfHeader, prefix))
+}
+
+// Stream pairs a stream version with the AEAD of a package, so that the aes and cc20
+// packages share the stream and file helpers below and only differ in their constructor
+type Stream struct {
+	Version byte
+	NewAEAD NewAEADFunc
+	// Backup keeps the previous version of the files replaced by EncryptFile and RotateFile
+	Backup bool
+}
+
+// NewEncryptWriter is NewEncryptWriter with the version and AEAD of the stream
+func (s Stream) NewEncryptWriter(w io.Writer, passphrase string, params kdf.Params) (io.WriteCloser, error) {
+	sw, err := NewEncryptWriter(w, s.Version, s.NewAEAD, passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// NewDecryptReader is NewDecryptReader with the version and AEAD of the stream
+func (s Stream) NewDecryptReader(r io.Reader, passphrase string) (io.Reader, error) {
+	sr, err := NewDecryptReader(r, s.Version, s.NewAEAD, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// Encrypt encrypts everything read from src with the given passphrase and writes it to dst
+func (s Stream) Encrypt(dst io.Writer, src io.Reader, passphrase string, params kdf.Params) error {
+	w, err := s.NewEncryptWriter(dst, passphrase, params)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		logger.Error("could not encrypt stream", logger.Err(err))
+		return errors.Wrap(err, "could not encrypt stream")
+	}
+	return w.Close()
+}
+
+// Decrypt decrypts a stream written by Encrypt from src and writes it to dst. Data is
+// written to dst as chunks are authenticated, so dst must be discarded on error
+func (s Stream) Decrypt(dst io.Writer, src io.Reader, passphrase string) error {
+	r, err := s.NewDecryptReader(src, passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		logger.Error("could not decrypt stream", logger.Err(err))
+		return errors.Wrap(err, "could not decrypt stream")
+	}
+	return nil
+}
+
+// EncryptFile encrypts everything read from src into filename without holding it in memory.
+// The file is replaced atomically with 0600 permissions, keeping the previous version if
+// s.Backup is set
+func (s Stream) EncryptFile(filename string, src io.Reader, passphrase string, params kdf.Params) error {
+	return WriteFileFunc(filename, s.Backup, func(w io.Writer) error {
+		return s.Encrypt(w, src, passphrase, params)
+	})
+}
+
+// DecryptFile decrypts filename, which was written by EncryptFile, into dst. Data is written
+// to dst as chunks are authenticated, so dst must be discarded on error. ErrNotStream is only
+// returned if the file doesn't start with a stream header, other errors such as a wrong
+// passphrase are returned as they are
+func (s Stream) DecryptFile(dst io.Writer, filename string, passphrase string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		logger.Error("could not open file", logger.Err(err))
+		return errors.Wrap(err, "could not open file")
+	}
+	defer f.Close()
+
+	return s.Decrypt(dst, f, passphrase)
+}
+
+// RotateFile re-encrypts filename, which was written by EncryptFile, with a new passphrase
+// without holding it in memory. The original is only replaced once every chunk was
+// authenticated and the new file decrypts with the new passphrase, and is kept as a backup if
+// s.Backup is set
+func (s Stream) RotateFile(filename string, oldPassphrase string, newPassphrase string, params kdf.Params) error {
+	write := func(w io.Writer) error {
+		enc, err := s.NewEncryptWriter(w, newPassphrase, params)
+		if err != nil {
+			return err
+		}
+		if err := s.DecryptFile(enc, filename, oldPassphrase); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	verify := func(name string) error {
+		if err := s.DecryptFile(ioutil.Discard, name, newPassphrase); err != nil {
+			logger.Error("could not verify re-encrypted file", logger.Err(err))
+			return errors.Wrap(ErrVerifyFailed, err.Error())
+		}
+		return nil
+	}
+	return writeFile(filename, s.Backup, write, verify)
+}
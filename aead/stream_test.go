@@ -0,0 +1,105 @@
+// +build all travis
+
+package aead
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	cc20 "golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestStream(t *testing.T) {
+	key := make([]byte, cc20.KeySize)
+	rand.Read(key)
+	a, err := cc20.NewX(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := make([]byte, a.NonceSize()-NonceOverhead)
+	rand.Read(prefix)
+	chunkSize := 16
+	aad := []byte("header")
+
+	seal := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, a, prefix, chunkSize, aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// write in odd sized pieces to exercise the buffering
+		for len(data) > 0 {
+			n := 7
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := w.Write(data[:n]); err != nil {
+				t.Fatal(err)
+			}
+			data = data[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	open := func(sealed []byte) ([]byte, error) {
+		r, err := NewReader(bytes.NewReader(sealed), a, prefix, chunkSize, aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ioutil.ReadAll(r)
+	}
+
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 100} {
+		data := make([]byte, size)
+		rand.Read(data)
+		sealed := seal(data)
+		opened, err := open(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(opened, data) {
+			t.Fatalf("stream of size %d doesn't round trip", size)
+		}
+	}
+
+	data := make([]byte, 40)
+	sealed := seal(data)
+	sealedChunk := chunkSize + a.Overhead()
+
+	// dropping the final chunk must be detected
+	if _, err := open(sealed[:2*sealedChunk]); err != ErrInvalidChunk {
+		t.Fatalf("truncated stream not detected")
+	}
+	// swapping the first two chunks must be detected
+	swapped := append([]byte{}, sealed[sealedChunk:2*sealedChunk]...)
+	swapped = append(swapped, sealed[:sealedChunk]...)
+	swapped = append(swapped, sealed[2*sealedChunk:]...)
+	if _, err := open(swapped); err != ErrInvalidChunk {
+		t.Fatalf("reordered stream not detected")
+	}
+	// flipping a bit must be detected
+	tampered := append([]byte{}, sealed...)
+	tampered[3] ^= 1
+	if _, err := open(tampered); err != ErrInvalidChunk {
+		t.Fatalf("tampered stream not detected")
+	}
+	if _, err := open(nil); err != ErrInvalidChunk {
+		t.Fatalf("empty stream not detected")
+	}
+
+	w, err := NewWriter(ioutil.Discard, a, prefix, chunkSize, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if _, err := w.Write([]byte("blah")); err != ErrStreamClosed {
+		t.Fatalf("write after close not detected")
+	}
+	if _, err := NewWriter(ioutil.Discard, a, prefix[1:], chunkSize, aad); err == nil {
+		t.Fatalf("short nonce prefix not detected")
+	}
+}
@@ -0,0 +1,109 @@
+package aead
+
+import (
+	"github.com/pkg/errors"
+
+	kdf "github.com/Varunram/essentials/kdf"
+)
+
+// Tagged ciphertexts start with the name of the cipher that sealed them
+// tagMagic (1 byte) || length of the name (1 byte) || name || ciphertext
+// so that data sealed before an application switched ciphers can still be opened. The tag
+// is authenticated as additional data so it can't be swapped
+
+// tagMagic is the first byte of tagged ciphertexts
+const tagMagic byte = 0xae
+
+// tag returns the tag of the cipher registered under name
+func tag(name string) []byte {
+	t := make([]byte, 0, 2+len(name))
+	t = append(t, tagMagic, byte(len(name)))
+	return append(t, name...)
+}
+
+// parseTag splits tagged data into its tag, the cipher name and the ciphertext
+func parseTag(data []byte) ([]byte, string, []byte, bool) {
+	if len(data) < 2 || data[0] != tagMagic || len(data) < 2+int(data[1]) {
+		return nil, "", nil, false
+	}
+	n := 2 + int(data[1])
+	return data[:n], string(data[2:n]), data[n:], true
+}
+
+// openOutdated opens data with c, using OpenOutdated if c is an Upgrader
+func openOutdated(c Cipher, data []byte, aad []byte) ([]byte, bool, error) {
+	if u, ok := c.(Upgrader); ok {
+		return u.OpenOutdated(data, aad)
+	}
+	plaintext, err := c.Open(data, aad)
+	return plaintext, false, err
+}
+
+type tagged struct {
+	name       string
+	passphrase string
+	params     kdf.Params
+	c          Cipher
+}
+
+// NewTagged returns a cipher that seals with the cipher registered under name and tags the
+// ciphertext with that name. Tagged ciphertexts are opened with the cipher named in them, so
+// switching ciphers doesn't require rewriting stored data, and untagged ciphertexts are opened
+// with the named cipher. Ciphertexts that are untagged or were sealed by another cipher are
+// reported as outdated, so OpenFile seals them again with the named cipher
+func NewTagged(name string, passphrase string, params kdf.Params) (Cipher, error) {
+	c, err := NewWithParams(name, passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(name) > 255 {
+		return nil, errors.New("cipher name too long to be tagged")
+	}
+	return tagged{name: name, passphrase: passphrase, params: params, c: c}, nil
+}
+
+func (t tagged) Name() string {
+	return t.name
+}
+
+func (t tagged) Seal(plaintext, aad []byte) ([]byte, error) {
+	header := tag(t.name)
+	ciphertext, err := t.c.Seal(plaintext, AdditionalData(header, aad))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, ciphertext...), nil
+}
+
+func (t tagged) Open(ciphertext, aad []byte) ([]byte, error) {
+	plaintext, _, err := t.OpenOutdated(ciphertext, aad)
+	return plaintext, err
+}
+
+func (t tagged) OpenOutdated(ciphertext, aad []byte) ([]byte, bool, error) {
+	var terr error
+	if header, name, data, ok := parseTag(ciphertext); ok {
+		c := t.c
+		if name != t.name {
+			c, terr = NewWithParams(name, t.passphrase, t.params)
+		}
+		if terr == nil {
+			var plaintext []byte
+			var outdated bool
+			plaintext, outdated, terr = openOutdated(c, data, AdditionalData(header, aad))
+			if terr == nil {
+				return plaintext, outdated || name != t.name, nil
+			}
+		}
+		// the first byte of a legacy ciphertext may match tagMagic, so try it untagged too
+	}
+
+	plaintext, _, err := openOutdated(t.c, ciphertext, aad)
+	if err != nil {
+		if terr != nil {
+			return nil, false, terr
+		}
+		return nil, false, err
+	}
+	return plaintext, true, nil
+}
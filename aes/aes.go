@@ -1,109 +1,337 @@
 package aes
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
+	"io"
 	"io/ioutil"
-	"log"
-	"os"
 
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/sha3"
 
+	aead "github.com/Varunram/essentials/aead"
+	kdf "github.com/Varunram/essentials/kdf"
+	"github.com/Varunram/essentials/logger"
 	utils "github.com/Varunram/essentials/utils"
 )
 
 // the aes package implements AES-256 GCM encryption and decrpytion functions
 
-// Encrypt encrypts a given data stream with a given passphrase
-func Encrypt(data []byte, passphrase string) ([]byte, error) {
-	sha3Hash := utils.SHA3hash(passphrase)
-	key := []byte(sha3Hash[0:32])
+// Ciphertexts are self describing envelopes of the form
+// version (1 byte) || kdf header || nonce (12 bytes) || sealed data
+// where the kdf header holds the KDF params and the salt (see kdf.Params.Header). Everything
+// before the nonce is authenticated as additional data so it can't be tampered with.
+// Ciphertexts written by older versions of this package either had a version 1 header with
+// a SHA3 derived key or didn't carry a header at all and used a nonce derived from the
+// passphrase, both can still be decrypted.
+
+// Version is the version byte of the ciphertext envelope written by Encrypt
+const Version byte = 2
+
+// versionSHA3 is the version byte of envelopes that derived the key with a single SHA3
+const versionSHA3 byte = 1
+
+// SaltSize is the size of the random salt stored in the envelope
+const SaltSize = kdf.SaltSize
+
+// sizes of the GCM nonce and authentication tag
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// ErrInvalidCiphertext is returned when the passed data is too short to be a valid envelope
+var ErrInvalidCiphertext = errors.New("ciphertext too short or malformed")
+
+// newGCM returns an AES-256 GCM instance for the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		logger.Error("error while initializing new cipher", logger.Err(err))
+		return nil, errors.Wrap(err, "Error while initializing new cipher")
+	}
 
-	block, _ := aes.NewCipher(key)
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		log.Println("Error while opening new GCM block")
+		logger.Error("error while opening new GCM block", logger.Err(err))
 		return nil, errors.Wrap(err, "Error while opening new GCM block")
 	}
 
-	nonce := []byte(utils.SHA3hash(sha3Hash))[0:gcm.NonceSize()]
+	return gcm, nil
+}
 
-	ciphertext := gcm.Seal(nil, nonce, data, nil)
-	return ciphertext, nil
+// deriveKeySHA3 derives the key of a version 1 envelope from the passphrase and the salt
+func deriveKeySHA3(passphrase string, salt []byte) []byte {
+	h := sha3.New256()
+	h.Write(salt)
+	h.Write([]byte(passphrase))
+	return h.Sum(nil)
 }
 
-// Decrypt decrypts a given data stream with a given passphrase
-func Decrypt(data []byte, passphrase string) ([]byte, error) {
-	if len(data) == 0 || len(passphrase) == 0 {
-		log.Println("length of data is zero, can't decrypt")
-		return data, errors.New("length of data is zero, can't decrpyt")
-	}
+// Name is the name the aes cipher is registered under in the aead package
+const Name = "aes"
 
-	sha3Hash := utils.SHA3hash(passphrase)
-	key := []byte(sha3Hash[0:32])
-	block, err := aes.NewCipher(key)
+func init() {
+	aead.Register(Name, func(passphrase string, params kdf.Params) aead.Cipher {
+		return NewCipherWithParams(passphrase, params)
+	})
+}
+
+// Cipher implements aead.Cipher with AES-256 GCM
+type Cipher struct {
+	passphrase string
+	params     kdf.Params
+}
+
+// NewCipher returns a Cipher deriving keys from the passphrase with the default KDF params
+func NewCipher(passphrase string) *Cipher {
+	return NewCipherWithParams(passphrase, kdf.Default)
+}
+
+// NewCipherWithParams returns a Cipher deriving keys from the passphrase with the passed KDF params
+func NewCipherWithParams(passphrase string, params kdf.Params) *Cipher {
+	return &Cipher{passphrase: passphrase, params: params}
+}
+
+// Name returns the name of the cipher
+func (c *Cipher) Name() string {
+	return Name
+}
+
+// Seal encrypts the plaintext and authenticates it along with the additional data
+func (c *Cipher) Seal(plaintext, aad []byte) ([]byte, error) {
+	return seal(plaintext, c.passphrase, c.params, aad)
+}
+
+// Open decrypts a ciphertext sealed with the same passphrase and additional data
+func (c *Cipher) Open(ciphertext, aad []byte) ([]byte, error) {
+	plaintext, _, err := decrypt(ciphertext, c.passphrase, aad)
+	return plaintext, err
+}
+
+// OpenOutdated is Open, also returning whether the ciphertext was in an older format
+func (c *Cipher) OpenOutdated(ciphertext, aad []byte) ([]byte, bool, error) {
+	return decrypt(ciphertext, c.passphrase, aad)
+}
+
+// Encrypt encrypts a given data stream with a given passphrase using the default KDF params
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	return seal(data, passphrase, kdf.Default, nil)
+}
+
+// EncryptWithParams encrypts a given data stream with a given passphrase, deriving the key
+// with the passed KDF params
+func EncryptWithParams(data []byte, passphrase string, params kdf.Params) ([]byte, error) {
+	return seal(data, passphrase, params, nil)
+}
+
+// seal encrypts data into an envelope, authenticating the header and the additional data
+func seal(data []byte, passphrase string, params kdf.Params, aad []byte) ([]byte, error) {
+	salt, err := kdf.NewSalt()
 	if err != nil {
-		log.Println("Error while initializing new cipher")
-		return data, errors.Wrap(err, "Error while initializing new cipher")
+		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	kdfHeader, err := params.Header(salt)
 	if err != nil {
-		log.Println("failed to initialize new gcm block")
-		return data, errors.Wrap(err, "failed to initialize new gcm block")
+		logger.Error("invalid kdf params", logger.Err(err))
+		return nil, errors.Wrap(err, "invalid kdf params")
 	}
 
-	nonce := []byte(utils.SHA3hash(sha3Hash))[0:gcm.NonceSize()]
+	key, err := kdf.Key(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
 
-	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	gcm, err := newGCM(key)
 	if err != nil {
-		log.Println("failed to decrypt data")
-		return plaintext, errors.Wrap(err, "failed to decrypt data")
+		return nil, err
 	}
 
-	return plaintext, nil
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		logger.Error("could not generate random nonce", logger.Err(err))
+		return nil, errors.Wrap(err, "could not generate random nonce")
+	}
+
+	header := make([]byte, 0, 1+len(kdfHeader))
+	header = append(header, Version)
+	header = append(header, kdfHeader...)
+
+	ciphertext := make([]byte, 0, len(header)+len(nonce)+len(data)+gcm.Overhead())
+	ciphertext = append(ciphertext, header...)
+	ciphertext = append(ciphertext, nonce...)
+	return gcm.Seal(ciphertext, nonce, data, aead.AdditionalData(header, aad)), nil
 }
 
-// EncryptFile encrypts a given file with the given passphrase
-func EncryptFile(filename string, data []byte, passphrase string) error {
-	f, err := os.Create(filename)
-	if err != nil {
-		log.Println("Error while creating file")
-		return errors.Wrap(err, "Error while creating file")
+// Decrypt decrypts a given data stream with a given passphrase
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	plaintext, _, err := decrypt(data, passphrase, nil)
+	return plaintext, err
+}
+
+// decrypt opens an envelope, falling back to the legacy format if the data isn't one.
+// The returned bool is true if the data was in an older format than Version
+func decrypt(data []byte, passphrase string, aad []byte) ([]byte, bool, error) {
+	if len(data) == 0 || len(passphrase) == 0 {
+		logger.Error("length of data is zero, can't decrypt")
+		return data, false, errors.New("length of data is zero, can't decrpyt")
+	}
+
+	plaintext, err := openEnvelope(data, passphrase, aad)
+	if err == nil {
+		return plaintext, data[0] != Version, nil
+	}
+
+	// the first byte of a legacy ciphertext may match a version byte, so try both. Legacy
+	// ciphertexts can't be bound to additional data, so don't accept them if some was passed
+	if len(aad) != 0 {
+		logger.Error("failed to decrypt data")
+		return nil, false, errors.Wrap(err, "failed to decrypt data")
+	}
+	plaintext, lerr := decryptLegacy(data, passphrase)
+	if lerr != nil {
+		logger.Error("failed to decrypt data", logger.Err(lerr))
+		return nil, false, errors.Wrap(err, "failed to decrypt data")
 	}
 
-	defer func() {
-		if ferr := f.Close(); ferr != nil {
-			err = ferr
-			os.Remove(filename)
+	return plaintext, true, nil
+}
+
+// openEnvelope opens a ciphertext written by seal or by the version 1 format
+func openEnvelope(data []byte, passphrase string, aad []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidCiphertext
+	}
+
+	var params kdf.Params
+	var salt []byte
+	var headerLen, n int
+	var err error
+	switch data[0] {
+	case Version:
+		params, salt, n, err = kdf.ParseHeader(data[1:])
+		if err != nil {
+			return nil, err
 		}
-	}()
+		headerLen = 1 + n
+	case versionSHA3:
+		headerLen = 1 + SaltSize
+		if len(aad) != 0 {
+			return nil, ErrInvalidCiphertext
+		}
+	default:
+		return nil, ErrInvalidCiphertext
+	}
 
-	data, err = Encrypt(data, passphrase)
-	if err != nil {
-		log.Println("Error while encrypting file")
-		err = os.Remove(filename)
+	// check the length before deriving the key so that short inputs don't cost a KDF run
+	if len(data) < headerLen+gcmNonceSize+gcmTagSize {
+		return nil, ErrInvalidCiphertext
+	}
+
+	var key []byte
+	if data[0] == Version {
+		key, err = kdf.Key(passphrase, salt, params)
 		if err != nil {
-			log.Println("could not delete file: ", filename)
-			panic(err) // panic since we can't return
+			return nil, err
 		}
-		return errors.Wrap(err, "Error while encrypting file")
+	} else {
+		key = deriveKeySHA3(passphrase, data[1:headerLen])
 	}
 
-	f.Write(data)
-	return nil
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := data[:headerLen]
+	nonce := data[headerLen : headerLen+gcm.NonceSize()]
+	return gcm.Open(nil, nonce, data[headerLen+gcm.NonceSize():], aead.AdditionalData(header, aad))
 }
 
-// DecryptFile encrypts a given file with the given passphrase
-func DecryptFile(filename string, passphrase string) ([]byte, error) {
-	data, err := ioutil.ReadFile(filename)
+// decryptLegacy decrypts data written before ciphertexts carried a header. These used
+// a key and nonce derived deterministically from the passphrase
+func decryptLegacy(data []byte, passphrase string) ([]byte, error) {
+	sha3Hash := utils.SHA3hash(passphrase)
+	key := []byte(sha3Hash[0:32])
+
+	gcm, err := newGCM(key)
 	if err != nil {
-		log.Println("could not read from file: ", err)
-		return data, err
+		return nil, err
 	}
-	dData, err := Decrypt(data, passphrase)
-	if err != nil {
-		log.Println("could not decrypt data: ", err)
+
+	nonce := []byte(utils.SHA3hash(sha3Hash))[0:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+// EncryptFile encrypts a given file with the given passphrase. The file is replaced atomically
+// with 0600 permissions, use a Stream with Backup set to keep the previous version
+func EncryptFile(filename string, data []byte, passphrase string) error {
+	return EncryptFileWithParams(filename, data, passphrase, kdf.Default)
+}
+
+// EncryptFileWithParams encrypts a given file with the given passphrase and KDF params
+func EncryptFileWithParams(filename string, data []byte, passphrase string, params kdf.Params) error {
+	return stream.EncryptFile(filename, bytes.NewReader(data), passphrase, params)
+}
+
+// EncryptFileFrom encrypts everything read from src into filename without holding it in
+// memory. Files are written in the stream format, so they can be read with DecryptStream
+func EncryptFileFrom(filename string, src io.Reader, passphrase string) error {
+	return stream.EncryptFile(filename, src, passphrase, kdf.Default)
+}
+
+// DecryptFile decrypts a given file with the given passphrase. Files written in an older
+// format are re-encrypted in place with the default KDF params and a fresh salt and nonce
+func DecryptFile(filename string, passphrase string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := DecryptFileTo(&buf, filename, passphrase); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptFileTo decrypts a given file into dst without holding it in memory. Data is written
+// to dst as it is authenticated, so dst must be discarded on error. Files written before
+// EncryptFile used the stream format are read whole and re-encrypted in place
+func DecryptFileTo(dst io.Writer, filename string, passphrase string) error {
+	err := stream.DecryptFile(dst, filename, passphrase)
+	if errors.Cause(err) != aead.ErrNotStream {
+		return err
+	}
+
+	data, rerr := ioutil.ReadFile(filename)
+	if rerr != nil {
+		logger.Error("could not read from file", logger.Err(rerr))
+		return errors.Wrap(rerr, "could not read from file")
+	}
+	plaintext, _, derr := decrypt(data, passphrase, nil)
+	if derr != nil {
+		return errors.Wrap(derr, "could not decrypt file")
+	}
+	// the data is already decrypted so failing to upgrade the file isn't fatal
+	if uerr := stream.EncryptFile(filename, bytes.NewReader(plaintext), passphrase, kdf.Default); uerr != nil {
+		logger.Error("could not re-encrypt outdated file", logger.Err(uerr))
+	}
+	if _, err := dst.Write(plaintext); err != nil {
+		logger.Error("could not write decrypted file", logger.Err(err))
+		return errors.Wrap(err, "could not write decrypted file")
+	}
+	return nil
+}
+
+// RotateFile re-encrypts a file written by EncryptFile with a new passphrase without holding
+// it in memory. The original is only replaced once it was decrypted completely
+func RotateFile(filename string, oldPassphrase string, newPassphrase string) error {
+	err := stream.RotateFile(filename, oldPassphrase, newPassphrase, kdf.Default)
+	if errors.Cause(err) != aead.ErrNotStream {
+		return err
+	}
+	// upgrade files written in an older format first
+	if _, err := DecryptFile(filename, oldPassphrase); err != nil {
+		return err
 	}
-	return dData, err
+	return stream.RotateFile(filename, oldPassphrase, newPassphrase, kdf.Default)
 }
@@ -3,9 +3,20 @@
 package aes
 
 import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/pkg/errors"
+
+	aead "github.com/Varunram/essentials/aead"
+	cc20 "github.com/Varunram/essentials/chacha20poly1305"
+	kdf "github.com/Varunram/essentials/kdf"
+	utils "github.com/Varunram/essentials/utils"
 )
 
 func TestAes(t *testing.T) {
@@ -57,3 +68,329 @@ func TestAes(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// encryptLegacy encrypts data the way this package did before ciphertexts carried a header
+func encryptLegacy(data []byte, passphrase string) []byte {
+	sha3Hash := utils.SHA3hash(passphrase)
+	gcm, _ := newGCM([]byte(sha3Hash[0:32]))
+	nonce := []byte(utils.SHA3hash(sha3Hash))[0:gcm.NonceSize()]
+	return gcm.Seal(nil, nonce, data, nil)
+}
+
+// encryptSHA3 encrypts data into a version 1 envelope
+func encryptSHA3(data []byte, passphrase string) []byte {
+	salt, _ := kdf.NewSalt()
+	gcm, _ := newGCM(deriveKeySHA3(passphrase, salt))
+	header := append([]byte{versionSHA3}, salt...)
+	nonce := make([]byte, gcm.NonceSize())
+	ciphertext := append(append([]byte{}, header...), nonce...)
+	return gcm.Seal(ciphertext, nonce, data, header)
+}
+
+func TestEnvelope(t *testing.T) {
+	password := "Cool"
+	c1, err := Encrypt([]byte("Hello World"), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := Encrypt([]byte("Hello World"), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1[0] != Version {
+		t.Fatalf("envelope doesn't start with the version byte")
+	}
+	// the salt ends the kdf header and is followed by the nonce
+	saltStart := 1 + 10
+	if bytes.Equal(c1[saltStart:saltStart+SaltSize+12], c2[saltStart:saltStart+SaltSize+12]) {
+		t.Fatalf("salt and nonce reused across messages")
+	}
+	c1[saltStart] ^= 0xff
+	_, err = Decrypt(c1, password)
+	if err == nil {
+		t.Fatalf("tampered salt not detected")
+	}
+
+	c3, err := EncryptWithParams([]byte("Hello World"), password, kdf.ScryptModerate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := Decrypt(c3, password)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("could not decrypt scrypt ciphertext")
+	}
+	_, err = EncryptWithParams([]byte("Hello World"), password, kdf.Params{})
+	if err == nil {
+		t.Fatalf("invalid kdf params not caught")
+	}
+
+	v1 := encryptSHA3([]byte("Hello World"), password)
+	plaintext, outdated, err := decrypt(v1, password, nil)
+	if err != nil || string(plaintext) != "Hello World" || !outdated {
+		t.Fatalf("could not decrypt version 1 ciphertext")
+	}
+
+	legacy := encryptLegacy([]byte("Hello World"), password)
+	plaintext, err = Decrypt(legacy, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "Hello World" {
+		t.Fatalf("could not decrypt legacy ciphertext")
+	}
+
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+	err = ioutil.WriteFile("test_files/legacy.txt", legacy, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DecryptFile("test_files/legacy.txt", "Notcool")
+	if err == nil || errors.Cause(err) == aead.ErrNotStream {
+		t.Fatalf("wrong password on a legacy file not reported: %v", err)
+	}
+	untouched, err := ioutil.ReadFile("test_files/legacy.txt")
+	if err != nil || !bytes.Equal(untouched, legacy) {
+		t.Fatalf("legacy file modified by a failed decryption")
+	}
+	plaintext, err = DecryptFile("test_files/legacy.txt", password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "Hello World" {
+		t.Fatalf("could not decrypt legacy file")
+	}
+	upgraded, err := ioutil.ReadFile("test_files/legacy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(upgraded, legacy) {
+		t.Fatalf("legacy file not re-encrypted")
+	}
+	var opened bytes.Buffer
+	err = DecryptStream(&opened, bytes.NewReader(upgraded), password)
+	if err != nil || opened.String() != "Hello World" {
+		t.Fatalf("re-encrypted file is not a valid stream")
+	}
+}
+
+func TestStream(t *testing.T) {
+	password := "Cool"
+	data := make([]byte, 3*aead.ChunkSize+100)
+	rand.Read(data)
+
+	var sealed bytes.Buffer
+	err := EncryptStream(&sealed, bytes.NewReader(data), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opened bytes.Buffer
+	err = DecryptStream(&opened, bytes.NewReader(sealed.Bytes()), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened.Bytes(), data) {
+		t.Fatalf("stream doesn't round trip")
+	}
+
+	err = DecryptStream(ioutil.Discard, bytes.NewReader(sealed.Bytes()), "Notcool")
+	if err == nil {
+		t.Fatalf("Didn't catch error during decrpytion, exiting!")
+	}
+	truncated := sealed.Bytes()[:sealed.Len()-200]
+	err = DecryptStream(ioutil.Discard, bytes.NewReader(truncated), password)
+	if err == nil {
+		t.Fatalf("truncated stream not detected")
+	}
+}
+
+func TestCipher(t *testing.T) {
+	c, err := aead.New(Name, "Cool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != Name {
+		t.Fatalf("registered cipher has the wrong name")
+	}
+	ciphertext, err := c.Seal([]byte("Hello World"), []byte("record 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := c.Open(ciphertext, []byte("record 1"))
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("could not open ciphertext with additional data")
+	}
+	_, err = c.Open(ciphertext, []byte("record 2"))
+	if err == nil {
+		t.Fatalf("mismatching additional data not detected")
+	}
+	_, err = c.Open(ciphertext, nil)
+	if err == nil {
+		t.Fatalf("missing additional data not detected")
+	}
+	// legacy ciphertexts can't be bound to additional data
+	_, err = c.Open(encryptLegacy([]byte("Hello World"), "Cool"), []byte("record 1"))
+	if err == nil {
+		t.Fatalf("legacy ciphertext accepted with additional data")
+	}
+	_, err = aead.New("blah", "Cool")
+	if err == nil {
+		t.Fatalf("unknown cipher not detected")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+	err := aead.SealFile(NewCipher("Cool"), "test_files/seed.key", []byte("Hello World"), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, _ := ioutil.ReadFile("test_files/seed.key")
+
+	err = aead.RotateFile("test_files/seed.key", NewCipher("Notcool"), NewCipher("New"), nil, false)
+	if err == nil {
+		t.Fatalf("rotated with the wrong password")
+	}
+	unchanged, _ := ioutil.ReadFile("test_files/seed.key")
+	if !bytes.Equal(original, unchanged) {
+		t.Fatalf("file modified by a failed rotation")
+	}
+
+	to := NewCipherWithParams("New", kdf.ScryptModerate)
+	err = aead.RotateFile("test_files/seed.key", NewCipher("Cool"), to, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := aead.OpenFile(NewCipher("New"), "test_files/seed.key", nil)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("rotated file doesn't decrypt with the new password")
+	}
+	_, err = aead.OpenFile(NewCipher("Cool"), "test_files/seed.key", nil)
+	if err == nil {
+		t.Fatalf("rotated file still decrypts with the old password")
+	}
+}
+
+func TestFile(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+	data := make([]byte, 2*aead.ChunkSize+10)
+	rand.Read(data)
+
+	err := EncryptFileFrom("test_files/large.bin", bytes.NewReader(data), "Cool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opened bytes.Buffer
+	err = DecryptFileTo(&opened, "test_files/large.bin", "Cool")
+	if err != nil || !bytes.Equal(opened.Bytes(), data) {
+		t.Fatalf("file doesn't round trip: %v", err)
+	}
+
+	original, _ := ioutil.ReadFile("test_files/large.bin")
+	err = RotateFile("test_files/large.bin", "Notcool", "New")
+	if err == nil {
+		t.Fatalf("rotated with the wrong password")
+	}
+	unchanged, _ := ioutil.ReadFile("test_files/large.bin")
+	if !bytes.Equal(original, unchanged) {
+		t.Fatalf("file modified by a failed rotation")
+	}
+	matches, _ := filepath.Glob("test_files/.large.bin.tmp*")
+	if len(matches) != 0 {
+		t.Fatalf("failed rotation left temporary files: %v", matches)
+	}
+
+	// a wrong password on a stream is an authentication failure, not a fallback
+	err = DecryptFileTo(ioutil.Discard, "test_files/large.bin", "Notcool")
+	if errors.Cause(err) != aead.ErrInvalidChunk {
+		t.Fatalf("expected ErrInvalidChunk, got %v", err)
+	}
+
+	err = RotateFile("test_files/large.bin", "Cool", "New")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := DecryptFile("test_files/large.bin", "New")
+	if err != nil || !bytes.Equal(plaintext, data) {
+		t.Fatalf("rotated file doesn't decrypt with the new password")
+	}
+	_, err = DecryptFile("test_files/large.bin", "Cool")
+	if err == nil {
+		t.Fatalf("rotated file still decrypts with the old password")
+	}
+	if _, err := os.Stat("test_files/large.bin" + aead.BackupSuffix); !os.IsNotExist(err) {
+		t.Fatalf("backup kept by the default stream")
+	}
+
+	stream := Stream()
+	stream.Backup = true
+	err = stream.RotateFile("test_files/large.bin", "New", "Cool", kdf.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = DecryptFile("test_files/large.bin"+aead.BackupSuffix, "New")
+	if err != nil || !bytes.Equal(plaintext, data) {
+		t.Fatalf("backup doesn't decrypt with the old password")
+	}
+
+	// files in the envelope format are upgraded by RotateFile
+	err = aead.SealFile(NewCipher("Cool"), "test_files/seed.key", []byte("Hello World"), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RotateFile("test_files/seed.key", "Cool", "New")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = DecryptFile("test_files/seed.key", "New")
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("rotated envelope doesn't decrypt with the new password")
+	}
+}
+
+func TestTagged(t *testing.T) {
+	c, err := aead.NewTagged(Name, "Cool", kdf.Interactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := c.Seal([]byte("Hello World"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// switching to another cipher still opens data sealed with aes and reports it as outdated
+	cc, err := aead.NewTagged(cc20.Name, "Cool", kdf.Interactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, outdated, err := cc.(aead.Upgrader).OpenOutdated(sealed, nil)
+	if err != nil || string(plaintext) != "Hello World" || !outdated {
+		t.Fatalf("could not open data tagged with another cipher: %v", err)
+	}
+	if _, err := cc.Open(sealed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tag is authenticated
+	swapped := append([]byte{}, sealed...)
+	copy(swapped[2:], "aez")
+	if _, err := c.Open(swapped, nil); err == nil {
+		t.Fatalf("swapped tag not detected")
+	}
+	wrong, _ := aead.NewTagged(cc20.Name, "Notcool", kdf.Interactive)
+	if _, err := wrong.Open(sealed, nil); err == nil {
+		t.Fatalf("opened with the wrong password")
+	}
+
+	// untagged data sealed before is opened with the configured cipher
+	untagged, err := NewCipherWithParams("Cool", kdf.Interactive).Seal([]byte("Hello World"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, outdated, err = c.(aead.Upgrader).OpenOutdated(untagged, nil)
+	if err != nil || string(plaintext) != "Hello World" || !outdated {
+		t.Fatalf("could not open untagged data: %v", err)
+	}
+}
@@ -1,10 +1,9 @@
 package algorand
 
 import (
-	"log"
-
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
 	utils "github.com/Varunram/essentials/utils"
 	"github.com/algorand/go-algorand-sdk/client/algod"
 	"github.com/algorand/go-algorand-sdk/client/algod/models"
@@ -35,7 +34,7 @@ func InitAlgodClient() (algod.Client, error) {
 	var err error
 	AlgodClient, err = algod.MakeClient(AlgodAddress, AlgodToken)
 	if err != nil {
-		log.Printf("failed to make algod client: %s\n", err)
+		logger.Error("failed to make algod client", logger.Err(err))
 		return AlgodClient, nil
 	}
 
@@ -74,7 +73,7 @@ func GetStatus(Client algod.Client) (models.NodeStatus, error) {
 	var status models.NodeStatus
 	status, err := AlgodClient.Status()
 	if err != nil {
-		log.Printf("error getting algod status: %s\n", err)
+		logger.Error("error getting algod status", logger.Err(err))
 		return status, err
 	}
 
@@ -99,7 +98,7 @@ func generateWalletToken(walletID string, password string) (string, error) {
 	// and creating accounts. Wallet handles do expire, but they can be renewed
 	initResponse, err := KmdClient.InitWalletHandle(walletID, password)
 	if err != nil {
-		log.Printf("Error initializing wallet handle: %s\n", err)
+		logger.Error("error initializing wallet handle", logger.Err(err))
 		return "", err
 	}
 
@@ -112,10 +111,10 @@ func generateAddress(walletHandleToken string) (string, error) {
 	// Generate a new address from the wallet handle
 	genResponse, err := KmdClient.GenerateKey(walletHandleToken)
 	if err != nil {
-		log.Printf("Error generating key: %s\n", err)
+		logger.Error("error generating key", logger.Err(err))
 		return "", err
 	}
-	log.Printf("Generated address %s\n", genResponse.Address)
+	logger.Info("generated address", logger.F("address", genResponse.Address))
 	return genResponse.Address, nil
 }
 
@@ -152,7 +151,7 @@ func sendTx(fromAddr string, toAddr string, amount uint64, note []byte,
 		return "", errors.Wrap(err, "failed to send transaction")
 	}
 
-	log.Println("Transaction ID: ", sendResponse.TxID)
+	logger.Info("sent transaction", logger.F("txid", sendResponse.TxID))
 	return sendResponse.TxID, nil
 }
 
@@ -176,7 +175,7 @@ func GetAlgo(walletName string, password string) (string, error) {
 		return "", errors.Wrap(err, "error generating key")
 	}
 
-	log.Println("Generated to address: ", toAddr)
+	logger.Info("generated to address", logger.F("address", toAddr))
 	fromAddr := "YXU3MTTKV74UAGED6ROTHVVPEY5646WI3N5FLLQZWFV66AFKVQ5PMMYDZE"
 	amount := uint64(150000) // 100000 is the minimum balance an account can hold
 
@@ -186,7 +185,7 @@ func GetAlgo(walletName string, password string) (string, error) {
 	if err != nil {
 		return "", errors.Wrap(err, "couldn't send tx")
 	}
-	log.Println("txid: ", txid)
+	logger.Info("sent transaction", logger.F("txid", txid))
 	return txid, nil
 }
 
@@ -210,14 +209,14 @@ func SendAlgoToSelf(walletName string, password string, fromAddr string, amount
 		return "", errors.Wrap(err, "error generating key")
 	}
 
-	log.Println("Generated to address: ", toAddr)
+	logger.Info("generated to address", logger.F("address", toAddr))
 
 	note := []byte("cool")
 	txid, err := sendTx(fromAddr, toAddr, amount, note, walletHandleToken, password)
 	if err != nil {
 		return "", errors.Wrap(err, "couldn't send tx")
 	}
-	log.Println("txid: ", txid)
+	logger.Info("sent transaction", logger.F("txid", txid))
 	return txid, nil
 }
 
@@ -231,7 +230,7 @@ func getWalletId(walletName string) (string, error) {
 	var ourWalletId string
 	for _, wallet := range listResponse.Wallets {
 		if wallet.Name == walletName {
-			log.Printf("found wallet '%s' with ID: %s\n", wallet.Name, wallet.ID)
+			logger.Debug("found wallet", logger.F("name", wallet.Name), logger.F("id", wallet.ID))
 			ourWalletId = wallet.ID
 		}
 	}
@@ -258,10 +257,22 @@ func SendAlgo(walletName string, password string, amount uint64, fromAddr string
 	if err != nil {
 		return "", errors.Wrap(err, "couldn't send tx")
 	}
-	log.Println("txid: ", txid)
+	logger.Info("sent transaction", logger.F("txid", txid))
 	return txid, nil
 }
 
+// SendAlgoAmount sends an exact amount of algos to another address from a source account
+func SendAlgoAmount(walletName string, password string, amount utils.BigAmount, fromAddr string, toAddr string) (string, error) {
+	microAlgos, err := amount.Rescale(AlgoDecimals)
+	if err != nil {
+		return "", errors.Wrap(err, "amount can't be sent in microAlgos")
+	}
+	if microAlgos.Units().Sign() < 0 || !microAlgos.Units().IsUint64() {
+		return "", utils.ErrOverflow
+	}
+	return SendAlgo(walletName, password, microAlgos.Units().Uint64(), fromAddr, toAddr)
+}
+
 // CreateNewWalletAndAddress creates a new wallet and an address
 func CreateNewWalletAndAddress(name string, password string) (string, error) {
 	var err error
@@ -1,5 +1,8 @@
 package algorand
 
+// AlgoDecimals is the number of decimal places of algo amounts, ie. amounts are sent in microAlgos
+const AlgoDecimals = 6
+
 var (
 	// AlgodAddress is the address of the algod daemon
 	AlgodAddress string
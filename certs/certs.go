@@ -9,10 +9,11 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"net"
 	"time"
+
+	"github.com/Varunram/essentials/logger"
 )
 
 // ref: https://ericchiang.github.io/post/go-tls/
@@ -23,7 +24,7 @@ func CertTemplate() (*x509.Certificate, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		log.Println("failed to generate serial number: ", err)
+		logger.Error("failed to generate serial number", logger.Err(err))
 		return nil, errors.New("failed to generate serial number: " + err.Error())
 	}
 
@@ -43,13 +44,13 @@ func createCert(template, parent *x509.Certificate, pub interface{}, parentPriv
 
 	certDER, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentPriv)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not create certificate", logger.Err(err))
 		return
 	}
 	// parse the resulting certificate so we can use it again
 	cert, err = x509.ParseCertificate(certDER)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not parse certificate", logger.Err(err))
 		return
 	}
 	// PEM encode the certificate (this is a standard TLS encoding)
@@ -66,13 +67,13 @@ func GenCert() (string, string, tls.Certificate, error) {
 
 	certTemplate, err := CertTemplate()
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not create certificate template", logger.Err(err))
 		return "", "", tlscert, err
 	}
 
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not generate key", logger.Err(err))
 		return "", "", tlscert, err
 	}
 
@@ -82,12 +83,10 @@ func GenCert() (string, string, tls.Certificate, error) {
 
 	cert, certpem, err := createCert(certTemplate, certTemplate, &key.PublicKey, key)
 	if err != nil {
-		log.Println(err)
 		return "", "", tlscert, err
 	}
 
-	log.Printf("%s\n", certpem)
-	log.Printf("%#x\n", cert.Signature)
+	logger.Debug("generated certificate", logger.F("cert", string(certpem)), logger.F("signature", fmt.Sprintf("%#x", cert.Signature)))
 
 	// PEM encode the private key
 	keypem = pem.EncodeToMemory(&pem.Block{
@@ -97,7 +96,7 @@ func GenCert() (string, string, tls.Certificate, error) {
 	// Create a TLS cert using the private key and certificate
 	tlscert, err = tls.X509KeyPair(certpem, keypem)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not create tls certificate", logger.Err(err))
 		return "", "", tlscert, err
 	}
 
@@ -1,9 +1,15 @@
 package cc20
 
 import (
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
 	"github.com/pkg/errors"
-	"log"
 
+	aead "github.com/Varunram/essentials/aead"
+	kdf "github.com/Varunram/essentials/kdf"
+	"github.com/Varunram/essentials/logger"
 	utils "github.com/Varunram/essentials/utils"
 	cc20 "golang.org/x/crypto/chacha20poly1305"
 )
@@ -12,40 +18,194 @@ import (
 // we implement XChaCha20 which is a variant of CC20 allowing random nonces to be safe
 // https://libsodium.gitbook.io/doc/advanced/stream_ciphers/xchacha20
 
-// Encrypt encrypts a given passphrase using CC20-poly1305
-func Encrypt(input []byte, passphrase string) ([]byte, error) {
-	sha3Hash := utils.SHA3hash(passphrase)
-	key := []byte(sha3Hash[0:32])
-	aead, err := cc20.NewX(key)
+// Ciphertexts are envelopes of the form version (1 byte) || kdf header || nonce (24 bytes) ||
+// sealed data, with everything before the nonce authenticated as additional data.
+// Ciphertexts written by older versions of this package had no header and used a nonce
+// derived from the passphrase, they can still be decrypted.
+
+// Version is the version byte of the ciphertext envelope written by Encrypt
+const Version byte = 2
+
+// ErrInvalidCiphertext is returned when the passed data is too short to be a valid envelope
+var ErrInvalidCiphertext = errors.New("ciphertext too short or malformed")
+
+// newAEAD returns an XChaCha20-Poly1305 instance for the given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	xchacha, err := cc20.NewX(key)
 	if err != nil {
-		log.Println("Failed to instantiate XChaCha20-Poly1305", err)
+		logger.Error("failed to instantiate XChaCha20-Poly1305", logger.Err(err))
 		return nil, errors.Wrap(err, "Failed to instantiate XChaCha20-Poly1305")
 	}
+	return xchacha, nil
+}
 
-	nonce := []byte(utils.SHA3hash(sha3Hash))[0:24]
+// Name is the name the cc20 cipher is registered under in the aead package
+const Name = "cc20"
+
+func init() {
+	aead.Register(Name, func(passphrase string, params kdf.Params) aead.Cipher {
+		return NewCipherWithParams(passphrase, params)
+	})
+}
+
+// Cipher implements aead.Cipher with XChaCha20-Poly1305
+type Cipher struct {
+	passphrase string
+	params     kdf.Params
+}
+
+// NewCipher returns a Cipher deriving keys from the passphrase with the default KDF params
+func NewCipher(passphrase string) *Cipher {
+	return NewCipherWithParams(passphrase, kdf.Default)
+}
+
+// NewCipherWithParams returns a Cipher deriving keys from the passphrase with the passed KDF params
+func NewCipherWithParams(passphrase string, params kdf.Params) *Cipher {
+	return &Cipher{passphrase: passphrase, params: params}
+}
+
+// Name returns the name of the cipher
+func (c *Cipher) Name() string {
+	return Name
+}
+
+// Seal encrypts the plaintext and authenticates it along with the additional data
+func (c *Cipher) Seal(plaintext, aad []byte) ([]byte, error) {
+	return seal(plaintext, c.passphrase, c.params, aad)
+}
+
+// Open decrypts a ciphertext sealed with the same passphrase and additional data
+func (c *Cipher) Open(ciphertext, aad []byte) ([]byte, error) {
+	plaintext, _, err := decrypt(ciphertext, c.passphrase, aad)
+	return plaintext, err
+}
+
+// OpenOutdated is Open, also returning whether the ciphertext was in the legacy format
+func (c *Cipher) OpenOutdated(ciphertext, aad []byte) ([]byte, bool, error) {
+	return decrypt(ciphertext, c.passphrase, aad)
+}
+
+// Encrypt encrypts a given passphrase using CC20-poly1305 and the default KDF params
+func Encrypt(input []byte, passphrase string) ([]byte, error) {
+	return seal(input, passphrase, kdf.Default, nil)
+}
+
+// EncryptWithParams encrypts a given passphrase using CC20-poly1305, deriving the key with
+// the passed KDF params
+func EncryptWithParams(input []byte, passphrase string, params kdf.Params) ([]byte, error) {
+	return seal(input, passphrase, params, nil)
+}
+
+// seal encrypts input into an envelope, authenticating the header and the additional data
+func seal(input []byte, passphrase string, params kdf.Params, aad []byte) ([]byte, error) {
+	salt, err := kdf.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	kdfHeader, err := params.Header(salt)
+	if err != nil {
+		logger.Error("invalid kdf params", logger.Err(err))
+		return nil, errors.Wrap(err, "invalid kdf params")
+	}
 
-	ciphertext := aead.Seal(nil, nonce, input, nil) // prepend nonce to the ciphertext
-	return ciphertext, nil
+	key, err := kdf.Key(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	xchacha, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, xchacha.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		logger.Error("could not generate random nonce", logger.Err(err))
+		return nil, errors.Wrap(err, "could not generate random nonce")
+	}
+
+	header := make([]byte, 0, 1+len(kdfHeader))
+	header = append(header, Version)
+	header = append(header, kdfHeader...)
+
+	ciphertext := make([]byte, 0, len(header)+len(nonce)+len(input)+xchacha.Overhead())
+	ciphertext = append(ciphertext, header...)
+	ciphertext = append(ciphertext, nonce...)
+	return xchacha.Seal(ciphertext, nonce, input, aead.AdditionalData(header, aad)), nil
 }
 
 // Decrypt decrypts a given cipher with the passed passphrase
 func Decrypt(input []byte, passphrase string) ([]byte, error) {
-	sha3Hash := utils.SHA3hash(passphrase)
-	key := []byte(sha3Hash[0:32])
+	plaintext, _, err := decrypt(input, passphrase, nil)
+	return plaintext, err
+}
+
+// decrypt opens an envelope, falling back to the legacy format if the input isn't one.
+// The returned bool is true if the input was in the legacy format
+func decrypt(input []byte, passphrase string, aad []byte) ([]byte, bool, error) {
+	plaintext, err := openEnvelope(input, passphrase, aad)
+	if err == nil {
+		return plaintext, false, nil
+	}
+
+	// the first byte of a legacy ciphertext may match the version byte, so try both. Legacy
+	// ciphertexts can't be bound to additional data, so don't accept them if some was passed
+	if len(aad) != 0 {
+		logger.Error("failed to decrypt or authenticate message", logger.Err(err))
+		return nil, false, errors.Wrap(err, "failed to decrypt or authenticate  message")
+	}
+	plaintext, lerr := decryptLegacy(input, passphrase)
+	if lerr != nil {
+		logger.Error("failed to decrypt or authenticate message", logger.Err(err))
+		return nil, false, errors.Wrap(err, "failed to decrypt or authenticate  message")
+	}
+
+	return plaintext, true, nil
+}
+
+// openEnvelope opens a ciphertext written by seal
+func openEnvelope(input []byte, passphrase string, aad []byte) ([]byte, error) {
+	if len(input) == 0 || input[0] != Version {
+		return nil, ErrInvalidCiphertext
+	}
 
-	aead, err := cc20.NewX(key)
+	params, salt, n, err := kdf.ParseHeader(input[1:])
 	if err != nil {
-		log.Println("Failed to instantiate XChaCha20-Poly1305", err)
-		return nil, errors.Wrap(err, "Failed to instantiate XChaCha20-Poly1305")
+		return nil, err
 	}
 
-	nonce := []byte(utils.SHA3hash(sha3Hash))[0:24]
+	headerLen := 1 + n
+	if len(input) < headerLen+cc20.NonceSizeX+cc20.Overhead {
+		return nil, ErrInvalidCiphertext
+	}
+
+	key, err := kdf.Key(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
 
-	plaintext, err := aead.Open(nil, nonce, input, nil)
+	xchacha, err := newAEAD(key)
 	if err != nil {
-		log.Println("failed to decrypt or authenticate message: ", err)
-		return nil, errors.Wrap(err, "failed to decrypt or authenticate  message")
+		return nil, err
 	}
 
-	return plaintext, nil
+	header := input[:headerLen]
+	nonce := input[headerLen : headerLen+xchacha.NonceSize()]
+	return xchacha.Open(nil, nonce, input[headerLen+xchacha.NonceSize():], aead.AdditionalData(header, aad))
+}
+
+// decryptLegacy decrypts data written before ciphertexts carried a header. These used
+// a key and nonce derived deterministically from the passphrase
+func decryptLegacy(input []byte, passphrase string) ([]byte, error) {
+	sha3Hash := utils.SHA3hash(passphrase)
+	key := []byte(sha3Hash[0:32])
+
+	xchacha, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := []byte(utils.SHA3hash(sha3Hash))[0:24]
+	return xchacha.Open(nil, nonce, input, nil)
 }
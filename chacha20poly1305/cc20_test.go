@@ -1,8 +1,14 @@
 package cc20
 
 import (
+	"bytes"
+	"crypto/rand"
 	"log"
 	"testing"
+
+	aead "github.com/Varunram/essentials/aead"
+	kdf "github.com/Varunram/essentials/kdf"
+	utils "github.com/Varunram/essentials/utils"
 )
 
 func TestCC20(t *testing.T) {
@@ -17,4 +23,73 @@ func TestCC20(t *testing.T) {
 		t.Fatal(err)
 	}
 	log.Printf("Decrypted: %s\n", plaintext)
+	if string(plaintext) != "Hello World" {
+		t.Fatalf("Problem with Decryption")
+	}
+	_, err = Decrypt(ciphertext, "Notcool")
+	if err == nil {
+		t.Fatalf("Didn't catch error during decrpytion, exiting!")
+	}
+
+	ciphertext, err = EncryptWithParams([]byte("Hello World"), password, kdf.ScryptModerate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err = Decrypt(ciphertext, password)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("could not decrypt scrypt ciphertext")
+	}
+
+	// ciphertexts written before the envelope was introduced must still decrypt
+	sha3Hash := utils.SHA3hash(password)
+	legacyAEAD, _ := newAEAD([]byte(sha3Hash[0:32]))
+	legacy := legacyAEAD.Seal(nil, []byte(utils.SHA3hash(sha3Hash))[0:24], []byte("Hello World"), nil)
+	plaintext, err = Decrypt(legacy, password)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("could not decrypt legacy ciphertext")
+	}
+}
+
+func TestStream(t *testing.T) {
+	password := "Cool"
+	data := make([]byte, 2*aead.ChunkSize+1)
+	rand.Read(data)
+
+	var sealed bytes.Buffer
+	err := EncryptStream(&sealed, bytes.NewReader(data), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opened bytes.Buffer
+	err = DecryptStream(&opened, bytes.NewReader(sealed.Bytes()), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened.Bytes(), data) {
+		t.Fatalf("stream doesn't round trip")
+	}
+	truncated := sealed.Bytes()[:sealed.Len()-1]
+	err = DecryptStream(&opened, bytes.NewReader(truncated), password)
+	if err == nil {
+		t.Fatalf("truncated stream not detected")
+	}
+}
+
+func TestCipher(t *testing.T) {
+	c, err := aead.New(Name, "Cool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := c.Seal([]byte("Hello World"), []byte("record 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := c.Open(ciphertext, []byte("record 1"))
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Fatalf("could not open ciphertext with additional data")
+	}
+	_, err = c.Open(ciphertext, []byte("record 2"))
+	if err == nil {
+		t.Fatalf("mismatching additional data not detected")
+	}
 }
@@ -0,0 +1,45 @@
+package cc20
+
+import (
+	"io"
+
+	aead "github.com/Varunram/essentials/aead"
+	kdf "github.com/Varunram/essentials/kdf"
+)
+
+// Streams are used for data that is too large to be held in memory, like documents that are
+// pushed to ipfs. See aead.NewEncryptWriter for the format
+
+// StreamVersion is the version byte of the header written by NewEncryptWriter
+const StreamVersion byte = 1
+
+var stream = aead.Stream{Version: StreamVersion, NewAEAD: newAEAD}
+
+// NewEncryptWriter writes the stream header to w and returns a writer that encrypts everything
+// written to it with the given passphrase. Close must be called to finish the stream
+func NewEncryptWriter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	return stream.NewEncryptWriter(w, passphrase, kdf.Default)
+}
+
+// NewEncryptWriterWithParams is NewEncryptWriter deriving the key with the passed KDF params
+func NewEncryptWriterWithParams(w io.Writer, passphrase string, params kdf.Params) (io.WriteCloser, error) {
+	return stream.NewEncryptWriter(w, passphrase, params)
+}
+
+// NewDecryptReader reads the stream header from r and returns a reader that decrypts the
+// stream with the given passphrase. The stream is only known to be complete once the
+// returned reader returns io.EOF
+func NewDecryptReader(r io.Reader, passphrase string) (io.Reader, error) {
+	return stream.NewDecryptReader(r, passphrase)
+}
+
+// EncryptStream encrypts everything read from src with the given passphrase and writes it to dst
+func EncryptStream(dst io.Writer, src io.Reader, passphrase string) error {
+	return stream.Encrypt(dst, src, passphrase, kdf.Default)
+}
+
+// DecryptStream decrypts a stream written by EncryptStream from src and writes it to dst.
+// Data is written to dst as chunks are authenticated, so dst must be discarded on error
+func DecryptStream(dst io.Writer, src io.Reader, passphrase string) error {
+	return stream.Decrypt(dst, src, passphrase)
+}
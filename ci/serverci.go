@@ -4,7 +4,6 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"os/exec"
@@ -14,6 +13,7 @@ import (
 	// / "strings"
 	"time"
 
+	"github.com/Varunram/essentials/logger"
 	erpc "github.com/Varunram/essentials/rpc"
 	utils "github.com/Varunram/essentials/utils"
 	btcutils "github.com/bithyve/research/utils"
@@ -41,197 +41,30 @@ type FileStats struct {
 	Sizes  []int64
 }
 
-func openx() {
-	http.HandleFunc("/openx-darwinamd64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "openx-darwinamd64.gz")
-	})
-	http.HandleFunc("/openx-linuxamd64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "openx-linuxamd64.gz")
-	})
-	http.HandleFunc("/openx-linux386", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "openx-linux386.gz")
-	})
-	http.HandleFunc("/openx-arm64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "openx-arm64.gz")
-	})
-	http.HandleFunc("/openx-arm", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "openx-arm.gz")
-	})
-	http.HandleFunc("/openx", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
+// binaries are the builds served by the ci, each available as a gzipped file
+var binaries = []string{"openx", "opensolar", "teller"}
 
-		http.ServeFile(w, r, "openx.gz")
-	})
-}
+var platforms = []string{"-darwinamd64", "-linuxamd64", "-linux386", "-arm64", "-arm", ""}
 
-func opensolar() {
-	http.HandleFunc("/opensolar-darwinamd64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
+func binaryRoutes(s *erpc.Server) {
+	for _, binary := range binaries {
+		for _, platform := range platforms {
+			file := binary + platform + ".gz"
+			s.Get("/"+binary+platform, func(w http.ResponseWriter, r *http.Request) {
+				http.ServeFile(w, r, file)
+			})
 		}
-
-		http.ServeFile(w, r, "opensolar-darwinamd64.gz")
-	})
-	http.HandleFunc("/opensolar-linuxamd64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "opensolar-linuxamd64.gz")
-	})
-	http.HandleFunc("/opensolar-linux386", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "opensolar-linux386.gz")
-	})
-	http.HandleFunc("/opensolar-arm64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "opensolar-arm64.gz")
-	})
-	http.HandleFunc("/opensolar-arm", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "opensolar-arm.gz")
-	})
-	http.HandleFunc("/opensolar", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "opensolar.gz")
-	})
-}
-
-func teller() {
-	http.HandleFunc("/teller-darwinamd64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "teller-darwinamd64.gz")
-	})
-	http.HandleFunc("/teller-linuxamd64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "teller-linuxamd64.gz")
-	})
-	http.HandleFunc("/teller-linux386", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "teller-linux386.gz")
-	})
-	http.HandleFunc("/teller-arm64", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "teller-arm64.gz")
-	})
-	http.HandleFunc("/teller-arm", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "teller-arm.gz")
-	})
-	http.HandleFunc("/teller", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
-		http.ServeFile(w, r, "teller.gz")
-	})
+	}
 }
 
-func lastbuilt() {
-	http.HandleFunc("/lastbuilt", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
+func lastbuilt(s *erpc.Server) {
+	s.Get("/lastbuilt", func(w http.ResponseWriter, r *http.Request) {
 		erpc.MarshalSend(w, LastBuilt)
 	})
 }
 
-func shaEndpoint() {
-	http.HandleFunc("/sha", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
+func shaEndpoint(s *erpc.Server) {
+	s.Get("/sha", func(w http.ResponseWriter, r *http.Request) {
 		erpc.MarshalSend(w, Sha)
 	})
 }
@@ -243,14 +76,8 @@ type HashesResponse struct {
 	Teller    FileStats
 }
 
-func hashesEndpoint() {
-	http.HandleFunc("/hashes", func(w http.ResponseWriter, r *http.Request) {
-		err := erpc.CheckGet(w, r)
-		if err != nil {
-			log.Println(err)
-			erpc.ResponseHandler(w, erpc.StatusNotFound)
-		}
-
+func hashesEndpoint(s *erpc.Server) {
+	s.Get("/hashes", func(w http.ResponseWriter, r *http.Request) {
 		var x HashesResponse
 		x.Openx = OpenxHashes
 		x.Opensolar = OpensolarHashes
@@ -260,33 +87,35 @@ func hashesEndpoint() {
 	})
 }
 
-func frontend() {
-	http.Handle("/fe/", http.StripPrefix("/fe/", http.FileServer(http.Dir("./static"))))
+func frontend(s *erpc.Server) {
+	s.Handle(http.MethodGet, "/fe/*file", http.StripPrefix("/fe/", http.FileServer(http.Dir("./static"))))
 }
 
 // StartServer starts the CI server
 func StartServer(portx int, insecure bool) {
-	erpc.SetupBasicHandlers()
-	openx()
-	opensolar()
-	teller()
-	frontend()
-	lastbuilt()
-	shaEndpoint()
-	hashesEndpoint()
+	s := erpc.NewServer(erpc.RequestID, erpc.Logging, erpc.Recovery, erpc.CORS(erpc.DefaultCORS))
+	s.HandlePing()
+	binaryRoutes(s)
+	frontend(s)
+	lastbuilt(s)
+	shaEndpoint(s)
+	hashesEndpoint(s)
 
 	port, err := utils.ToString(portx)
 	if err != nil {
-		log.Fatal("Port not string")
+		logger.Error("port not string", logger.Err(err))
+		os.Exit(1)
 	}
 
-	log.Println("Starting RPC Server on Port: ", port)
+	logger.Info("starting RPC server", logger.F("port", port))
 	if insecure {
-		log.Println("starting server in insecure mode")
-		log.Fatal(http.ListenAndServe(":"+port, nil))
+		logger.Warn("starting server in insecure mode")
+		err = s.ListenAndServe(":" + port)
 	} else {
-		log.Fatal(http.ListenAndServeTLS(":"+port, "certs/server.crt", "certs/server.key", nil))
+		err = s.ListenAndServeTLS(":"+port, "certs/server.crt", "certs/server.key")
 	}
+	logger.Error("server stopped", logger.Err(err))
+	os.Exit(1)
 }
 
 var opts struct {
@@ -299,7 +128,7 @@ func writeLastBuilt() {
 	err := ioutil.WriteFile("lastbuilt.txt", []byte(data), 0644)
 	if err != nil {
 		// don't return error
-		log.Println(err)
+		logger.Error("could not write lastbuilt.txt", logger.Err(err))
 	}
 }
 
@@ -307,7 +136,7 @@ func readLastBuilt() {
 	data, err := ioutil.ReadFile("lastbuilt.txt")
 	if err != nil {
 		// don't return error
-		log.Println(err)
+		logger.Error("could not read lastbuilt.txt", logger.Err(err))
 	}
 	LastBuilt = string(data)
 }
@@ -316,7 +145,7 @@ func readGhSecret() {
 	data, err := ioutil.ReadFile("secret.txt")
 	if err != nil {
 		// don't return error
-		log.Println(err)
+		logger.Error("could not read secret.txt", logger.Err(err))
 	}
 	GithubSecret = string(data)[0:40] // splice off the \n at the end
 }
@@ -365,12 +194,12 @@ func updateShastruct() {
 
 	data, err := GetRequest("https://api.github.com/repos/YaleOpenLab/openx/commits/master")
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not get latest commit", logger.Err(err))
 		return
 	}
 	err = json.Unmarshal(data, &gh)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not unmarshal latest commit", logger.Err(err))
 		return
 	}
 
@@ -378,16 +207,16 @@ func updateShastruct() {
 
 	data, err = GetRequest("https://api.github.com/repos/YaleOpenLab/opensolar/commits/master")
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not get latest commit", logger.Err(err))
 		return
 	}
 	err = json.Unmarshal(data, &gh)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not unmarshal latest commit", logger.Err(err))
 		return
 	}
 	Sha.OpensolarSha = string(gh.Sha)
-	log.Println(Sha)
+	logger.Info("updated sha hashes", logger.F("openx", Sha.OpenxSha), logger.F("opensolar", Sha.OpensolarSha))
 }
 
 func updateShaHashes() {
@@ -398,14 +227,14 @@ func updateShaHashes() {
 	for _, file := range openxFileNames {
 		sha2Bytes, err := btcutils.Sha256File(file)
 		if err != nil {
-			log.Println(err)
+			logger.Error("could not hash file", logger.F("file", file), logger.Err(err))
 			continue
 		}
 
 		OpenxHashes.Hashes = append(OpenxHashes.Hashes, hex.EncodeToString(sha2Bytes))
 		x, err := os.Stat(file)
 		if err != nil {
-			log.Println(err)
+			logger.Error("could not stat file", logger.F("file", file), logger.Err(err))
 			continue
 		}
 		OpenxHashes.Sizes = append(OpenxHashes.Sizes, x.Size()/1000000)
@@ -414,14 +243,14 @@ func updateShaHashes() {
 	for _, file := range opensolarFileNames {
 		sha2Bytes, err := btcutils.Sha256File(file)
 		if err != nil {
-			log.Println(err)
+			logger.Error("could not hash file", logger.F("file", file), logger.Err(err))
 			continue
 		}
 
 		OpensolarHashes.Hashes = append(OpensolarHashes.Hashes, hex.EncodeToString(sha2Bytes))
 		x, err := os.Stat(file)
 		if err != nil {
-			log.Println(err)
+			logger.Error("could not stat file", logger.F("file", file), logger.Err(err))
 			continue
 		}
 		OpensolarHashes.Sizes = append(OpensolarHashes.Sizes, x.Size()/1000000)
@@ -430,14 +259,14 @@ func updateShaHashes() {
 	for _, file := range tellerFileNames {
 		sha2Bytes, err := btcutils.Sha256File(file)
 		if err != nil {
-			log.Println(err)
+			logger.Error("could not hash file", logger.F("file", file), logger.Err(err))
 			continue
 		}
 
 		TellerHashes.Hashes = append(TellerHashes.Hashes, hex.EncodeToString(sha2Bytes))
 		x, err := os.Stat(file)
 		if err != nil {
-			log.Println(err)
+			logger.Error("could not stat file", logger.F("file", file), logger.Err(err))
 			continue
 		}
 		TellerHashes.Sizes = append(TellerHashes.Sizes, x.Size()/1000000)
@@ -447,7 +276,8 @@ func updateShaHashes() {
 func main() {
 	_, err := flags.ParseArgs(&opts, os.Args)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("could not parse flags", logger.Err(err))
+		os.Exit(1)
 	}
 
 	// updateShaHashes()
@@ -460,13 +290,13 @@ func main() {
 	go func() {
 		for {
 			time.Sleep(24 * time.Hour)
-			log.Println("triggering build script")
+			logger.Info("triggering build script")
 			_, err := exec.Command("./build.sh").Output()
 			if err != nil {
-				log.Println(err)
+				logger.Error("build failed", logger.Err(err))
 				continue
 			}
-			log.Println("build built succesfully")
+			logger.Info("build built succesfully")
 			writeLastBuilt()
 			readLastBuilt()
 			updateShaHashes()
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/database"
+	"github.com/Varunram/essentials/logger"
+	flags "github.com/jessevdk/go-flags"
+)
+
+var opts struct {
+	DB string `short:"d" long:"db" description:"Path to the database file" required:"true"`
+
+	Buckets BucketsCommand `command:"buckets" description:"List the buckets and their number of keys"`
+	Count   CountCommand   `command:"count" description:"Count the keys of a bucket"`
+	Dump    DumpCommand    `command:"dump" description:"Print every record of a bucket"`
+	Get     GetCommand     `command:"get" description:"Print the value of a key"`
+	Put     PutCommand     `command:"put" description:"Store a JSON value under a key"`
+	Delete  DeleteCommand  `command:"delete" description:"Delete a key"`
+	Export  ExportCommand  `command:"export" description:"Write the records of a bucket as JSON lines"`
+	Import  ImportCommand  `command:"import" description:"Read records written by export into a bucket"`
+	Migrate MigrateCommand `command:"migrate" description:"Migrate a database written by an older version"`
+}
+
+// Line is a record in the JSON lines format of export and import
+type Line struct {
+	Key   int             `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// BucketArg is the positional argument of commands working on a bucket
+type BucketArg struct {
+	Bucket string `positional-arg-name:"bucket"`
+}
+
+// KeyArgs are the positional arguments of commands working on a key
+type KeyArgs struct {
+	Bucket string `positional-arg-name:"bucket"`
+	Key    int    `positional-arg-name:"key"`
+}
+
+// BucketsCommand lists the buckets of the database
+type BucketsCommand struct {
+	All bool `short:"a" long:"all" description:"Include the buckets the database package keeps for itself"`
+}
+
+// CountCommand counts the keys of a bucket
+type CountCommand struct {
+	Args BucketArg `positional-args:"yes" required:"yes"`
+}
+
+// DumpCommand prints the records of a bucket
+type DumpCommand struct {
+	Pretty bool      `short:"p" long:"pretty" description:"Indent JSON values"`
+	Args   BucketArg `positional-args:"yes" required:"yes"`
+}
+
+// GetCommand prints the value of a key
+type GetCommand struct {
+	Pretty bool    `short:"p" long:"pretty" description:"Indent JSON values"`
+	Args   KeyArgs `positional-args:"yes" required:"yes"`
+}
+
+// PutCommand stores a JSON value under a key
+type PutCommand struct {
+	Args struct {
+		Bucket string `positional-arg-name:"bucket"`
+		Key    int    `positional-arg-name:"key"`
+		Value  string `positional-arg-name:"value"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// DeleteCommand deletes a key
+type DeleteCommand struct {
+	Args KeyArgs `positional-args:"yes" required:"yes"`
+}
+
+// ExportCommand writes the records of a bucket as JSON lines
+type ExportCommand struct {
+	Output string    `short:"o" long:"output" description:"File to write to instead of stdout"`
+	Args   BucketArg `positional-args:"yes" required:"yes"`
+}
+
+// ImportCommand reads JSON lines written by export into a bucket
+type ImportCommand struct {
+	Input string    `short:"i" long:"input" description:"File to read from instead of stdin"`
+	Args  BucketArg `positional-args:"yes" required:"yes"`
+}
+
+// MigrateCommand migrates the keys of a database written by an older version
+type MigrateCommand struct{}
+
+// open opens the database passed with --db. It isn't created if it doesn't exist. Read only
+// databases aren't migrated and can be opened while another process reads them
+func open(readOnly bool) (*database.Store, error) {
+	if _, err := os.Stat(opts.DB); err != nil {
+		return nil, errors.Wrap(err, "could not find database")
+	}
+	if !readOnly {
+		return database.Open(opts.DB)
+	}
+	s, err := database.OpenReadOnly(opts.DB)
+	if errors.Cause(err) == database.ErrNotMigrated {
+		return nil, errors.New("database needs migration, run the migrate command first")
+	}
+	return s, err
+}
+
+// withStore opens the database, runs fn and closes the database
+func withStore(readOnly bool, fn func(s *database.Store) error) error {
+	s, err := open(readOnly)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return fn(s)
+}
+
+// formatKey prints keys encoded with EncodeKey as integers and other keys quoted
+func formatKey(k []byte) string {
+	if key, err := database.DecodeKey(k); err == nil {
+		return strconv.Itoa(key)
+	}
+	return strconv.Quote(string(k))
+}
+
+// formatValue indents JSON values if pretty is set
+func formatValue(x []byte, pretty bool) string {
+	if !pretty {
+		return string(x)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, x, "", "  "); err != nil {
+		// not JSON, print it as is
+		return string(x)
+	}
+	return out.String()
+}
+
+// Execute lists the buckets
+func (c *BucketsCommand) Execute(args []string) error {
+	return withStore(true, func(s *database.Store) error {
+		return s.View(func(tx *database.Tx) error {
+			return tx.Backend().ForEachBucket(func(name []byte) error {
+				if !c.All && database.ReservedBucket(name) {
+					return nil
+				}
+				n, err := tx.Count(name)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%q\t%d\n", name, n)
+				return nil
+			})
+		})
+	})
+}
+
+// Execute counts the keys of a bucket
+func (c *CountCommand) Execute(args []string) error {
+	return withStore(true, func(s *database.Store) error {
+		n, err := s.RetrieveAllKeysLim([]byte(c.Args.Bucket))
+		if err != nil {
+			return err
+		}
+		fmt.Println(n)
+		return nil
+	})
+}
+
+// Execute prints the records of a bucket
+func (c *DumpCommand) Execute(args []string) error {
+	return withStore(true, func(s *database.Store) error {
+		records, _, err := s.Find([]byte(c.Args.Bucket), database.Query{})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			fmt.Printf("%s\t%s\n", formatKey(record.Key), formatValue(record.Value, c.Pretty))
+		}
+		return nil
+	})
+}
+
+// Execute prints the value of a key
+func (c *GetCommand) Execute(args []string) error {
+	return withStore(true, func(s *database.Store) error {
+		x, err := s.Retrieve([]byte(c.Args.Bucket), c.Args.Key)
+		if err != nil {
+			return err
+		}
+		fmt.Println(formatValue(x, c.Pretty))
+		return nil
+	})
+}
+
+// Execute stores a JSON value under a key
+func (c *PutCommand) Execute(args []string) error {
+	value := []byte(c.Args.Value)
+	if !json.Valid(value) {
+		return errors.New("value isn't valid JSON")
+	}
+	return withStore(false, func(s *database.Store) error {
+		return s.Save([]byte(c.Args.Bucket), json.RawMessage(value), c.Args.Key)
+	})
+}
+
+// Execute deletes a key
+func (c *DeleteCommand) Execute(args []string) error {
+	return withStore(false, func(s *database.Store) error {
+		return s.DeleteKeyFromBucket(c.Args.Key, []byte(c.Args.Bucket))
+	})
+}
+
+// Execute writes the records of a bucket as JSON lines
+func (c *ExportCommand) Execute(args []string) error {
+	return withStore(true, func(s *database.Store) error {
+		records, _, err := s.Find([]byte(c.Args.Bucket), database.Query{})
+		if err != nil {
+			return err
+		}
+
+		// the output is only created once the records have been read, so a failure doesn't
+		// truncate an earlier export
+		var w io.Writer = os.Stdout
+		if c.Output != "" {
+			f, err := os.Create(c.Output)
+			if err != nil {
+				return errors.Wrap(err, "could not create output file")
+			}
+			defer f.Close()
+			w = f
+		}
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		for _, record := range records {
+			key, err := record.ID()
+			if err != nil {
+				return errors.Wrap(err, "bucket doesn't use integer keys")
+			}
+			if !json.Valid(record.Value) {
+				return errors.Errorf("value of key %d isn't valid JSON", key)
+			}
+			if err := enc.Encode(Line{Key: key, Value: record.Value}); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	})
+}
+
+// Execute reads JSON lines into a bucket in a single transaction
+func (c *ImportCommand) Execute(args []string) error {
+	var r io.Reader = os.Stdin
+	if c.Input != "" {
+		f, err := os.Open(c.Input)
+		if err != nil {
+			return errors.Wrap(err, "could not open input file")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return withStore(false, func(s *database.Store) error {
+		n := 0
+		err := s.Update(func(tx *database.Tx) error {
+			dec := json.NewDecoder(r)
+			for {
+				var line Line
+				err := dec.Decode(&line)
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return errors.Wrapf(err, "could not decode record %d", n+1)
+				}
+				if err := tx.Save([]byte(c.Args.Bucket), line.Value, line.Key); err != nil {
+					return err
+				}
+				n++
+			}
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("imported %d records\n", n)
+		return nil
+	})
+}
+
+// Execute migrates the database, opening it for writing migrates it
+func (c *MigrateCommand) Execute(args []string) error {
+	return withStore(false, func(s *database.Store) error {
+		return nil
+	})
+}
+
+func main() {
+	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
+	if _, err := parser.Parse(); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			fmt.Println(err)
+			return
+		}
+		logger.Error("essentials-db failed", logger.Err(err))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+// +build all travis
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/Varunram/essentials/database"
+)
+
+func TestExportImport(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	users := []byte("users")
+	s, err := database.Open("test_files/app.db", users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"alice", "bob", "carol"} {
+		if err := s.Save(users, map[string]string{"Name": name}, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.DB = "test_files/app.db"
+	export := &ExportCommand{Output: "test_files/users.jsonl", Args: BucketArg{Bucket: "users"}}
+	if err := export.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := ioutil.ReadFile("test_files/users.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failing export leaves the previous output alone
+	opts.DB = "test_files/missing.db"
+	if err := export.Execute(nil); err == nil {
+		t.Fatal("export of a missing database succeeded")
+	}
+	x, err := ioutil.ReadFile("test_files/users.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(x) != string(exported) {
+		t.Fatalf("output changed by failing export: %q", x)
+	}
+
+	s, err = database.Open("test_files/copy.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	opts.DB = "test_files/copy.db"
+	imp := &ImportCommand{Input: "test_files/users.jsonl", Args: BucketArg{Bucket: "users"}}
+	if err := imp.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range []string{"alice", "bob", "carol"} {
+		x, err := database.Retrieve("test_files/copy.db", users, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(x) != `{"Name":"`+name+`"}` {
+			t.Fatalf("unexpected record %d: %s", i+1, x)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	// a bucket with decimal keys as written by older versions
+	db, err := bolt.Open("test_files/legacy.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("1"), []byte(`{"Name":"alice"}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	opts.DB = "test_files/legacy.db"
+	get := &GetCommand{Args: KeyArgs{Bucket: "users", Key: 1}}
+	err = get.Execute(nil)
+	if err == nil || !strings.Contains(err.Error(), "migrate") {
+		t.Fatalf("expected a migration error, got %v", err)
+	}
+	if err := (&MigrateCommand{}).Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := get.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"io"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// Backend is the storage a Store keeps its buckets in. Bolt is used by default, the in-memory
+// backend returned by NewMemoryBackend can be used in tests
+type Backend interface {
+	// Update runs fn in a read-write transaction, committing it if fn returns nil
+	Update(fn func(tx BackendTx) error) error
+	// View runs fn in a read-only transaction
+	View(fn func(tx BackendTx) error) error
+	// Close closes the backend
+	Close() error
+}
+
+// BackendTx is a transaction of a Backend
+type BackendTx interface {
+	// Bucket returns the bucket with the given name, or nil if it doesn't exist
+	Bucket(name []byte) Bucket
+	// CreateBucketIfNotExists creates a bucket if it doesn't exist and returns it
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	// DeleteBucket deletes a bucket and everything in it
+	DeleteBucket(name []byte) error
+	// ForEachBucket calls fn with the name of every bucket
+	ForEachBucket(fn func(name []byte) error) error
+	// Writable returns whether the transaction can write
+	Writable() bool
+}
+
+// Bucket is a sorted key value store inside a BackendTx. Slices returned by a Bucket are only
+// valid during the transaction
+type Bucket interface {
+	Get(key []byte) []byte
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	// Cursor returns a cursor iterating the keys in byte order
+	Cursor() Cursor
+	// Sequence returns the current value of the sequence of the bucket
+	Sequence() uint64
+	// SetSequence sets the sequence of the bucket
+	SetSequence(v uint64) error
+	// NextSequence increments the sequence of the bucket and returns it
+	NextSequence() (uint64, error)
+	// KeyN returns the number of keys in the bucket
+	KeyN() int
+}
+
+// Cursor iterates the keys of a Bucket. The methods return nil keys once there are no more
+type Cursor interface {
+	First() ([]byte, []byte)
+	Last() ([]byte, []byte)
+	Next() ([]byte, []byte)
+	Prev() ([]byte, []byte)
+	// Seek moves to the first key greater than or equal to seek
+	Seek(seek []byte) ([]byte, []byte)
+}
+
+// Opener opens the Backend of the database at path
+type Opener func(path string) (Backend, error)
+
+// OpenBackend is the Opener used by Open and the functions taking a path
+var OpenBackend Opener = OpenBolt
+
+// SetBackend sets the Opener used by Open and the functions taking a path, eg. OpenMemory
+func SetBackend(open Opener) {
+	OpenBackend = open
+}
+
+// ErrNotSupported is returned when an operation isn't supported by the Backend of a Store
+var ErrNotSupported = errors.New("operation not supported by backend")
+
+// BoltBackend is a Backend storing buckets in a bolt database
+type BoltBackend struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the bolt database at path as a Backend
+func OpenBolt(path string) (Backend, error) {
+	db, err := OpenDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewBoltBackend(db), nil
+}
+
+// NewBoltBackend returns a Backend using an open bolt database
+func NewBoltBackend(db *bolt.DB) *BoltBackend {
+	return &BoltBackend{db: db}
+}
+
+// DB returns the underlying bolt database
+func (b *BoltBackend) DB() *bolt.DB {
+	return b.db
+}
+
+// Update runs fn in a read-write bolt transaction
+func (b *BoltBackend) Update(fn func(tx BackendTx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// View runs fn in a read-only bolt transaction
+func (b *BoltBackend) View(fn func(tx BackendTx) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Close closes the bolt database
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
+
+// WriteTo writes a consistent copy of the database file to w without blocking writers
+func (b *BoltBackend) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) Bucket {
+	// a nil *bolt.Bucket must not become a non nil Bucket
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b}
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return t.tx.DeleteBucket(name)
+}
+
+func (t boltTx) ForEachBucket(fn func(name []byte) error) error {
+	return t.tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		return fn(name)
+	})
+}
+
+func (t boltTx) Writable() bool {
+	return t.tx.Writable()
+}
+
+type boltBucket struct {
+	*bolt.Bucket
+}
+
+func (b boltBucket) Cursor() Cursor {
+	return b.Bucket.Cursor()
+}
+
+func (b boltBucket) KeyN() int {
+	return b.Stats().KeyN
+}
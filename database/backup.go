@@ -0,0 +1,304 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	aead "github.com/Varunram/essentials/aead"
+	aes "github.com/Varunram/essentials/aes"
+	cc20 "github.com/Varunram/essentials/chacha20poly1305"
+	"github.com/Varunram/essentials/logger"
+)
+
+// Backups are written as a header followed by a bolt database file, which can be gzip
+// compressed and then encrypted with an aes or cc20 stream. The header is
+// magic (4 bytes) || version (1 byte) || flags (1 byte) || len(cipher name) (1 byte) || cipher name
+
+// BackupVersion is the version byte of the backup header
+const BackupVersion byte = 1
+
+const (
+	flagCompressed byte = 1 << iota
+	flagEncrypted
+)
+
+var backupMagic = []byte("EDBK")
+
+// ErrInvalidBackup is returned when restoring data that isn't a valid backup
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// ErrStoreOpen is returned when restoring over a database that is open in this or another
+// process
+var ErrStoreOpen = errors.New("database is open, close it before restoring")
+
+// BackupOptions configure how a backup is written
+type BackupOptions struct {
+	// Compress gzip compresses the backup
+	Compress bool
+	// Passphrase encrypts the backup if set
+	Passphrase string
+	// Cipher is the cipher used for encryption, aes.Name (the default) or cc20.Name
+	Cipher string
+}
+
+// encryptWriter returns a writer encrypting with the named cipher
+func encryptWriter(w io.Writer, cipher string, passphrase string) (io.WriteCloser, error) {
+	switch cipher {
+	case aes.Name:
+		return aes.NewEncryptWriter(w, passphrase)
+	case cc20.Name:
+		return cc20.NewEncryptWriter(w, passphrase)
+	}
+	return nil, errors.New("unsupported backup cipher " + cipher)
+}
+
+// decryptReader returns a reader decrypting with the named cipher
+func decryptReader(r io.Reader, cipher string, passphrase string) (io.Reader, error) {
+	switch cipher {
+	case aes.Name:
+		return aes.NewDecryptReader(r, passphrase)
+	case cc20.Name:
+		return cc20.NewDecryptReader(r, passphrase)
+	}
+	return nil, errors.New("unsupported backup cipher " + cipher)
+}
+
+// Backup writes a consistent copy of the database to w without blocking writers, and
+// returns the size of the uncompressed and unencrypted copy
+func (s *Store) Backup(w io.Writer, opts BackupOptions) (int64, error) {
+	wt, ok := s.backend.(io.WriterTo)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+
+	var flags byte
+	if opts.Compress {
+		flags |= flagCompressed
+	}
+	if opts.Passphrase != "" {
+		flags |= flagEncrypted
+		if opts.Cipher == "" {
+			opts.Cipher = aes.Name
+		}
+	} else {
+		opts.Cipher = ""
+	}
+
+	header := append([]byte{}, backupMagic...)
+	header = append(header, BackupVersion, flags, byte(len(opts.Cipher)))
+	header = append(header, opts.Cipher...)
+	if _, err := w.Write(header); err != nil {
+		logger.Error("could not write backup header", logger.Err(err))
+		return 0, errors.Wrap(err, "could not write backup header")
+	}
+
+	// writers are closed in reverse order once the database has been written
+	var closers []io.Closer
+	if opts.Passphrase != "" {
+		ew, err := encryptWriter(w, opts.Cipher, opts.Passphrase)
+		if err != nil {
+			return 0, err
+		}
+		closers = append(closers, ew)
+		w = ew
+	}
+	if opts.Compress {
+		gw := gzip.NewWriter(w)
+		closers = append(closers, gw)
+		w = gw
+	}
+
+	n, err := wt.WriteTo(w)
+	if err != nil {
+		logger.Error("could not write backup", logger.Err(err))
+		return n, errors.Wrap(err, "could not write backup")
+	}
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			logger.Error("could not finish backup", logger.Err(err))
+			return n, errors.Wrap(err, "could not finish backup")
+		}
+	}
+	return n, nil
+}
+
+// BackupFile writes a backup to filename. The backup is written to a temporary file first so
+// that filename is either the previous or the complete new backup
+func (s *Store) BackupFile(filename string, opts BackupOptions) error {
+	if _, ok := s.backend.(io.WriterTo); !ok {
+		return ErrNotSupported
+	}
+	return aead.WriteFileFunc(filename, false, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		if _, err := s.Backup(bw, opts); err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+}
+
+// readBackup reads the backup header from r and returns a reader of the database file
+func readBackup(r io.Reader, passphrase string) (io.Reader, error) {
+	header := make([]byte, len(backupMagic)+3)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(ErrInvalidBackup, err.Error())
+	}
+	if !bytes.Equal(header[:len(backupMagic)], backupMagic) {
+		return nil, ErrInvalidBackup
+	}
+	version, flags := header[len(backupMagic)], header[len(backupMagic)+1]
+	if version != BackupVersion {
+		return nil, errors.Wrap(ErrInvalidBackup, "unknown backup version")
+	}
+	cipher := make([]byte, header[len(backupMagic)+2])
+	if _, err := io.ReadFull(r, cipher); err != nil {
+		return nil, errors.Wrap(ErrInvalidBackup, err.Error())
+	}
+
+	if flags&flagEncrypted != 0 {
+		if passphrase == "" {
+			return nil, errors.New("backup is encrypted, passphrase required")
+		}
+		dr, err := decryptReader(r, string(cipher), passphrase)
+		if err != nil {
+			return nil, err
+		}
+		r = dr
+	}
+	if flags&flagCompressed != 0 {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidBackup, err.Error())
+		}
+		r = gr
+	}
+	return r, nil
+}
+
+// checkDB opens the database file at path and checks its consistency
+func checkDB(path string) (err error) {
+	// bolt panics on some kinds of corrupt pages
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrap(ErrInvalidBackup, fmt.Sprint(r))
+		}
+	}()
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return errors.Wrap(ErrInvalidBackup, err.Error())
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		var first error
+		// drain the channel so the checker goroutine exits
+		for err := range tx.Check() {
+			if first == nil {
+				first = err
+			}
+		}
+		if first != nil {
+			return errors.Wrap(ErrInvalidBackup, first.Error())
+		}
+		return nil
+	})
+}
+
+// Restore replaces the database at dir with a backup read from r. The backup is decoded to a
+// temporary file and checked before it is swapped in, so dir is left untouched if the backup
+// is corrupt, can't be decrypted or fails the consistency check. The database must not be
+// open, the file lock is taken before swapping so that other processes can't have it open
+func Restore(dir string, r io.Reader, passphrase string) error {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrap(err, "could not resolve database path")
+	}
+	if storeOpen(path) {
+		return ErrStoreOpen
+	}
+
+	dbr, err := readBackup(r, passphrase)
+	if err != nil {
+		logger.Error("could not read backup", logger.Err(err))
+		return errors.Wrap(err, "could not read backup")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".restore")
+	if err != nil {
+		logger.Error("could not create file", logger.Err(err))
+		return errors.Wrap(err, "could not create file")
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	_, err = io.Copy(tmp, dbr)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		logger.Error("could not read backup", logger.Err(err))
+		return errors.Wrap(err, "could not read backup")
+	}
+
+	if err := checkDB(tmpName); err != nil {
+		logger.Error("backup failed consistency check", logger.Err(err))
+		return errors.Wrap(err, "backup failed consistency check")
+	}
+
+	// the backup is staged without the lock, the database may have been opened meanwhile
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if _, ok := stores[path]; ok {
+		return ErrStoreOpen
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: OpenTimeout})
+	if err == bolt.ErrTimeout {
+		return errors.Wrap(ErrStoreOpen, "database is locked by another process")
+	}
+	if err != nil {
+		// the lock was free, the database is unreadable and replaced anyway
+		logger.Warn("could not open database before restoring", logger.Err(err))
+	} else {
+		defer db.Close()
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		logger.Error("could not replace database", logger.Err(err))
+		return errors.Wrap(err, "could not replace database")
+	}
+	aead.SyncDir(filepath.Dir(path))
+	return nil
+}
+
+// storeOpen returns whether the database at path is open in this process
+func storeOpen(path string) bool {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	_, ok := stores[path]
+	return ok
+}
+
+// RestoreFile restores the database at dir from a backup file, see Restore
+func RestoreFile(dir string, filename string, passphrase string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		logger.Error("could not open backup", logger.Err(err))
+		return errors.Wrap(err, "could not open backup")
+	}
+	defer f.Close()
+	return Restore(dir, bufio.NewReader(f), passphrase)
+}
@@ -0,0 +1,176 @@
+// +build all travis
+
+package database
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	cc20 "github.com/Varunram/essentials/chacha20poly1305"
+)
+
+func TestBackup(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	s, err := Open("test_files/backup.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 100; i++ {
+		if err := s.Save(testBucket, i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := []BackupOptions{
+		{},
+		{Compress: true},
+		{Passphrase: "password"},
+		{Compress: true, Passphrase: "password", Cipher: cc20.Name},
+	}
+	var backups [][]byte
+	for _, opts := range options {
+		var buf bytes.Buffer
+		if _, err := s.Backup(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, buf.Bytes())
+	}
+
+	if err := s.Save(testBucket, 101, 101); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Restore("test_files/backup.db", bytes.NewReader(backups[0]), "")
+	if err != ErrStoreOpen {
+		t.Fatalf("expected ErrStoreOpen, got %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, backup := range backups {
+		err = Restore("test_files/backup.db", bytes.NewReader(backup), options[i].Passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lim, err := RetrieveAllKeysLim("test_files/backup.db", testBucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lim != 100 {
+			t.Fatalf("expected 100 keys, got %d", lim)
+		}
+	}
+
+	// a database locked by another process isn't replaced
+	db, err := bolt.Open("test_files/backup.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := OpenTimeout
+	SetOpenTimeout(100 * time.Millisecond)
+	err = Restore("test_files/backup.db", bytes.NewReader(backups[0]), "")
+	SetOpenTimeout(timeout)
+	if errors.Cause(err) != ErrStoreOpen {
+		t.Fatalf("expected ErrStoreOpen, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt or undecryptable backups leave the database untouched
+	if err := Save("test_files/backup.db", testBucket, 101, 101); err != nil {
+		t.Fatal(err)
+	}
+	// keep the header and the meta pages, overwrite the pages they point to
+	corrupt := append([]byte{}, backups[0]...)
+	for i := 7 + 2*os.Getpagesize(); i < len(corrupt); i++ {
+		corrupt[i] = 0xff
+	}
+	err = Restore("test_files/backup.db", bytes.NewReader(corrupt), "")
+	if errors.Cause(err) != ErrInvalidBackup {
+		t.Fatalf("expected ErrInvalidBackup, got %v", err)
+	}
+	err = Restore("test_files/backup.db", bytes.NewReader(backups[2]), "wrong")
+	if err == nil {
+		t.Fatal("restored backup with the wrong passphrase")
+	}
+	err = Restore("test_files/backup.db", bytes.NewReader([]byte("garbage")), "")
+	if errors.Cause(err) != ErrInvalidBackup {
+		t.Fatalf("expected ErrInvalidBackup, got %v", err)
+	}
+	lim, err := RetrieveAllKeysLim("test_files/backup.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lim != 101 {
+		t.Fatalf("expected 101 keys, got %d", lim)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	s, err := Open("test_files/snapshot.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	sc := s.ScheduleSnapshots("test_files/snapshots", 10*time.Millisecond, 2, BackupOptions{Compress: true})
+	time.Sleep(100 * time.Millisecond)
+	sc.Stop()
+	sc.Stop()
+
+	snapshots, err := s.Snapshots("test_files/snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snapshots))
+	}
+
+	// the snapshots of a database sharing the prefix aren't listed or pruned
+	other, err := Open("test_files/snapshot-other.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := other.Snapshot("test_files/snapshots", BackupOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err = s.Snapshots("test_files/snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snapshots))
+	}
+	if err := s.PruneSnapshots("test_files/snapshots", 1); err != nil {
+		t.Fatal(err)
+	}
+	otherSnapshots, err := other.Snapshots("test_files/snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(otherSnapshots) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(otherSnapshots))
+	}
+
+	err = RestoreFile("test_files/restored.db", snapshots[1], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = RetrieveAllKeysLim("test_files/restored.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
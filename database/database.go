@@ -1,15 +1,15 @@
 package database
 
 import (
-	"encoding/json"
-	"log"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/pkg/errors"
 
-	utils "github.com/Varunram/essentials/utils"
 	"github.com/boltdb/bolt"
+
+	"github.com/Varunram/essentials/logger"
 )
 
 // ErrBucketMissing is an error handler for a missing bucket
@@ -18,7 +18,11 @@ var ErrBucketMissing = errors.New("bucket doesn't exist")
 // ErrElementNotFound is an error handler for a missing element
 var ErrElementNotFound = errors.New("element not found")
 
-// package database contains useful boltdb handlers
+// ErrStoreClosed is returned when closing a Store that has already been closed
+var ErrStoreClosed = errors.New("store already closed")
+
+// package database contains useful boltdb handlers. Applications should Open a Store once and
+// share it, the functions taking a path are kept for convenience and share a Store per path
 
 // CreateDirs creates (db) directories if they don't exist
 func CreateDirs(dirs ...string) {
@@ -30,169 +34,103 @@ func CreateDirs(dirs ...string) {
 	}
 }
 
-// CreateDB creates a new database
+// CreateDB creates a new database and runs pending migrations if StartupMigrations is set.
+// The returned handle is not shared with Open, so it must be closed before the database is
+// used through a Store or the functions taking a path
 func CreateDB(dir string, buckets ...[]byte) (*bolt.DB, error) {
 	// we need to check and create this directory if it doesn't exist
 
 	// OpenDB creates a db if it doens't exist yet
 	db, err := OpenDB(dir)
 	if err != nil {
-		log.Println("couldn't open database, exiting: ", err)
+		logger.Error("couldn't open database, exiting", logger.Err(err))
 		return db, errors.New("couldn't open database, exiting")
 	}
 
 	for _, bucket := range buckets {
-		err = db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucketIfNotExists(bucket)
+		err = NewBoltBackend(db).Update(func(tx BackendTx) error {
+			_, err := createBucket(tx, bucket)
 			return err
 		})
 		if err != nil {
-			log.Println("could not create bucket: ", err)
+			logger.Error("could not create bucket", logger.Err(err))
 			return db, errors.Wrap(err, "could not create bucket")
 		}
 	}
+
+	if err := runStartupMigrations(db); err != nil {
+		logger.Error("could not run migrations", logger.Err(err))
+		return db, errors.Wrap(err, "could not run migrations")
+	}
 	return db, nil
 }
 
-// OpenDB opens the database
+// OpenTimeout is how long opening a database waits for the file lock held by another process
+// or handle before failing
+var OpenTimeout = 5 * time.Second
+
+// SetOpenTimeout sets how long opening a database waits for the file lock
+func SetOpenTimeout(timeout time.Duration) {
+	OpenTimeout = timeout
+}
+
+// OpenDB opens the database, failing after OpenTimeout if another process holds it open
 func OpenDB(dir string) (*bolt.DB, error) {
+	options := &bolt.Options{Timeout: OpenTimeout}
 	if runtime.GOOS == "linux" {
-		return bolt.Open(dir, 0600, &bolt.Options{
-			MmapFlags: 0x8000, // MAP_POPULATE = 0x8000
-		})
+		options.MmapFlags = 0x8000 // MAP_POPULATE = 0x8000
 	}
-	return bolt.Open(dir, 0600, nil)
+	return bolt.Open(dir, 0600, options)
 }
 
-// DeleteKeyFromBucket deletes a given key from a bucket
-func DeleteKeyFromBucket(dir string, key int, bucketName []byte) error {
-	db, err := OpenDB(dir)
+// withStore runs fn on the shared Store for dir, releasing it afterwards. Close errors are
+// returned if fn succeeded
+func withStore(dir string, fn func(s *Store) error) (err error) {
+	s, err := Open(dir)
 	if err != nil {
-		return errors.Wrap(err, "could not open database")
+		return err
 	}
 
 	defer func() {
-		if ferr := db.Close(); ferr != nil {
+		if ferr := s.Close(); ferr != nil && err == nil {
 			err = ferr
 		}
 	}()
 
-	// if the passed key is not integer, don't open the db
-	iK, err := utils.ToByte(key)
-	if err != nil {
-		return err
-	}
+	return fn(s)
+}
 
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return ErrBucketMissing
-		}
-		b.Delete(iK)
-		return nil
+// DeleteKeyFromBucket deletes a given key from a bucket
+func DeleteKeyFromBucket(dir string, key int, bucketName []byte) error {
+	return withStore(dir, func(s *Store) error {
+		return s.DeleteKeyFromBucket(key, bucketName)
 	})
 }
 
 // Save inserts an interface with an integer key
 func Save(dir string, bucketName []byte, x interface{}, key int) error {
-	db, err := OpenDB(dir)
-	if err != nil {
-		return errors.Wrap(err, "could not open database")
-	}
-
-	defer func() {
-		if ferr := db.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	// if x is not interace, don't open the database
-	encoded, err := json.Marshal(x)
-	if err != nil {
-		log.Println("error while marshaling json struct: ", err)
-		return errors.Wrap(err, "error while marshaling json struct")
-	}
-
-	// if the passed key is not integer, don't open the db
-	iK, err := utils.ToByte(key)
-	if err != nil {
-		return err
-	}
-
-	// open the db only to insert the element and don't check for other stuff
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(bucketName)
-		if err != nil {
-			return err
-		}
-		return b.Put(iK, encoded)
+	return withStore(dir, func(s *Store) error {
+		return s.Save(bucketName, x, key)
 	})
-
-	return err
 }
 
 // Retrieve retrieves a byteString from the database
 func Retrieve(dir string, bucketName []byte, key int) ([]byte, error) {
 	var returnBytes []byte
-	db, err := OpenDB(dir)
-	if err != nil {
-		return returnBytes, errors.Wrap(err, "could not open database")
-	}
-
-	defer func() {
-		if ferr := db.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	// if the passed key is not integer, don't open the db
-	iK, err := utils.ToByte(key)
-	if err != nil {
-		return returnBytes, err
-	}
-
-	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return ErrBucketMissing
-		}
-		x := b.Get(iK)
-		if x == nil {
-			return ErrElementNotFound
-		}
-		returnBytes = make([]byte, len(x))
-		copy(returnBytes, x)
-		return nil
+	err := withStore(dir, func(s *Store) error {
+		var err error
+		returnBytes, err = s.Retrieve(bucketName, key)
+		return err
 	})
-
 	return returnBytes, err
 }
 
 // RetrieveAllKeys retrieves all key value pairs from the database
 func RetrieveAllKeys(dir string, bucketName []byte) ([][]byte, error) {
 	var arr [][]byte
-	db, err := OpenDB(dir)
-	if err != nil {
-		return arr, errors.Wrap(err, "could not open database")
-	}
-
-	defer func() {
-		if ferr := db.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return ErrBucketMissing
-		}
-		err := b.ForEach(func(k, x []byte) error {
-			temp := make([]byte, len(x))
-			copy(temp, x)
-			arr = append(arr, temp)
-			return nil
-		})
+	err := withStore(dir, func(s *Store) error {
+		var err error
+		arr, err = s.RetrieveAllKeys(bucketName)
 		return err
 	})
 	return arr, err
@@ -201,34 +139,21 @@ func RetrieveAllKeys(dir string, bucketName []byte) ([][]byte, error) {
 // RetrieveAllKeysLim gets the total number of keys in a bucket
 func RetrieveAllKeysLim(dir string, bucketName []byte) (int, error) {
 	lim := 0
-	db, err := OpenDB(dir)
-	if err != nil {
-		return lim, errors.Wrap(err, "could not open database")
-	}
-
-	defer func() {
-		if ferr := db.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketName)
-		if b == nil {
-			return ErrBucketMissing
-		}
-
-		x := b.Stats().KeyN
-		var temp int
-		temp = x // weird pointer stuff thanks to boltdb
-
-		lim = temp
-		return nil
+	err := withStore(dir, func(s *Store) error {
+		var err error
+		lim, err = s.RetrieveAllKeysLim(bucketName)
+		return err
 	})
-
-	if err != nil {
-		log.Println("could not open db for reading: ", err)
-	}
-
 	return lim, err
 }
+
+// NextID returns an unused integer key for a bucket
+func NextID(dir string, bucketName []byte) (int, error) {
+	var id int
+	err := withStore(dir, func(s *Store) error {
+		var err error
+		id, err = s.NextID(bucketName)
+		return err
+	})
+	return id, err
+}
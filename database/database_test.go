@@ -0,0 +1,175 @@
+// +build all travis
+
+package database
+
+import (
+	"os"
+	"sync"
+	"time"
+	"testing"
+)
+
+var testBucket = []byte("test")
+
+func TestStore(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	s, err := Open("test_files/store.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 1; i <= 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.Save(testBucket, i, i)
+		}(i)
+		// the path based functions share the open Store instead of locking the file
+		go func(i int) {
+			defer wg.Done()
+			errs <- Save("test_files/store.db", testBucket, i, i+10)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lim, err := RetrieveAllKeysLim("test_files/store.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lim != 20 {
+		t.Fatalf("expected 20 keys, got %d", lim)
+	}
+
+	x, err := s.Retrieve(testBucket, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(x) != "5" {
+		t.Fatalf("expected 5, got %s", x)
+	}
+
+	err = DeleteKeyFromBucket("test_files/store.db", 5, testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Retrieve(testBucket, 5)
+	if err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+
+	_, err = s.RetrieveAllKeys([]byte("missing"))
+	if err != ErrBucketMissing {
+		t.Fatalf("expected ErrBucketMissing, got %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != ErrStoreClosed {
+		t.Fatalf("expected ErrStoreClosed, got %v", err)
+	}
+
+	// the database is released, so it can be opened directly again
+	db, err := CreateDB("test_files/store.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+}
+
+func TestOpenLocked(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+	defer SetOpenTimeout(OpenTimeout)
+	SetOpenTimeout(time.Second)
+
+	// a handle that isn't shared with Open holds the file lock, like another process would
+	db, err := CreateDB("test_files/locked.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Open("test_files/locked.db")
+		done <- err
+	}()
+
+	// other databases can be opened and closed while Open waits for the lock
+	time.Sleep(50 * time.Millisecond)
+	s, err := Open("test_files/other.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+		t.Fatal("Open of the locked database returned early")
+	default:
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("opened a locked database")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Open didn't time out")
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	if _, err := OpenReadOnly("test_files/missing.db"); err == nil {
+		t.Fatal("read only open created a database")
+	}
+
+	s, err := Open("test_files/readonly.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(testBucket, "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// several readers can hold the database open
+	r1, err := OpenReadOnly("test_files/readonly.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+	r2, err := OpenReadOnly("test_files/readonly.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+
+	x, err := r2.Retrieve(testBucket, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(x) != `"a"` {
+		t.Fatalf("unexpected value: %s", x)
+	}
+	if err := r1.Save(testBucket, "b", 2); err == nil {
+		t.Fatal("saved through a read only store")
+	}
+}
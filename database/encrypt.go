@@ -0,0 +1,407 @@
+package database
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Values of encrypted buckets are stored as magic (2 bytes) || key ID (4 bytes) ||
+// nonce (24 bytes) || XChaCha20-Poly1305 ciphertext, with the bucket name and the key as
+// additional data so that values can't be moved between records. The key ID selects the key
+// in the Keyring, so keys can be rotated while values sealed with older keys stay readable.
+// Values without the magic prefix are plaintext written before the bucket was encrypted,
+// JSON never starts with a zero byte. Once RotateBucket has encrypted every value this is
+// recorded in the meta bucket and plaintext values are rejected, so that values can't be
+// downgraded by writing plaintext to the database file. Indexes of encrypted buckets store
+// an HMAC-SHA256 of the indexed values instead of the values, keyed with the key that was
+// current when the bucket was first encrypted or last rotated. That key ID is stored in the
+// meta bucket.
+
+var encMagic = []byte{0x00, 'E'}
+
+// encHeaderSize is the size of the magic and the key ID
+const encHeaderSize = 6
+
+// ErrUnknownKey is returned when a value was sealed with a key missing from the Keyring
+var ErrUnknownKey = errors.New("value encrypted with unknown key")
+
+// ErrBucketLocked is returned when accessing an encrypted bucket without a Keyring
+var ErrBucketLocked = errors.New("bucket is encrypted, no keyring set")
+
+// ErrPlaintextValue is returned when reading a plaintext value from an encrypted bucket whose
+// values have all been encrypted by RotateBucket
+var ErrPlaintextValue = errors.New("plaintext value in fully encrypted bucket")
+
+// Keyring holds the master keys of encrypted buckets by ID. New values are sealed with the
+// current key. A Keyring is safe for concurrent use
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[uint32]cipher.AEAD
+	macKeys map[uint32][]byte
+	current uint32
+}
+
+// NewKeyring returns a Keyring with a single 32 byte key, which is the current key
+func NewKeyring(id uint32, key []byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[uint32]cipher.AEAD), macKeys: make(map[uint32][]byte)}
+	if err := k.Add(id, key); err != nil {
+		return nil, err
+	}
+	k.current = id
+	return k, nil
+}
+
+// Add adds a 32 byte key to the Keyring. It doesn't change the current key
+func (k *Keyring) Add(id uint32, key []byte) error {
+	xchacha, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		logger.Error("failed to instantiate XChaCha20-Poly1305", logger.Err(err))
+		return errors.Wrap(err, "Failed to instantiate XChaCha20-Poly1305")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, dup := k.keys[id]; dup {
+		return errors.New("key ID already in keyring")
+	}
+	k.keys[id] = xchacha
+	// index values are authenticated with a key derived from the master key, not the master key
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("essentials/database index"))
+	k.macKeys[id] = mac.Sum(nil)
+	return nil
+}
+
+// SetCurrent sets the key used to seal new values
+func (k *Keyring) SetCurrent(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return ErrUnknownKey
+	}
+	k.current = id
+	return nil
+}
+
+// Current returns the ID of the key used to seal new values
+func (k *Keyring) Current() uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// valueAD returns the additional data binding a value to its bucket and key
+func valueAD(bucket, key []byte) []byte {
+	ad := make([]byte, 4, 4+len(bucket)+len(key))
+	binary.BigEndian.PutUint32(ad, uint32(len(bucket)))
+	ad = append(ad, bucket...)
+	return append(ad, key...)
+}
+
+// mac returns the HMAC of a value of the named index of bucket, keyed with the key id
+func (k *Keyring) mac(id uint32, bucket []byte, name string, value []byte) ([]byte, error) {
+	k.mu.RLock()
+	macKey, ok := k.macKeys[id]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(valueAD(bucket, []byte(name)))
+	mac.Write([]byte{0})
+	mac.Write(value)
+	return mac.Sum(nil), nil
+}
+
+// seal encrypts a value of bucket with the current key
+func (k *Keyring) seal(bucket, key, value []byte) ([]byte, error) {
+	k.mu.RLock()
+	id, xchacha := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+
+	data := make([]byte, encHeaderSize+chacha20poly1305.NonceSizeX, encHeaderSize+chacha20poly1305.NonceSizeX+len(value)+xchacha.Overhead())
+	copy(data, encMagic)
+	binary.BigEndian.PutUint32(data[len(encMagic):], id)
+	nonce := data[encHeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		logger.Error("could not generate random nonce", logger.Err(err))
+		return nil, errors.Wrap(err, "could not generate random nonce")
+	}
+	return xchacha.Seal(data, nonce, value, valueAD(bucket, key)), nil
+}
+
+// open decrypts a value of bucket, returning the ID of the key it was sealed with. Plaintext
+// values are returned as they are with ok set to false
+func (k *Keyring) open(bucket, key, data []byte) (value []byte, id uint32, ok bool, err error) {
+	if !bytes.HasPrefix(data, encMagic) {
+		return data, 0, false, nil
+	}
+	if len(data) < encHeaderSize+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, 0, true, errors.New("encrypted value too short")
+	}
+
+	id = binary.BigEndian.Uint32(data[len(encMagic):])
+	k.mu.RLock()
+	xchacha, found := k.keys[id]
+	k.mu.RUnlock()
+	if !found {
+		return nil, id, true, ErrUnknownKey
+	}
+
+	nonce := data[encHeaderSize : encHeaderSize+chacha20poly1305.NonceSizeX]
+	value, err = xchacha.Open(nil, nonce, data[encHeaderSize+chacha20poly1305.NonceSizeX:], valueAD(bucket, key))
+	if err != nil {
+		logger.Error("failed to decrypt or authenticate value", logger.Err(err))
+		return nil, id, true, errors.Wrap(err, "failed to decrypt or authenticate value")
+	}
+	return value, id, true, nil
+}
+
+// encKey returns the key marking bucket as encrypted in metaBucket
+func encKey(bucket []byte) []byte {
+	return append([]byte("enc/"), bucket...)
+}
+
+// sealedKey returns the key marking every value of bucket as encrypted in metaBucket
+func sealedKey(bucket []byte) []byte {
+	return append([]byte("sealed/"), bucket...)
+}
+
+// sealed returns whether every value of an encrypted bucket has been encrypted
+func (tx *Tx) sealed(bucketName []byte) bool {
+	meta := tx.tx.Bucket(metaBucket)
+	return meta != nil && meta.Get(sealedKey(bucketName)) != nil
+}
+
+// EncryptBucket marks a bucket as encrypted, creating it if it doesn't exist. Values saved
+// from now on are sealed with the current key of the Keyring, existing plaintext values stay
+// readable and are encrypted by RotateBucket. The mark is stored in the database, so the
+// bucket can't be read without calling EncryptBucket again after the database is opened.
+// When the bucket is first encrypted its indexes are rebuilt, so they must have been added.
+// Indexes of the bucket are keyed with the key that was current when the bucket was first
+// encrypted, so that key must stay in the Keyring until RotateBucket has run
+func (s *Store) EncryptBucket(bucket []byte, keyring *Keyring) error {
+	if keyring == nil {
+		return errors.New("keyring can't be nil")
+	}
+
+	marked := false
+	err := s.backend.Update(func(tx BackendTx) error {
+		if _, err := createBucket(tx, bucket); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if len(meta.Get(encKey(bucket))) == 4 {
+			return nil
+		}
+		// stored indexes that weren't added couldn't be rebuilt below
+		if _, err := s.checkIndexes(tx, bucket); err != nil {
+			return err
+		}
+		id := make([]byte, 4)
+		binary.BigEndian.PutUint32(id, keyring.Current())
+		marked = true
+		return meta.Put(encKey(bucket), id)
+	})
+	if err != nil {
+		logger.Error("could not mark bucket as encrypted", logger.Err(err))
+		return errors.Wrap(err, "could not mark bucket as encrypted")
+	}
+
+	s.encMu.Lock()
+	s.keyrings[string(bucket)] = keyring
+	s.encMu.Unlock()
+	if !marked {
+		return nil
+	}
+
+	// indexes added before the bucket was encrypted store plaintext values
+	err = s.Update(func(tx *Tx) error {
+		for _, idx := range s.Indexes(bucket) {
+			if err := tx.rebuildIndex(bucket, idx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("could not rebuild indexes", logger.Err(err))
+		return errors.Wrap(err, "could not rebuild indexes")
+	}
+	return nil
+}
+
+// indexValue returns the form of an indexed value stored in the indexes of bucket, which is
+// its HMAC if the bucket is encrypted
+func (tx *Tx) indexValue(bucketName []byte, name string, value []byte) ([]byte, error) {
+	keyring, err := tx.keyring(bucketName)
+	if err != nil || keyring == nil {
+		return value, err
+	}
+	meta := tx.tx.Bucket(metaBucket)
+	if meta == nil {
+		return nil, ErrBucketLocked
+	}
+	id := meta.Get(encKey(bucketName))
+	if len(id) != 4 {
+		return nil, errors.New("bucket has no index key")
+	}
+	return keyring.mac(binary.BigEndian.Uint32(id), bucketName, name, value)
+}
+
+// keyring returns the Keyring of an encrypted bucket, nil if the bucket isn't encrypted
+func (tx *Tx) keyring(bucketName []byte) (*Keyring, error) {
+	tx.store.encMu.RLock()
+	keyring := tx.store.keyrings[string(bucketName)]
+	tx.store.encMu.RUnlock()
+	if keyring != nil {
+		return keyring, nil
+	}
+
+	if meta := tx.tx.Bucket(metaBucket); meta != nil && meta.Get(encKey(bucketName)) != nil {
+		return nil, ErrBucketLocked
+	}
+	return nil, nil
+}
+
+// sealValue encrypts a value if its bucket is encrypted
+func (tx *Tx) sealValue(bucketName, key, value []byte) ([]byte, error) {
+	keyring, err := tx.keyring(bucketName)
+	if err != nil || keyring == nil {
+		return value, err
+	}
+	return keyring.seal(bucketName, key, value)
+}
+
+// openValue decrypts a value if its bucket is encrypted
+func (tx *Tx) openValue(bucketName, key, data []byte) ([]byte, error) {
+	keyring, err := tx.keyring(bucketName)
+	if err != nil || keyring == nil {
+		return data, err
+	}
+	value, _, encrypted, err := keyring.open(bucketName, key, data)
+	if err == nil && !encrypted && tx.sealed(bucketName) {
+		return nil, ErrPlaintextValue
+	}
+	return value, err
+}
+
+// RotateBucket re-encrypts the values of an encrypted bucket that aren't sealed with the
+// current key, including plaintext values, committing after every batchSize values so that
+// large buckets don't block writers. It returns the number of re-encrypted values. Once every
+// value is encrypted plaintext values are rejected, and the indexes are rebuilt with the
+// current key so that older keys can be removed from the Keyring
+func (s *Store) RotateBucket(bucket []byte, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	total := 0
+	var cursor []byte
+	for {
+		var next []byte
+		n := 0
+		err := s.Update(func(tx *Tx) error {
+			keyring, err := tx.keyring(bucket)
+			if err != nil {
+				return err
+			}
+			if keyring == nil {
+				return errors.New("bucket isn't encrypted")
+			}
+
+			b, err := tx.bucket(bucket)
+			if err != nil {
+				return err
+			}
+			var records []Record
+			records, next = find(b, Query{After: cursor, Limit: batchSize}, nil)
+			current := keyring.Current()
+			sealed := tx.sealed(bucket)
+			for _, record := range records {
+				value, id, encrypted, err := keyring.open(bucket, record.Key, record.Value)
+				if err != nil {
+					return err
+				}
+				if !encrypted && sealed {
+					return ErrPlaintextValue
+				}
+				if encrypted && id == current {
+					continue
+				}
+				sealed, err := keyring.seal(bucket, record.Key, value)
+				if err != nil {
+					return err
+				}
+				// the plaintext is unchanged, so the indexes don't need updating
+				if err := b.Put(record.Key, sealed); err != nil {
+					return err
+				}
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Error("could not rotate bucket keys", logger.Err(err))
+			return total, errors.Wrap(err, "could not rotate bucket keys")
+		}
+		total += n
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	// new values are sealed by writers, so every value is encrypted now
+	err := s.Update(func(tx *Tx) error {
+		keyring, err := tx.keyring(bucket)
+		if err != nil {
+			return err
+		}
+		meta, err := tx.tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(sealedKey(bucket), []byte{1}); err != nil {
+			return err
+		}
+
+		id := make([]byte, 4)
+		binary.BigEndian.PutUint32(id, keyring.Current())
+		if bytes.Equal(meta.Get(encKey(bucket)), id) {
+			return nil
+		}
+		indexes, err := tx.store.checkIndexes(tx.tx, bucket)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(encKey(bucket), id); err != nil {
+			return err
+		}
+		for _, idx := range indexes {
+			if err := tx.rebuildIndex(bucket, idx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("could not rebuild indexes", logger.Err(err))
+		return total, errors.Wrap(err, "could not rebuild indexes")
+	}
+	return total, nil
+}
@@ -0,0 +1,216 @@
+// +build all travis
+
+package database
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+func TestEncryptBucket(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	secrets := []byte("secrets")
+	s, err := Open("test_files/encrypt.db", secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// written before the bucket is encrypted
+	if err := s.Save(secrets, testAccount{Index: 1, Email: "a@test.com"}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EncryptBucket(secrets, keyring); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddIndex(secrets, Index{Name: "email", Field: "Email", Unique: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(secrets, testAccount{Index: 2, Email: "b@test.com"}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := func(key int) []byte {
+		var x []byte
+		s.DB().View(func(tx *bolt.Tx) error {
+			x = append([]byte{}, tx.Bucket(secrets).Get(EncodeKey(key))...)
+			return nil
+		})
+		return x
+	}
+	if bytes.Contains(raw(2), []byte("b@test.com")) {
+		t.Fatal("value stored in plaintext")
+	}
+	if !bytes.Contains(raw(1), []byte("a@test.com")) {
+		t.Fatal("existing value encrypted before rotation")
+	}
+	// the index doesn't store the value either
+	file, err := ioutil.ReadFile("test_files/encrypt.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(file, []byte("b@test.com")) {
+		t.Fatal("value stored in plaintext in the database file")
+	}
+
+	record, err := s.FindOneBy(secrets, "email", []byte("b@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(record.Value, []byte("b@test.com")) {
+		t.Fatalf("unexpected record: %s", record.Value)
+	}
+	arr, err := s.RetrieveAllKeys(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arr) != 2 || !bytes.Contains(arr[0], []byte("a@test.com")) {
+		t.Fatalf("unexpected values: %q", arr)
+	}
+
+	// values are bound to their keys
+	err = s.DB().Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(secrets).Put(EncodeKey(3), raw(2))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Retrieve(secrets, 3); err == nil {
+		t.Fatal("opened value moved to another key")
+	}
+	if err := s.DB().Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(secrets).Delete(EncodeKey(3))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate to a new key, old values stay readable until they are re-encrypted
+	if err := keyring.Add(2, bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetCurrent(2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 3; i <= 10; i++ {
+		if err := s.Save(secrets, testAccount{Index: i}, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := s.RotateBucket(secrets, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rotated values, got %d", n)
+	}
+	if bytes.Contains(raw(1), []byte("a@test.com")) {
+		t.Fatal("plaintext value not encrypted by rotation")
+	}
+
+
+	// plaintext values are rejected once every value was encrypted
+	if err := s.DB().Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(secrets).Put(EncodeKey(11), []byte(`{"Index":11}`))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Retrieve(secrets, 11); err != ErrPlaintextValue {
+		t.Fatalf("expected ErrPlaintextValue, got %v", err)
+	}
+	if err := s.DB().Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(secrets).Delete(EncodeKey(11))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bucket can't be read without the keyring after reopening
+	s, err = Open("test_files/encrypt.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Retrieve(secrets, 1); err != ErrBucketLocked {
+		t.Fatalf("expected ErrBucketLocked, got %v", err)
+	}
+
+	// values sealed with a key missing from the keyring can't be read
+	old, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EncryptBucket(secrets, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Retrieve(secrets, 1); errors.Cause(err) != ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+
+	// the indexes were rebuilt by the rotation, so the first key isn't needed anymore
+	current, err := NewKeyring(2, bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EncryptBucket(secrets, current); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddIndex(secrets, Index{Name: "email", Field: "Email", Unique: true}); err != nil {
+		t.Fatal(err)
+	}
+	record, err = s.FindOneBy(secrets, "email", []byte("b@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(record.Value, []byte("b@test.com")) {
+		t.Fatalf("unexpected record: %s", record.Value)
+	}
+
+	// indexes added before the bucket is encrypted are rebuilt without the values
+	plain := []byte("plain")
+	if err := s.AddIndex(plain, Index{Name: "email", Field: "Email"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(plain, testAccount{Index: 1, Email: "c@test.com"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EncryptBucket(plain, old); err != nil {
+		t.Fatal(err)
+	}
+	err = s.DB().View(func(tx *bolt.Tx) error {
+		return tx.Bucket(IndexBucket(plain, "email")).ForEach(func(k, v []byte) error {
+			if bytes.Contains(k, []byte("c@test.com")) {
+				return errors.New("value stored in plaintext in the index")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.FindBy(plain, "email", []byte("c@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+
+	_, err = NewKeyring(1, []byte("short"))
+	if err == nil {
+		t.Fatal("short key accepted")
+	}
+}
@@ -0,0 +1,410 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Indexes map a value extracted from each record of a bucket to the record's key. They are
+// stored in companion buckets named by IndexBucket and kept up to date by Tx.Save and
+// Tx.Delete. Unique indexes store the value as key and the record key as value, other indexes
+// store value || record key as key so that several records can share a value. Indexes of
+// encrypted buckets store the HMAC of the values, see EncryptBucket.
+// The definition of every index is stored in metaBucket, so that an index isn't silently
+// left out of date by a process that didn't add it: writes to a bucket fail with
+// ErrIndexNotAdded until all of its stored indexes are added to the Store again.
+
+// ErrUniqueViolation is returned when saving a record whose value for a unique index is
+// already used by another record
+var ErrUniqueViolation = errors.New("unique index constraint violated")
+
+// ErrIndexMissing is returned when looking up an index that hasn't been added to the Store
+var ErrIndexMissing = errors.New("index doesn't exist")
+
+// ErrIndexNotAdded is returned when writing to a bucket with a stored index that hasn't been
+// added to the Store since it was opened
+var ErrIndexNotAdded = errors.New("index of bucket not added")
+
+// Index describes a secondary index of a bucket
+type Index struct {
+	// Name identifies the index in FindBy
+	Name string
+	// Field is the name of the JSON field to index, string values are indexed without quotes
+	// and other values as their JSON encoding. Records without the field aren't indexed
+	Field string
+	// Func extracts the indexed value from a stored record if set, instead of Field. A nil
+	// or empty value isn't indexed
+	Func func(value []byte) ([]byte, error)
+	// Unique rejects records whose value is used by another record with ErrUniqueViolation
+	Unique bool
+}
+
+// IndexBucket returns the name of the companion bucket storing an index of bucket
+func IndexBucket(bucket []byte, name string) []byte {
+	return companionBucket("idx", bucket, name)
+}
+
+// indexDef is the definition of an index stored in metaBucket. Funcs can't be stored, so
+// only whether one is used is recorded
+type indexDef struct {
+	Field  string
+	Func   bool
+	Unique bool
+}
+
+// def returns the stored definition of idx
+func (idx Index) def() indexDef {
+	return indexDef{Field: idx.Field, Func: idx.Func != nil, Unique: idx.Unique}
+}
+
+// indexKeyPrefix returns the prefix of the keys of the index definitions of bucket in
+// metaBucket. Bucket names can't contain the reserved byte, so it ends the bucket name
+func indexKeyPrefix(bucket []byte) []byte {
+	return append(append([]byte("idx/"), bucket...), reservedByte)
+}
+
+// indexKey returns the key of the definition of the named index of bucket in metaBucket
+func indexKey(bucket []byte, name string) []byte {
+	return append(indexKeyPrefix(bucket), name...)
+}
+
+// value extracts the indexed value from a stored record
+func (idx Index) value(data []byte) ([]byte, error) {
+	if idx.Func != nil {
+		return idx.Func(data)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Wrap(err, "could not decode record for index "+idx.Name)
+	}
+	raw, ok := fields[idx.Field]
+	if !ok || string(raw) == "null" {
+		return nil, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return []byte(str), nil
+	}
+	return raw, nil
+}
+
+// entry returns the key and value of the index entry for a record
+func (idx Index) entry(value, key []byte) ([]byte, []byte) {
+	if idx.Unique {
+		return value, key
+	}
+	return append(append([]byte{}, value...), key...), []byte{}
+}
+
+// AddIndex adds an index to a bucket of the Store and builds it from the existing records.
+// Indexes need to be added again whenever the database is opened, until then writes to the
+// bucket fail with ErrIndexNotAdded. An index whose stored definition matches isn't rebuilt,
+// except for indexes using a Func since a changed Func can't be detected. Adding an index
+// with the same name again replaces it
+func (s *Store) AddIndex(bucket []byte, idx Index) error {
+	if idx.Name == "" || (idx.Field == "" && idx.Func == nil) {
+		return errors.New("index needs a name and a field or func")
+	}
+
+	err := s.Update(func(tx *Tx) error {
+		if err := tx.CreateBucket(bucket); err != nil {
+			return err
+		}
+		def, err := json.Marshal(idx.def())
+		if err != nil {
+			return err
+		}
+		meta, err := tx.tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if idx.Func == nil && bytes.Equal(meta.Get(indexKey(bucket, idx.Name)), def) &&
+			tx.tx.Bucket(IndexBucket(bucket, idx.Name)) != nil {
+			return nil
+		}
+		if err := tx.rebuildIndex(bucket, idx); err != nil {
+			return err
+		}
+		return meta.Put(indexKey(bucket, idx.Name), def)
+	})
+	if err != nil {
+		logger.Error("could not build index", logger.Err(err))
+		return errors.Wrap(err, "could not build index")
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	var indexes []Index
+	for _, old := range s.indexes[string(bucket)] {
+		if old.Name != idx.Name {
+			indexes = append(indexes, old)
+		}
+	}
+	s.indexes[string(bucket)] = append(indexes, idx)
+	return nil
+}
+
+// RemoveIndex removes an index from a bucket of the Store, deleting its entries and its
+// stored definition
+func (s *Store) RemoveIndex(bucket []byte, name string) error {
+	err := s.Update(func(tx *Tx) error {
+		if tx.tx.Bucket(IndexBucket(bucket, name)) != nil {
+			if err := tx.tx.DeleteBucket(IndexBucket(bucket, name)); err != nil {
+				return err
+			}
+		}
+		if meta := tx.tx.Bucket(metaBucket); meta != nil {
+			return meta.Delete(indexKey(bucket, name))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("could not remove index", logger.Err(err))
+		return errors.Wrap(err, "could not remove index")
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	var indexes []Index
+	for _, old := range s.indexes[string(bucket)] {
+		if old.Name != name {
+			indexes = append(indexes, old)
+		}
+	}
+	s.indexes[string(bucket)] = indexes
+	return nil
+}
+
+// Indexes returns the indexes added to a bucket
+func (s *Store) Indexes(bucket []byte) []Index {
+	s.indexMu.RLock()
+	defer s.indexMu.RUnlock()
+	return append([]Index{}, s.indexes[string(bucket)]...)
+}
+
+// index returns the index of a bucket with the given name
+func (s *Store) index(bucket []byte, name string) (Index, error) {
+	for _, idx := range s.Indexes(bucket) {
+		if idx.Name == name {
+			return idx, nil
+		}
+	}
+	return Index{}, errors.Wrap(ErrIndexMissing, name)
+}
+
+// checkIndexes returns the indexes added to bucket, failing with ErrIndexNotAdded if bucket
+// has a stored index that wasn't added
+func (s *Store) checkIndexes(tx BackendTx, bucket []byte) ([]Index, error) {
+	indexes := s.Indexes(bucket)
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return indexes, nil
+	}
+
+	prefix := indexKeyPrefix(bucket)
+	c := meta.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		name := string(k[len(prefix):])
+		added := false
+		for _, idx := range indexes {
+			if idx.Name == name {
+				added = true
+				break
+			}
+		}
+		if !added {
+			return nil, errors.Wrap(ErrIndexNotAdded, name)
+		}
+	}
+	return indexes, nil
+}
+
+// rebuildIndex drops the companion bucket of an index and fills it from the records of bucket
+func (tx *Tx) rebuildIndex(bucket []byte, idx Index) error {
+	name := IndexBucket(bucket, idx.Name)
+	if tx.tx.Bucket(name) != nil {
+		if err := tx.tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	if _, err := createRawBucket(tx.tx, name); err != nil {
+		return err
+	}
+
+	records, _, err := tx.Find(bucket, Query{})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := tx.addIndexEntry(bucket, idx, record.Key, record.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedValue returns the value of a record for idx as stored in the index, nil if the
+// record isn't indexed
+func (tx *Tx) indexedValue(bucket []byte, idx Index, data []byte) ([]byte, error) {
+	value, err := idx.value(data)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+	return tx.indexValue(bucket, idx.Name, value)
+}
+
+// addIndexEntry indexes the record stored under key
+func (tx *Tx) addIndexEntry(bucket []byte, idx Index, key, data []byte) error {
+	value, err := tx.indexedValue(bucket, idx, data)
+	if err != nil || value == nil {
+		return err
+	}
+
+	b, err := createRawBucket(tx.tx, IndexBucket(bucket, idx.Name))
+	if err != nil {
+		return err
+	}
+
+	k, v := idx.entry(value, key)
+	if idx.Unique {
+		if other := b.Get(k); other != nil && !bytes.Equal(other, key) {
+			return errors.Wrap(ErrUniqueViolation, idx.Name)
+		}
+	}
+	return b.Put(k, v)
+}
+
+// removeIndexEntry removes the index entry of the record stored under key
+func (tx *Tx) removeIndexEntry(bucket []byte, idx Index, key, data []byte) error {
+	value, err := tx.indexedValue(bucket, idx, data)
+	if err != nil || value == nil {
+		return err
+	}
+
+	b := tx.tx.Bucket(IndexBucket(bucket, idx.Name))
+	if b == nil {
+		return nil
+	}
+
+	k, _ := idx.entry(value, key)
+	if idx.Unique && !bytes.Equal(b.Get(k), key) {
+		// the entry belongs to another record
+		return nil
+	}
+	return b.Delete(k)
+}
+
+// updateIndexes replaces the index entries of the record stored under key. old is nil for a
+// new record and data is nil for a deleted record
+func (tx *Tx) updateIndexes(bucket []byte, key, old, data []byte) error {
+	indexes, err := tx.store.checkIndexes(tx.tx, bucket)
+	if err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		if old != nil {
+			if err := tx.removeIndexEntry(bucket, idx, key, old); err != nil {
+				return err
+			}
+		}
+		if data != nil {
+			if err := tx.addIndexEntry(bucket, idx, key, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindBy returns the records of bucket whose value for the named index is value
+func (tx *Tx) FindBy(bucketName []byte, name string, value []byte) ([]Record, error) {
+	idx, err := tx.store.index(bucketName, name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	ib := tx.tx.Bucket(IndexBucket(bucketName, name))
+	if ib == nil {
+		return nil, ErrBucketMissing
+	}
+	value, err = tx.indexValue(bucketName, name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][]byte
+	if idx.Unique {
+		if key := ib.Get(value); key != nil {
+			keys = append(keys, key)
+		}
+	} else {
+		c := ib.Cursor()
+		for k, _ := c.Seek(value); k != nil && bytes.HasPrefix(k, value); k, _ = c.Next() {
+			// skip longer values sharing the prefix
+			if len(k) == len(value)+KeySize {
+				keys = append(keys, k[len(value):])
+			}
+		}
+	}
+
+	var records []Record
+	expired := tx.expiredFunc(bucketName)
+	for _, key := range keys {
+		x := b.Get(key)
+		if x == nil || expired(key) {
+			continue
+		}
+		records = append(records, Record{
+			Key:   append([]byte{}, key...),
+			Value: append([]byte{}, x...),
+		})
+	}
+	if err := tx.openRecords(bucketName, records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// FindOneBy returns the first record of bucket whose value for the named index is value, or
+// ErrElementNotFound
+func (tx *Tx) FindOneBy(bucketName []byte, name string, value []byte) (Record, error) {
+	records, err := tx.FindBy(bucketName, name, value)
+	if err != nil {
+		return Record{}, err
+	}
+	if len(records) == 0 {
+		return Record{}, ErrElementNotFound
+	}
+	return records[0], nil
+}
+
+// FindBy returns the records of bucket whose value for the named index is value
+func (s *Store) FindBy(bucketName []byte, name string, value []byte) ([]Record, error) {
+	var records []Record
+	err := s.View(func(tx *Tx) error {
+		var err error
+		records, err = tx.FindBy(bucketName, name, value)
+		return err
+	})
+	return records, err
+}
+
+// FindOneBy returns the first record of bucket whose value for the named index is value, or
+// ErrElementNotFound
+func (s *Store) FindOneBy(bucketName []byte, name string, value []byte) (Record, error) {
+	var record Record
+	err := s.View(func(tx *Tx) error {
+		var err error
+		record, err = tx.FindOneBy(bucketName, name, value)
+		return err
+	})
+	return record, err
+}
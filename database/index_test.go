@@ -0,0 +1,218 @@
+// +build all travis
+
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testAccount struct {
+	Index  int
+	Email  string
+	Pubkey string `json:",omitempty"`
+	Group  int
+}
+
+func TestIndex(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	s, err := Open("test_files/index.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	accounts, err := NewRepository(s, []byte("accounts"), testAccount{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// records saved before the index is added are indexed too
+	err = accounts.Put(1, testAccount{Index: 1, Email: "a@test.com", Pubkey: "GA", Group: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = accounts.AddIndex(Index{Name: "email", Field: "Email", Unique: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = accounts.AddIndex(Index{Name: "pubkey", Field: "Pubkey", Unique: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = accounts.AddIndex(Index{Name: "group", Field: "Group"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = accounts.Put(2, testAccount{Index: 2, Email: "b@test.com", Group: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = accounts.Put(3, testAccount{Index: 3, Email: "c@test.com", Group: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := accounts.FindOneBy("email", []byte("b@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.(*testAccount).Index != 2 {
+		t.Fatalf("unexpected account: %#v", x)
+	}
+
+	// group 11 shares a prefix with group 1 but must not match it
+	arr, err := accounts.FindBy("group", []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arr) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(arr))
+	}
+
+	err = accounts.Put(4, testAccount{Index: 4, Email: "a@test.com"})
+	if errors.Cause(err) != ErrUniqueViolation {
+		t.Fatalf("expected ErrUniqueViolation, got %v", err)
+	}
+	_, err = accounts.Get(4)
+	if err != ErrElementNotFound {
+		t.Fatalf("violating record was saved: %v", err)
+	}
+
+	// updating a record moves its index entries
+	err = accounts.Put(1, testAccount{Index: 1, Email: "d@test.com", Group: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = accounts.FindOneBy("email", []byte("a@test.com"))
+	if err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+	_, err = accounts.FindOneBy("pubkey", []byte("GA"))
+	if err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+	x, err = accounts.FindOneBy("email", []byte("d@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.(*testAccount).Index != 1 {
+		t.Fatalf("unexpected account: %#v", x)
+	}
+
+	err = accounts.Delete(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, err = accounts.FindBy("group", []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arr) != 0 {
+		t.Fatalf("expected no accounts, got %d", len(arr))
+	}
+
+	_, err = accounts.FindBy("missing", []byte("1"))
+	if errors.Cause(err) != ErrIndexMissing {
+		t.Fatalf("expected ErrIndexMissing, got %v", err)
+	}
+
+	// building a unique index fails if records already share a value
+	err = accounts.Put(5, testAccount{Index: 5, Email: "e@test.com", Group: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = accounts.AddIndex(Index{Name: "unique_group", Field: "Group", Unique: true})
+	if errors.Cause(err) != ErrUniqueViolation {
+		t.Fatalf("expected ErrUniqueViolation, got %v", err)
+	}
+}
+
+func TestIndexStored(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	bucket := []byte("accounts")
+	s, err := Open("test_files/stored.db", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddIndex(bucket, Index{Name: "email", Field: "Email", Unique: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save(bucket, testAccount{Index: 1, Email: "a@test.com"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open("test_files/stored.db", bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// writes can't skip the unique check before the index is added again
+	err = s.Save(bucket, testAccount{Index: 2, Email: "a@test.com"}, 2)
+	if errors.Cause(err) != ErrIndexNotAdded {
+		t.Fatalf("expected ErrIndexNotAdded, got %v", err)
+	}
+
+	// an index with an unchanged definition isn't rebuilt
+	marker := []byte("marker")
+	err = s.Backend().Update(func(tx BackendTx) error {
+		return tx.Bucket(IndexBucket(bucket, "email")).Put(marker, []byte{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasMarker := func() bool {
+		found := false
+		s.Backend().View(func(tx BackendTx) error {
+			found = tx.Bucket(IndexBucket(bucket, "email")).Get(marker) != nil
+			return nil
+		})
+		return found
+	}
+	err = s.AddIndex(bucket, Index{Name: "email", Field: "Email", Unique: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasMarker() {
+		t.Fatalf("unchanged index was rebuilt")
+	}
+	err = s.AddIndex(bucket, Index{Name: "email", Field: "Email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasMarker() {
+		t.Fatalf("changed index wasn't rebuilt")
+	}
+
+	err = s.Save(bucket, testAccount{Index: 2, Email: "a@test.com"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.FindBy(bucket, "email", []byte("a@test.com"))
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d: %v", len(records), err)
+	}
+
+	err = s.RemoveIndex(bucket, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.FindBy(bucket, "email", []byte("a@test.com"))
+	if errors.Cause(err) != ErrIndexMissing {
+		t.Fatalf("expected ErrIndexMissing, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Keys are stored as 8 byte big endian integers with the sign bit flipped, so that bolt
+// iterates them in numerical order (including negative keys). Older versions of this package
+// stored keys as decimal strings, buckets written that way are migrated when they are opened.
+
+// KeySize is the length of an encoded key
+const KeySize = 8
+
+// keyFormatBE marks a bucket whose keys are encoded with EncodeKey, and keyFormatRaw a bucket
+// whose keys are arbitrary bytes and must not be migrated
+const (
+	keyFormatBE  = "be"
+	keyFormatRaw = "raw"
+)
+
+// metaBucket stores information about the other buckets in the database
+var metaBucket = []byte("_meta")
+
+// reservedByte starts the names of the companion buckets the package keeps for indexes and
+// expiring records. User buckets can't contain it, so companions can't collide with them
+const reservedByte = 0x00
+
+// ErrReservedBucket is returned when creating a bucket whose name is reserved by the package
+var ErrReservedBucket = errors.New("bucket name is reserved")
+
+// ErrNotMigrated is returned when opening a database whose keys haven't been migrated read
+// only
+var ErrNotMigrated = errors.New("database needs migration, open it for writing first")
+
+// keysMigratedKey is set in metaBucket once migrateAll has run, so that later opens don't
+// need a write transaction to find out there is nothing to migrate
+var keysMigratedKey = []byte("keys-migrated")
+
+// ErrInvalidKey is returned when decoding a key that wasn't encoded with EncodeKey
+var ErrInvalidKey = errors.New("invalid key")
+
+// EncodeKey encodes an integer key so that keys sort in numerical order
+func EncodeKey(key int) []byte {
+	b := make([]byte, KeySize)
+	binary.BigEndian.PutUint64(b, uint64(key)^(1<<63))
+	return b
+}
+
+// DecodeKey decodes a key encoded with EncodeKey
+func DecodeKey(b []byte) (int, error) {
+	if len(b) != KeySize {
+		return 0, ErrInvalidKey
+	}
+	return int(binary.BigEndian.Uint64(b) ^ (1 << 63)), nil
+}
+
+// keyFormatKey returns the key under which the key format of bucket is stored in metaBucket
+func keyFormatKey(bucket []byte) []byte {
+	return append([]byte("keys/"), bucket...)
+}
+
+// companionBucket returns the name of a companion bucket of bucket
+// reservedByte || kind || reservedByte || bucket [|| reservedByte || name]
+func companionBucket(kind string, bucket []byte, name ...string) []byte {
+	b := append([]byte{reservedByte}, kind...)
+	b = append(append(b, reservedByte), bucket...)
+	for _, n := range name {
+		b = append(append(b, reservedByte), n...)
+	}
+	return b
+}
+
+// checkBucketName returns ErrReservedBucket if bucket can't be used as the name of a user bucket
+func checkBucketName(bucket []byte) error {
+	if bytes.IndexByte(bucket, reservedByte) >= 0 || bytes.Equal(bucket, metaBucket) {
+		return errors.Wrap(ErrReservedBucket, strconv.Quote(string(bucket)))
+	}
+	return nil
+}
+
+// ReservedBucket returns whether name is the name of a bucket the package keeps for itself,
+// the meta bucket or a companion bucket
+func ReservedBucket(name []byte) bool {
+	return checkBucketName(name) != nil
+}
+
+// createBucket creates a user bucket if it doesn't exist. New and empty buckets are marked as
+// using EncodeKey, since there is nothing to migrate in them
+func createBucket(tx BackendTx, bucket []byte) (Bucket, error) {
+	if err := checkBucketName(bucket); err != nil {
+		return nil, err
+	}
+	return createBucketFormat(tx, bucket, keyFormatBE)
+}
+
+// createRawBucket creates a bucket that stores arbitrary keys if it doesn't exist
+func createRawBucket(tx BackendTx, bucket []byte) (Bucket, error) {
+	return createBucketFormat(tx, bucket, keyFormatRaw)
+}
+
+// createBucketFormat creates bucket if it doesn't exist, recording the key format of new and
+// empty buckets
+func createBucketFormat(tx BackendTx, bucket []byte, format string) (Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Get(keyFormatKey(bucket)) != nil {
+		return b, nil
+	}
+	if k, _ := b.Cursor().First(); k != nil {
+		// existing data, leave it to the migration
+		return b, nil
+	}
+	return b, meta.Put(keyFormatKey(bucket), []byte(format))
+}
+
+// migrateKeys re-encodes the decimal keys of bucket with EncodeKey and marks the bucket as
+// migrated. The number of migrated keys is returned, nested buckets are left untouched
+func migrateKeys(tx BackendTx, bucket []byte) (int, error) {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return 0, ErrBucketMissing
+	}
+
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return 0, err
+	}
+	if meta.Get(keyFormatKey(bucket)) != nil {
+		return 0, nil
+	}
+
+	type pair struct {
+		old, new, value []byte
+	}
+	var pairs []pair
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			continue
+		}
+		key, err := strconv.Atoi(string(k))
+		if err != nil || strconv.Itoa(key) != string(k) {
+			return 0, errors.Wrap(ErrInvalidKey, "key "+strconv.Quote(string(k))+" isn't a decimal integer")
+		}
+		// the slices are only valid during the transaction and are invalidated by writes
+		pairs = append(pairs, pair{
+			old:   append([]byte{}, k...),
+			new:   EncodeKey(key),
+			value: append([]byte{}, v...),
+		})
+	}
+
+	// delete everything first since an encoded key might equal an 8 digit decimal key
+	for _, p := range pairs {
+		if err := b.Delete(p.old); err != nil {
+			return 0, err
+		}
+	}
+	for _, p := range pairs {
+		if err := b.Put(p.new, p.value); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(pairs), meta.Put(keyFormatKey(bucket), []byte(keyFormatBE))
+}
+
+// MigrateKeys re-encodes the keys of a bucket written by older versions of this package with
+// EncodeKey. It returns the number of migrated keys and does nothing if the bucket has been
+// migrated already
+func (s *Store) MigrateKeys(bucket []byte) (int, error) {
+	var n int
+	err := s.backend.Update(func(tx BackendTx) error {
+		var err error
+		n, err = migrateKeys(tx, bucket)
+		return err
+	})
+	if err != nil {
+		logger.Error("could not migrate keys", logger.Err(err))
+		return 0, errors.Wrap(err, "could not migrate keys")
+	}
+	return n, nil
+}
+
+// keysMigrated returns whether migrateAll has already run on the database
+func (s *Store) keysMigrated() (bool, error) {
+	migrated := false
+	err := s.backend.View(func(tx BackendTx) error {
+		if meta := tx.Bucket(metaBucket); meta != nil {
+			migrated = meta.Get(keysMigratedKey) != nil
+		}
+		return nil
+	})
+	return migrated, err
+}
+
+// checkMigrated returns ErrNotMigrated if the database has buckets and migrateAll hasn't run
+// on it
+func (s *Store) checkMigrated() error {
+	return s.backend.View(func(tx BackendTx) error {
+		if meta := tx.Bucket(metaBucket); meta != nil && meta.Get(keysMigratedKey) != nil {
+			return nil
+		}
+		return tx.ForEachBucket(func(name []byte) error {
+			if !bytes.Equal(name, metaBucket) {
+				return ErrNotMigrated
+			}
+			return nil
+		})
+	})
+}
+
+// migrateAll migrates every bucket that hasn't been migrated yet and records that it has run.
+// Buckets whose keys aren't all decimal integers weren't written by this package and are
+// skipped. Databases that were migrated already are only checked in a read transaction
+func (s *Store) migrateAll() error {
+	migrated, err := s.keysMigrated()
+	if err != nil || migrated {
+		return err
+	}
+
+	return s.backend.Update(func(tx BackendTx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if meta.Get(keysMigratedKey) != nil {
+			// another process migrated the database since we checked
+			return nil
+		}
+
+		var buckets [][]byte
+		err = tx.ForEachBucket(func(name []byte) error {
+			if string(name) != string(metaBucket) {
+				buckets = append(buckets, append([]byte{}, name...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, bucket := range buckets {
+			n, err := migrateKeys(tx, bucket)
+			if errors.Cause(err) == ErrInvalidKey {
+				logger.Warn("not migrating keys of bucket", logger.F("bucket", string(bucket)), logger.Err(err))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				logger.Info("migrated keys", logger.F("bucket", string(bucket)), logger.F("keys", n))
+			}
+		}
+		return meta.Put(keysMigratedKey, []byte{1})
+	})
+}
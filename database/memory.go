@@ -0,0 +1,462 @@
+package database
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryBackend is a Backend keeping buckets in maps, meant for tests and small short lived
+// databases. Write transactions are serialized and keep their changes to a bucket in an
+// overlay of the keys they touch, which is merged into the bucket on commit
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	buckets map[string]*memBucket
+}
+
+// ErrTxNotWritable is returned when writing in a read-only transaction of a MemoryBackend
+var ErrTxNotWritable = errors.New("tx not writable")
+
+var (
+	memoryMu       sync.Mutex
+	memoryBackends = make(map[string]*MemoryBackend)
+)
+
+// NewMemoryBackend returns an empty MemoryBackend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: make(map[string]*memBucket)}
+}
+
+// OpenMemory is an Opener returning the same MemoryBackend for a path until DropMemory is
+// called, so data persists across Open and Close like it would in a file
+func OpenMemory(path string) (Backend, error) {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	m, ok := memoryBackends[path]
+	if !ok {
+		m = NewMemoryBackend()
+		memoryBackends[path] = m
+	}
+	return m, nil
+}
+
+// DropMemory deletes the MemoryBackend returned by OpenMemory for path
+func DropMemory(path string) {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	delete(memoryBackends, path)
+}
+
+// Update runs fn in a read-write transaction
+func (m *MemoryBackend) Update(fn func(tx BackendTx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &memTx{
+		buckets:  make(map[string]*memBucket, len(m.buckets)),
+		overlays: make(map[string]*memOverlay),
+		writable: true,
+	}
+	for name, b := range m.buckets {
+		tx.buckets[name] = b
+	}
+	// buckets kept past the end of the transaction can't be written
+	defer func() {
+		for _, o := range tx.overlays {
+			o.writable = false
+		}
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	// views are excluded by the lock, so the buckets can be changed in place
+	for _, o := range tx.overlays {
+		o.merge()
+	}
+	m.buckets = tx.buckets
+	return nil
+}
+
+// View runs fn in a read-only transaction
+func (m *MemoryBackend) View(fn func(tx BackendTx) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return fn(&memTx{buckets: m.buckets})
+}
+
+// Close does nothing, the data stays available to the next user of the MemoryBackend
+func (m *MemoryBackend) Close() error {
+	return nil
+}
+
+type memTx struct {
+	buckets  map[string]*memBucket
+	overlays map[string]*memOverlay // changes of a write transaction by bucket
+	writable bool
+}
+
+func (t *memTx) Bucket(name []byte) Bucket {
+	b, ok := t.buckets[string(name)]
+	if !ok {
+		return nil
+	}
+	if !t.writable {
+		return b
+	}
+	o, ok := t.overlays[string(name)]
+	if !ok {
+		o = &memOverlay{
+			base:     b,
+			changes:  make(map[string][]byte),
+			seq:      b.seq,
+			n:        len(b.keys),
+			writable: true,
+		}
+		t.overlays[string(name)] = o
+	}
+	return o
+}
+
+func (t *memTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if !t.writable {
+		return nil, ErrTxNotWritable
+	}
+	if len(name) == 0 {
+		return nil, errors.New("bucket name required")
+	}
+	if _, ok := t.buckets[string(name)]; !ok {
+		t.buckets[string(name)] = &memBucket{values: make(map[string][]byte)}
+	}
+	return t.Bucket(name), nil
+}
+
+func (t *memTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return ErrTxNotWritable
+	}
+	if _, ok := t.buckets[string(name)]; !ok {
+		return ErrBucketMissing
+	}
+	delete(t.buckets, string(name))
+	if o, ok := t.overlays[string(name)]; ok {
+		o.writable = false
+		delete(t.overlays, string(name))
+	}
+	return nil
+}
+
+func (t *memTx) ForEachBucket(fn func(name []byte) error) error {
+	var names []string
+	for name := range t.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn([]byte(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *memTx) Writable() bool {
+	return t.writable
+}
+
+// searchKeys returns the position of the first of the sorted keys greater than or equal to key
+func searchKeys(keys [][]byte, key []byte) int {
+	return sort.Search(len(keys), func(i int) bool {
+		return bytes.Compare(keys[i], key) >= 0
+	})
+}
+
+// keyAt returns keys[i], or nil if i is out of range
+func keyAt(keys [][]byte, i int) []byte {
+	if i < 0 || i >= len(keys) {
+		return nil
+	}
+	return keys[i]
+}
+
+// memBucket is a committed bucket, it is only changed by merging an overlay
+type memBucket struct {
+	keys   [][]byte // sorted
+	values map[string][]byte
+	seq    uint64
+}
+
+// set stores value under key, value isn't copied
+func (b *memBucket) set(key []byte, value []byte) {
+	if _, ok := b.values[string(key)]; !ok {
+		i := searchKeys(b.keys, key)
+		b.keys = append(b.keys, nil)
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = key
+	}
+	b.values[string(key)] = value
+}
+
+// remove deletes key if it exists
+func (b *memBucket) remove(key []byte) {
+	if _, ok := b.values[string(key)]; !ok {
+		return
+	}
+	delete(b.values, string(key))
+	i := searchKeys(b.keys, key)
+	b.keys = append(b.keys[:i], b.keys[i+1:]...)
+}
+
+func (b *memBucket) Get(key []byte) []byte {
+	return b.values[string(key)]
+}
+
+func (b *memBucket) Put(key []byte, value []byte) error {
+	return ErrTxNotWritable
+}
+
+func (b *memBucket) Delete(key []byte) error {
+	return ErrTxNotWritable
+}
+
+func (b *memBucket) Cursor() Cursor {
+	return &memCursor{b: b, pos: -1}
+}
+
+func (b *memBucket) Sequence() uint64 {
+	return b.seq
+}
+
+func (b *memBucket) SetSequence(v uint64) error {
+	return ErrTxNotWritable
+}
+
+func (b *memBucket) NextSequence() (uint64, error) {
+	return 0, ErrTxNotWritable
+}
+
+func (b *memBucket) KeyN() int {
+	return len(b.keys)
+}
+
+type memCursor struct {
+	b   *memBucket
+	pos int
+}
+
+// at moves the cursor to pos and returns the key and value there
+func (c *memCursor) at(pos int) ([]byte, []byte) {
+	if pos < 0 {
+		c.pos = -1
+		return nil, nil
+	}
+	if pos >= len(c.b.keys) {
+		c.pos = len(c.b.keys)
+		return nil, nil
+	}
+	c.pos = pos
+	k := c.b.keys[pos]
+	return k, c.b.values[string(k)]
+}
+
+func (c *memCursor) First() ([]byte, []byte) {
+	return c.at(0)
+}
+
+func (c *memCursor) Last() ([]byte, []byte) {
+	return c.at(len(c.b.keys) - 1)
+}
+
+func (c *memCursor) Next() ([]byte, []byte) {
+	return c.at(c.pos + 1)
+}
+
+func (c *memCursor) Prev() ([]byte, []byte) {
+	return c.at(c.pos - 1)
+}
+
+func (c *memCursor) Seek(seek []byte) ([]byte, []byte) {
+	return c.at(searchKeys(c.b.keys, seek))
+}
+
+// memOverlay is a bucket as seen by a write transaction. Changed keys are kept apart from
+// the committed bucket, so only the keys a transaction touches are copied
+type memOverlay struct {
+	base     *memBucket
+	changes  map[string][]byte // nil values mark deleted keys
+	keys     [][]byte          // sorted keys of changes
+	seq      uint64
+	n        int // number of keys
+	writable bool
+}
+
+// merge applies the changes to the committed bucket
+func (o *memOverlay) merge() {
+	for _, k := range o.keys {
+		if v := o.changes[string(k)]; v != nil {
+			o.base.set(k, v)
+		} else {
+			o.base.remove(k)
+		}
+	}
+	o.base.seq = o.seq
+}
+
+// change records value as the new value of key, nil deletes it
+func (o *memOverlay) change(key []byte, value []byte) {
+	if _, ok := o.changes[string(key)]; !ok {
+		key = append([]byte{}, key...)
+		i := searchKeys(o.keys, key)
+		o.keys = append(o.keys, nil)
+		copy(o.keys[i+1:], o.keys[i:])
+		o.keys[i] = key
+	}
+	o.changes[string(key)] = value
+}
+
+// next returns the first key greater than or equal to key that isn't deleted
+func (o *memOverlay) next(key []byte) []byte {
+	for {
+		k := keyAt(o.base.keys, searchKeys(o.base.keys, key))
+		if ck := keyAt(o.keys, searchKeys(o.keys, key)); k == nil || ck != nil && bytes.Compare(ck, k) < 0 {
+			k = ck
+		}
+		if k == nil || o.Get(k) != nil {
+			return k
+		}
+		key = append(k[:len(k):len(k)], 0)
+	}
+}
+
+// prev returns the last key less than key that isn't deleted, a nil key is past the last key
+func (o *memOverlay) prev(key []byte) []byte {
+	for {
+		i, j := len(o.base.keys), len(o.keys)
+		if key != nil {
+			i, j = searchKeys(o.base.keys, key), searchKeys(o.keys, key)
+		}
+		k := keyAt(o.base.keys, i-1)
+		if ck := keyAt(o.keys, j-1); k == nil || ck != nil && bytes.Compare(ck, k) > 0 {
+			k = ck
+		}
+		if k == nil || o.Get(k) != nil {
+			return k
+		}
+		key = k
+	}
+}
+
+func (o *memOverlay) Get(key []byte) []byte {
+	if v, ok := o.changes[string(key)]; ok {
+		return v
+	}
+	return o.base.Get(key)
+}
+
+func (o *memOverlay) Put(key []byte, value []byte) error {
+	if !o.writable {
+		return ErrTxNotWritable
+	}
+	if len(key) == 0 {
+		return errors.New("key required")
+	}
+	if o.Get(key) == nil {
+		o.n++
+	}
+	// stored slices are never modified, only replaced
+	o.change(key, append([]byte{}, value...))
+	return nil
+}
+
+func (o *memOverlay) Delete(key []byte) error {
+	if !o.writable {
+		return ErrTxNotWritable
+	}
+	if o.Get(key) == nil {
+		return nil
+	}
+	o.n--
+	o.change(key, nil)
+	return nil
+}
+
+func (o *memOverlay) Cursor() Cursor {
+	return &memOverlayCursor{o: o, pos: -1}
+}
+
+func (o *memOverlay) Sequence() uint64 {
+	return o.seq
+}
+
+func (o *memOverlay) SetSequence(v uint64) error {
+	if !o.writable {
+		return ErrTxNotWritable
+	}
+	o.seq = v
+	return nil
+}
+
+func (o *memOverlay) NextSequence() (uint64, error) {
+	if !o.writable {
+		return 0, ErrTxNotWritable
+	}
+	o.seq++
+	return o.seq, nil
+}
+
+func (o *memOverlay) KeyN() int {
+	return o.n
+}
+
+// memOverlayCursor remembers the key it is on rather than a position, since the keys of an
+// overlay can change while iterating
+type memOverlayCursor struct {
+	o   *memOverlay
+	key []byte
+	pos int // -1 before the first key, 1 past the last key, 0 on key
+}
+
+// at moves the cursor to key and returns the key and value there, a nil key moves the
+// cursor to the side given by end
+func (c *memOverlayCursor) at(key []byte, end int) ([]byte, []byte) {
+	c.key = key
+	if key == nil {
+		c.pos = end
+		return nil, nil
+	}
+	c.pos = 0
+	return key, c.o.Get(key)
+}
+
+func (c *memOverlayCursor) First() ([]byte, []byte) {
+	return c.at(c.o.next(nil), 1)
+}
+
+func (c *memOverlayCursor) Last() ([]byte, []byte) {
+	return c.at(c.o.prev(nil), -1)
+}
+
+func (c *memOverlayCursor) Next() ([]byte, []byte) {
+	switch c.pos {
+	case -1:
+		return c.First()
+	case 1:
+		return nil, nil
+	}
+	return c.at(c.o.next(append(c.key[:len(c.key):len(c.key)], 0)), 1)
+}
+
+func (c *memOverlayCursor) Prev() ([]byte, []byte) {
+	switch c.pos {
+	case 1:
+		return c.Last()
+	case -1:
+		return nil, nil
+	}
+	return c.at(c.o.prev(c.key), -1)
+}
+
+func (c *memOverlayCursor) Seek(seek []byte) ([]byte, []byte) {
+	return c.at(c.o.next(seek), 1)
+}
@@ -0,0 +1,266 @@
+// +build all travis
+
+package database
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	s, err := NewStore(NewMemoryBackend(), testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.DB() != nil {
+		t.Fatal("memory store returned a bolt database")
+	}
+
+	for i := 10; i >= -5; i-- {
+		if err := s.Save(testBucket, i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := s.Range(testBucket, -2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("expected 5 records, got %d", len(records))
+	}
+	for i, record := range records {
+		id, err := record.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != i-2 {
+			t.Fatalf("records out of order: %d at %d", id, i)
+		}
+	}
+
+	records, cursor, err := s.Page(testBucket, nil, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, cursor, err = s.Page(testBucket, cursor, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || cursor != nil {
+		t.Fatalf("expected a last page of 6 records, got %d", len(records))
+	}
+
+	id, err := s.Insert(testBucket, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 11 {
+		t.Fatalf("expected id 11, got %d", id)
+	}
+
+	// failed transactions leave no trace
+	errAbort := errors.New("abort")
+	err = s.Update(func(tx *Tx) error {
+		if err := tx.Delete(testBucket, 1); err != nil {
+			return err
+		}
+		if err := tx.Save([]byte("other"), 1, 1); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("expected errAbort, got %v", err)
+	}
+	if _, err := s.Retrieve(testBucket, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Retrieve([]byte("other"), 1); err != ErrBucketMissing {
+		t.Fatalf("expected ErrBucketMissing, got %v", err)
+	}
+
+	err = s.View(func(tx *Tx) error {
+		return tx.Save(testBucket, 1, 1)
+	})
+	if errors.Cause(err) != ErrTxNotWritable {
+		t.Fatalf("expected ErrTxNotWritable, got %v", err)
+	}
+
+	accounts := []byte("accounts")
+	keyring, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EncryptBucket(accounts, keyring); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddIndex(accounts, Index{Name: "email", Field: "Email", Unique: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(accounts, testAccount{Index: 1, Email: "a@test.com"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save(accounts, testAccount{Index: 2, Email: "a@test.com"}, 2)
+	if errors.Cause(err) != ErrUniqueViolation {
+		t.Fatalf("expected ErrUniqueViolation, got %v", err)
+	}
+	record, err := s.FindOneBy(accounts, "email", []byte("a@test.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := record.ID(); id != 1 {
+		t.Fatalf("unexpected record: %d", id)
+	}
+
+	var buf bytes.Buffer
+	_, err = s.Backup(&buf, BackupOptions{})
+	if err != ErrNotSupported || buf.Len() != 0 {
+		t.Fatalf("expected ErrNotSupported and no output, got %v and %d bytes", err, buf.Len())
+	}
+}
+
+func TestOpenMemory(t *testing.T) {
+	SetBackend(OpenMemory)
+	defer SetBackend(OpenBolt)
+	defer DropMemory("/memory.db")
+
+	// the functions taking a path use the memory backend, no file is created
+	if err := Save("/memory.db", testBucket, "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	x, err := Retrieve("/memory.db", testBucket, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(x) != `"x"` {
+		t.Fatalf("unexpected value: %s", x)
+	}
+
+	DropMemory("/memory.db")
+	if _, err := Retrieve("/memory.db", testBucket, 1); err != ErrBucketMissing {
+		t.Fatalf("expected ErrBucketMissing, got %v", err)
+	}
+}
+
+func TestMemoryOverlay(t *testing.T) {
+	m := NewMemoryBackend()
+	name := []byte("bucket")
+	err := m.Update(func(tx BackendTx) error {
+		b, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"b", "d", "f", "h"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keys changed in a transaction are merged with the committed keys while iterating
+	keys := func(b Bucket, reverse bool) string {
+		var s string
+		c := b.Cursor()
+		k, v := c.First()
+		if reverse {
+			k, v = c.Last()
+		}
+		for k != nil {
+			if !bytes.Equal(k, v) {
+				t.Fatalf("unexpected value %s for %s", v, k)
+			}
+			s += string(k)
+			if reverse {
+				k, v = c.Prev()
+			} else {
+				k, v = c.Next()
+			}
+		}
+		return s
+	}
+	errAbort := errors.New("abort")
+	err = m.Update(func(tx BackendTx) error {
+		b := tx.Bucket(name)
+		for _, k := range []string{"a", "c", "i"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		for _, k := range []string{"b", "f", "x"} {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		if s := keys(b, false); s != "acdhi" {
+			t.Fatalf("unexpected keys: %s", s)
+		}
+		if s := keys(b, true); s != "ihdca" {
+			t.Fatalf("unexpected keys in reverse: %s", s)
+		}
+		if b.KeyN() != 5 {
+			t.Fatalf("expected 5 keys, got %d", b.KeyN())
+		}
+		c := b.Cursor()
+		if k, _ := c.Seek([]byte("e")); string(k) != "h" {
+			t.Fatalf("expected to seek to h, got %s", k)
+		}
+		if k, _ := c.Prev(); string(k) != "d" {
+			t.Fatalf("expected d before h, got %s", k)
+		}
+		if k, _ := c.Seek([]byte("j")); k != nil {
+			t.Fatalf("expected to seek past the last key, got %s", k)
+		}
+		if k, _ := c.Prev(); string(k) != "i" {
+			t.Fatalf("expected i as the last key, got %s", k)
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("expected errAbort, got %v", err)
+	}
+
+	// the aborted transaction left the bucket untouched
+	err = m.View(func(tx BackendTx) error {
+		if s := keys(tx.Bucket(name), false); s != "bdfh" {
+			t.Fatalf("unexpected keys after abort: %s", s)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kept Bucket
+	err = m.Update(func(tx BackendTx) error {
+		kept = tx.Bucket(name)
+		if err := kept.Delete([]byte("d")); err != nil {
+			return err
+		}
+		return kept.Put([]byte("e"), []byte("e"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kept.Put([]byte("z"), nil); err != ErrTxNotWritable {
+		t.Fatalf("expected ErrTxNotWritable, got %v", err)
+	}
+	err = m.View(func(tx BackendTx) error {
+		b := tx.Bucket(name)
+		if s := keys(b, false); s != "befh" || b.KeyN() != 4 {
+			t.Fatalf("unexpected keys after commit: %s", s)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
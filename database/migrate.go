@@ -0,0 +1,256 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Migrations transform the data of a database when the structs stored in it change. Each
+// migration has a version, migrations are applied in order of their versions and the version
+// of the last applied migration is stored in the meta bucket.
+
+// Migration is a numbered change to the data stored in a database
+type Migration struct {
+	// Version orders the migrations, versions must be positive and unique
+	Version int
+	// Name describes the migration in logs
+	Name string
+	// Up applies the migration, returning an error rolls it back
+	Up func(tx *Tx) error
+}
+
+// MigrationMode controls whether CreateDB runs pending migrations
+type MigrationMode int
+
+const (
+	// MigrateOff doesn't run migrations
+	MigrateOff MigrationMode = iota
+	// MigrateDryRun runs pending migrations and rolls them back, reporting errors
+	MigrateDryRun
+	// MigrateApply runs and commits pending migrations
+	MigrateApply
+)
+
+// StartupMigrations is the MigrationMode used by CreateDB
+var StartupMigrations = MigrateOff
+
+// SetStartupMigrations sets the MigrationMode used by CreateDB
+func SetStartupMigrations(mode MigrationMode) {
+	StartupMigrations = mode
+}
+
+// schemaVersionKey is the key of the schema version in metaBucket
+var schemaVersionKey = []byte("schema_version")
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = make(map[int]Migration)
+)
+
+// RegisterMigration adds a migration to the registry. It panics if the version is already
+// registered, so it is meant to be called from init functions
+func RegisterMigration(m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	if m.Version <= 0 {
+		panic("database: migration version must be positive")
+	}
+	if m.Up == nil {
+		panic("database: migration " + strconv.Itoa(m.Version) + " has no Up function")
+	}
+	if _, dup := migrations[m.Version]; dup {
+		panic("database: RegisterMigration called twice for version " + strconv.Itoa(m.Version))
+	}
+	migrations[m.Version] = m
+}
+
+// Migrations returns the registered migrations sorted by version
+func Migrations() []Migration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	var arr []Migration
+	for _, m := range migrations {
+		arr = append(arr, m)
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Version < arr[j].Version
+	})
+	return arr
+}
+
+// SchemaVersion returns the version of the last migration applied in the transaction, 0 if
+// none has been applied
+func (tx *Tx) SchemaVersion() (int, error) {
+	meta := tx.tx.Bucket(metaBucket)
+	if meta == nil {
+		return 0, nil
+	}
+	x := meta.Get(schemaVersionKey)
+	if x == nil {
+		return 0, nil
+	}
+	return DecodeKey(x)
+}
+
+// setSchemaVersion records the version of the last applied migration
+func (tx *Tx) setSchemaVersion(version int) error {
+	meta, err := tx.tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	return meta.Put(schemaVersionKey, EncodeKey(version))
+}
+
+// SchemaVersion returns the version of the last migration applied to the database
+func (s *Store) SchemaVersion() (int, error) {
+	var version int
+	err := s.View(func(tx *Tx) error {
+		var err error
+		version, err = tx.SchemaVersion()
+		return err
+	})
+	return version, err
+}
+
+// pending returns the registered migrations newer than version
+func pending(version int) []Migration {
+	var arr []Migration
+	for _, m := range Migrations() {
+		if m.Version > version {
+			arr = append(arr, m)
+		}
+	}
+	return arr
+}
+
+// Migrate runs the registered migrations that haven't been applied yet and returns them.
+// Each migration runs in its own transaction, so the migrations before a failing one stay
+// applied. With dryRun set all pending migrations run in a single transaction that is rolled
+// back, which checks that they succeed without changing the database
+func (s *Store) Migrate(dryRun bool) ([]Migration, error) {
+	if dryRun {
+		var arr []Migration
+		err := s.Update(func(tx *Tx) error {
+			version, err := tx.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			arr = pending(version)
+			for _, m := range arr {
+				if err := applyMigration(tx, m); err != nil {
+					return err
+				}
+			}
+			return errDryRun
+		})
+		if err != errDryRun {
+			return arr, err
+		}
+		return arr, nil
+	}
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range pending(version) {
+		skipped := false
+		err := s.Update(func(tx *Tx) error {
+			// another process may have migrated the database since the version was read
+			version, err := tx.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			if version >= m.Version {
+				skipped = true
+				return nil
+			}
+			return applyMigration(tx, m)
+		})
+		if err != nil {
+			return applied, err
+		}
+		if skipped {
+			continue
+		}
+		logger.Info("applied migration", logger.F("version", m.Version), logger.F("name", m.Name))
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// applyMigration runs a migration and records its version
+func applyMigration(tx *Tx, m Migration) error {
+	if err := m.Up(tx); err != nil {
+		logger.Error("migration failed", logger.F("version", m.Version), logger.F("name", m.Name), logger.Err(err))
+		return errors.Wrap(err, "migration "+strconv.Itoa(m.Version)+" "+m.Name+" failed")
+	}
+	return tx.setSchemaVersion(m.Version)
+}
+
+// runStartupMigrations runs pending migrations on a database opened by CreateDB according to
+// StartupMigrations
+func runStartupMigrations(db *bolt.DB) error {
+	if StartupMigrations == MigrateOff {
+		return nil
+	}
+
+	s := newStore(NewBoltBackend(db), db.Path())
+	if err := s.migrateAll(); err != nil {
+		return errors.Wrap(err, "could not migrate database keys")
+	}
+
+	dryRun := StartupMigrations == MigrateDryRun
+	arr, err := s.Migrate(dryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		for _, m := range arr {
+			logger.Info("dry run: migration would be applied", logger.F("version", m.Version), logger.F("name", m.Name))
+		}
+	}
+	return nil
+}
+
+// Transform replaces every value of a bucket with the value returned by fn, deleting the
+// record if fn returns nil. Indexes of the bucket are kept up to date. This is meant for
+// migrations changing the JSON stored in a bucket
+func (tx *Tx) Transform(bucketName []byte, fn func(key int, value []byte) ([]byte, error)) error {
+	records, _, err := tx.Find(bucketName, Query{})
+	if err != nil {
+		return err
+	}
+
+	b := tx.tx.Bucket(bucketName)
+	for _, record := range records {
+		key, err := record.ID()
+		if err != nil {
+			return err
+		}
+		value, err := fn(key, record.Value)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			err = tx.delete(b, bucketName, record.Key)
+		} else {
+			err = tx.put(b, bucketName, record.Key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// +build all travis
+
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMigrate(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+	defer func() {
+		migrations = make(map[int]Migration)
+		SetStartupMigrations(MigrateOff)
+	}()
+
+	users := []byte("users")
+	db, err := CreateDB("test_files/migrate.db", users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	err = Save("test_files/migrate.db", users, map[string]string{"Name": "alice"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rename Name to Username
+	RegisterMigration(Migration{Version: 1, Name: "rename name", Up: func(tx *Tx) error {
+		return tx.Transform(users, func(key int, value []byte) ([]byte, error) {
+			var user map[string]string
+			if err := json.Unmarshal(value, &user); err != nil {
+				return nil, err
+			}
+			user["Username"] = user["Name"]
+			delete(user, "Name")
+			return json.Marshal(user)
+		})
+	}})
+	RegisterMigration(Migration{Version: 2, Name: "add bucket", Up: func(tx *Tx) error {
+		return tx.CreateBucket([]byte("groups"))
+	}})
+
+	SetStartupMigrations(MigrateDryRun)
+	db, err = CreateDB("test_files/migrate.db", users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := Open("test_files/migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Fatalf("dry run applied migrations")
+	}
+	s.Close()
+
+	SetStartupMigrations(MigrateApply)
+	db, err = CreateDB("test_files/migrate.db", users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err = Open("test_files/migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	version, err = s.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Fatalf("expected version 2, got %d", version)
+	}
+	x, err := s.Retrieve(users, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(x) != `{"Username":"alice"}` {
+		t.Fatalf("unexpected record: %s", x)
+	}
+
+	// applied migrations don't run again, failing ones are rolled back
+	errFail := errors.New("fail")
+	RegisterMigration(Migration{Version: 3, Name: "fail", Up: func(tx *Tx) error {
+		if err := tx.Save(users, "x", 2); err != nil {
+			return err
+		}
+		return errFail
+	}})
+	applied, err := s.Migrate(false)
+	if errors.Cause(err) != errFail {
+		t.Fatalf("expected errFail, got %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected no applied migrations, got %d", len(applied))
+	}
+	if _, err := s.Retrieve(users, 2); err != ErrElementNotFound {
+		t.Fatalf("failed migration wasn't rolled back: %v", err)
+	}
+	version, err = s.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Fatalf("expected version 2, got %d", version)
+	}
+
+	// concurrent Migrate calls apply each migration once
+	delete(migrations, 3)
+	var runs int32
+	RegisterMigration(Migration{Version: 3, Name: "count", Up: func(tx *Tx) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Migrate(false); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runs != 1 {
+		t.Fatalf("expected 1 run, got %d", runs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate migration registered")
+		}
+	}()
+	RegisterMigration(Migration{Version: 1, Up: func(tx *Tx) error { return nil }})
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"bytes"
+)
+
+// Record is a key value pair read from a bucket
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+// ID decodes the key of the record with DecodeKey
+func (r Record) ID() (int, error) {
+	return DecodeKey(r.Key)
+}
+
+// Query selects the records of a bucket by their raw keys. All fields are optional
+type Query struct {
+	Start   []byte // first key to return, inclusive
+	End     []byte // key to stop at, exclusive
+	Prefix  []byte // only return keys with this prefix
+	After   []byte // cursor returned by a previous query, iteration continues past it
+	Reverse bool   // iterate from the largest key down
+	Limit   int    // maximum number of records to return, 0 means no limit
+}
+
+// match reports whether k satisfies all bounds of the query
+func (q Query) match(k []byte) bool {
+	if q.Start != nil && bytes.Compare(k, q.Start) < 0 {
+		return false
+	}
+	if q.End != nil && bytes.Compare(k, q.End) >= 0 {
+		return false
+	}
+	if !bytes.HasPrefix(k, q.Prefix) {
+		return false
+	}
+	if q.After != nil {
+		c := bytes.Compare(k, q.After)
+		if (!q.Reverse && c <= 0) || (q.Reverse && c >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// first positions the cursor at the first key the query could return
+func (q Query) first(c Cursor) ([]byte, []byte) {
+	if q.Reverse {
+		// seek to the smallest exclusive upper bound and step back
+		upper := minKey(minKey(q.End, prefixEnd(q.Prefix)), q.After)
+		if upper == nil {
+			return c.Last()
+		}
+		if k, _ := c.Seek(upper); k == nil {
+			return c.Last()
+		}
+		return c.Prev()
+	}
+
+	lower := q.Start
+	if bytes.Compare(q.Prefix, lower) > 0 {
+		lower = q.Prefix
+	}
+	if q.After != nil && bytes.Compare(q.After, lower) >= 0 {
+		k, v := c.Seek(q.After)
+		if bytes.Equal(k, q.After) {
+			return c.Next()
+		}
+		return k, v
+	}
+	if lower == nil {
+		return c.First()
+	}
+	return c.Seek(lower)
+}
+
+// next advances the cursor in the direction of the query
+func (q Query) next(c Cursor) ([]byte, []byte) {
+	if q.Reverse {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// minKey returns the smaller of two keys, where nil is unbounded
+func minKey(a, b []byte) []byte {
+	if a == nil {
+		return b
+	}
+	if b == nil || bytes.Compare(a, b) < 0 {
+		return a
+	}
+	return b
+}
+
+// prefixEnd returns the smallest key greater than every key with the prefix, or nil if there
+// is none
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// find runs a query on bucket, leaving out the keys skip returns true for if it isn't nil. The
+// returned cursor is the key of the last record if more records match the query, and nil
+// otherwise
+func find(b Bucket, q Query, skip func(k []byte) bool) ([]Record, []byte) {
+	var records []Record
+	c := b.Cursor()
+	for k, v := q.first(c); k != nil && q.match(k); k, v = q.next(c) {
+		if v == nil || (skip != nil && skip(k)) {
+			// nested bucket or skipped key
+			continue
+		}
+		if q.Limit > 0 && len(records) == q.Limit {
+			return records, records[len(records)-1].Key
+		}
+		records = append(records, Record{
+			Key:   append([]byte{}, k...),
+			Value: append([]byte{}, v...),
+		})
+	}
+	return records, nil
+}
+
+// Find returns the records of bucket matching the query, and a cursor that can be passed as
+// After to fetch the next page. The cursor is nil once there are no more records
+func (s *Store) Find(bucket []byte, q Query) ([]Record, []byte, error) {
+	var records []Record
+	var cursor []byte
+	err := s.View(func(tx *Tx) error {
+		var err error
+		records, cursor, err = tx.Find(bucket, q)
+		return err
+	})
+	return records, cursor, err
+}
+
+// Range returns the records with keys from start up to but not including end
+func (s *Store) Range(bucket []byte, start, end int) ([]Record, error) {
+	records, _, err := s.Find(bucket, Query{Start: EncodeKey(start), End: EncodeKey(end)})
+	return records, err
+}
+
+// Prefix returns the records whose raw keys start with prefix
+func (s *Store) Prefix(bucket []byte, prefix []byte) ([]Record, error) {
+	records, _, err := s.Find(bucket, Query{Prefix: prefix})
+	return records, err
+}
+
+// Reverse returns up to limit records starting from the largest key
+func (s *Store) Reverse(bucket []byte, limit int) ([]Record, error) {
+	records, _, err := s.Find(bucket, Query{Reverse: true, Limit: limit})
+	return records, err
+}
+
+// Page returns up to limit records following the cursor returned by the previous page, or
+// the first page if cursor is nil
+func (s *Store) Page(bucket []byte, cursor []byte, limit int, reverse bool) ([]Record, []byte, error) {
+	return s.Find(bucket, Query{After: cursor, Limit: limit, Reverse: reverse})
+}
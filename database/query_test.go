@@ -0,0 +1,208 @@
+// +build all travis
+
+package database
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestKeys(t *testing.T) {
+	keys := []int{-1 << 62, -10, -1, 0, 1, 2, 10, 11, 1 << 62}
+	for i, key := range keys {
+		decoded, err := DecodeKey(EncodeKey(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != key {
+			t.Fatalf("expected %d, got %d", key, decoded)
+		}
+		if i > 0 && bytes.Compare(EncodeKey(keys[i-1]), EncodeKey(key)) >= 0 {
+			t.Fatalf("%d doesn't sort before %d", keys[i-1], key)
+		}
+	}
+
+	_, err := DecodeKey([]byte("10"))
+	if err != ErrInvalidKey {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	// write buckets the way older versions did
+	db, err := bolt.Open("test_files/legacy.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(testBucket)
+		if err != nil {
+			return err
+		}
+		for i := 1; i <= 12; i++ {
+			if err := b.Put([]byte(strconv.Itoa(i)), []byte(strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+		other, err := tx.CreateBucket([]byte("other"))
+		if err != nil {
+			return err
+		}
+		return other.Put([]byte("name"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// read only stores can't migrate and would miss every key
+	if _, err := OpenReadOnly("test_files/legacy.db"); err != ErrNotMigrated {
+		t.Fatalf("expected ErrNotMigrated, got %v", err)
+	}
+
+	s, err := Open("test_files/legacy.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	x, err := s.Retrieve(testBucket, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(x) != "11" {
+		t.Fatalf("expected 11, got %s", x)
+	}
+
+	arr, err := s.RetrieveAllKeys(testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range arr {
+		if string(x) != strconv.Itoa(i+1) {
+			t.Fatalf("keys out of order: %s at %d", x, i)
+		}
+	}
+
+	n, err := s.MigrateKeys(testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("bucket migrated twice")
+	}
+	// later opens only check that the migration ran
+	if migrated, err := s.keysMigrated(); err != nil || !migrated {
+		t.Fatalf("migration wasn't recorded: %v", err)
+	}
+
+	// buckets with other keys are left alone
+	_, err = s.MigrateKeys([]byte("other"))
+	if err == nil {
+		t.Fatal("migrated bucket with non integer keys")
+	}
+	records, err := s.Prefix([]byte("other"), []byte("na"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || string(records[0].Value) != "value" {
+		t.Fatalf("unexpected records: %v", records)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	s, err := Open("test_files/query.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := -5; i < 25; i++ {
+		if err := s.Save(testBucket, i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(records []Record) []int {
+		var arr []int
+		for _, record := range records {
+			id, err := record.ID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			arr = append(arr, id)
+		}
+		return arr
+	}
+	expect := func(records []Record, start, step, n int) {
+		arr := ids(records)
+		if len(arr) != n {
+			t.Fatalf("expected %d records, got %v", n, arr)
+		}
+		for i, id := range arr {
+			if id != start+i*step {
+				t.Fatalf("unexpected records: %v", arr)
+			}
+		}
+	}
+
+	records, err := s.Range(testBucket, -2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(records, -2, 1, 12)
+
+	records, err = s.Reverse(testBucket, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(records, 24, -1, 3)
+
+	records, _, err = s.Find(testBucket, Query{Start: EncodeKey(0), End: EncodeKey(10), Reverse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(records, 9, -1, 10)
+
+	// page through all records in both directions
+	for _, reverse := range []bool{false, true} {
+		var all []Record
+		var cursor []byte
+		pages := 0
+		for {
+			records, next, err := s.Page(testBucket, cursor, 7, reverse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, records...)
+			pages++
+			if next == nil {
+				break
+			}
+			cursor = next
+		}
+		if pages != 5 {
+			t.Fatalf("expected 5 pages, got %d", pages)
+		}
+		if reverse {
+			expect(all, 24, -1, 30)
+		} else {
+			expect(all, -5, 1, 30)
+		}
+	}
+
+	_, _, err = s.Find([]byte("missing"), Query{})
+	if err != ErrBucketMissing {
+		t.Fatalf("expected ErrBucketMissing, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Decoder decodes a value stored in a bucket
+type Decoder func(data []byte) (interface{}, error)
+
+// Repository stores JSON encoded values of a single type in a bucket, so callers don't have
+// to unmarshal what they retrieve
+type Repository struct {
+	store  *Store
+	bucket []byte
+	decode Decoder
+}
+
+// NewRepository returns a Repository for bucket decoding values into new values of the type
+// of prototype. Get and List return pointers, eg. a prototype of User{} or &User{} makes them
+// return *User
+func NewRepository(store *Store, bucket []byte, prototype interface{}) (*Repository, error) {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		return nil, errors.New("prototype can't be nil")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return NewRepositoryWithDecoder(store, bucket, func(data []byte) (interface{}, error) {
+		x := reflect.New(t).Interface()
+		if err := json.Unmarshal(data, x); err != nil {
+			return nil, err
+		}
+		return x, nil
+	})
+}
+
+// NewRepositoryWithDecoder returns a Repository for bucket decoding values with decode
+func NewRepositoryWithDecoder(store *Store, bucket []byte, decode Decoder) (*Repository, error) {
+	if store == nil || decode == nil {
+		return nil, errors.New("store and decoder can't be nil")
+	}
+	if err := store.CreateBuckets(bucket); err != nil {
+		return nil, err
+	}
+	return &Repository{store: store, bucket: bucket, decode: decode}, nil
+}
+
+// Bucket returns the name of the bucket the Repository stores values in
+func (r *Repository) Bucket() []byte {
+	return r.bucket
+}
+
+// Get retrieves and decodes the value stored under key
+func (r *Repository) Get(key int) (interface{}, error) {
+	data, err := r.store.Retrieve(r.bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeValue(data)
+}
+
+// decodeValue decodes a stored value
+func (r *Repository) decodeValue(data []byte) (interface{}, error) {
+	x, err := r.decode(data)
+	if err != nil {
+		logger.Error("could not decode value", logger.Err(err))
+		return nil, errors.Wrap(err, "could not decode value")
+	}
+	return x, nil
+}
+
+// decodeRecords decodes the values of records
+func (r *Repository) decodeRecords(records []Record) ([]interface{}, error) {
+	arr := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		x, err := r.decodeValue(record.Value)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, x)
+	}
+	return arr, nil
+}
+
+// Put stores x under key
+func (r *Repository) Put(key int, x interface{}) error {
+	return r.store.Save(r.bucket, x, key)
+}
+
+// Insert stores x under a new key from NextID and returns the key
+func (r *Repository) Insert(x interface{}) (int, error) {
+	return r.store.Insert(r.bucket, x)
+}
+
+// Delete deletes the value stored under key, returning ErrElementNotFound if there is none
+func (r *Repository) Delete(key int) error {
+	return r.store.Update(func(tx *Tx) error {
+		if _, err := tx.Retrieve(r.bucket, key); err != nil {
+			return err
+		}
+		return tx.Delete(r.bucket, key)
+	})
+}
+
+// List retrieves and decodes all values in the bucket
+func (r *Repository) List() ([]interface{}, error) {
+	arr, _, err := r.Find(Query{})
+	return arr, err
+}
+
+// Count returns the number of values in the bucket
+func (r *Repository) Count() (int, error) {
+	return r.store.RetrieveAllKeysLim(r.bucket)
+}
+
+// Find returns the decoded values matching the query and the cursor of the next page, see
+// Store.Find
+func (r *Repository) Find(q Query) ([]interface{}, []byte, error) {
+	records, cursor, err := r.store.Find(r.bucket, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	arr, err := r.decodeRecords(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	return arr, cursor, nil
+}
+
+// Range returns the decoded values with keys from start up to but not including end
+func (r *Repository) Range(start, end int) ([]interface{}, error) {
+	arr, _, err := r.Find(Query{Start: EncodeKey(start), End: EncodeKey(end)})
+	return arr, err
+}
+
+// Page returns up to limit decoded values following cursor, and the cursor of the next page
+func (r *Repository) Page(cursor []byte, limit int, reverse bool) ([]interface{}, []byte, error) {
+	return r.Find(Query{After: cursor, Limit: limit, Reverse: reverse})
+}
+
+// AddIndex adds an index to the bucket of the Repository, see Store.AddIndex
+func (r *Repository) AddIndex(idx Index) error {
+	return r.store.AddIndex(r.bucket, idx)
+}
+
+// FindBy returns the decoded values whose value for the named index is value
+func (r *Repository) FindBy(name string, value []byte) ([]interface{}, error) {
+	records, err := r.store.FindBy(r.bucket, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeRecords(records)
+}
+
+// FindOneBy returns the first decoded value whose value for the named index is value, or
+// ErrElementNotFound
+func (r *Repository) FindOneBy(name string, value []byte) (interface{}, error) {
+	record, err := r.store.FindOneBy(r.bucket, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeValue(record.Value)
+}
@@ -0,0 +1,115 @@
+// +build all travis
+
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+type testUser struct {
+	Index int
+	Name  string
+}
+
+func TestRepository(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	s, err := Open("test_files/repo.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, err = NewRepository(s, []byte("users"), nil)
+	if err == nil {
+		t.Fatal("nil prototype accepted")
+	}
+
+	users, err := NewRepository(s, []byte("users"), testUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		err = users.Put(i, testUser{Index: i, Name: "user"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	x, err := users.Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, ok := x.(*testUser)
+	if !ok || user.Index != 2 || user.Name != "user" {
+		t.Fatalf("unexpected value: %#v", x)
+	}
+
+	_, err = users.Get(4)
+	if err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+
+	list, err := users.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("expected 3 users, got %d", len(list))
+	}
+	for _, x := range list {
+		if _, ok := x.(*testUser); !ok {
+			t.Fatalf("unexpected value: %#v", x)
+		}
+	}
+
+	err = users.Delete(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.Delete(2)
+	if err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+
+	count, err := users.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 users, got %d", count)
+	}
+
+	names, err := NewRepositoryWithDecoder(s, []byte("users"), func(data []byte) (interface{}, error) {
+		var user testUser
+		err := json.Unmarshal(data, &user)
+		return user.Name, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err = names.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.(string) != "user" {
+		t.Fatalf("unexpected value: %#v", x)
+	}
+
+	err = s.DB().Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("users"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.List()
+	if err != ErrBucketMissing {
+		t.Fatalf("expected ErrBucketMissing, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// SnapshotExt is the extension of the snapshot files written by Snapshot
+const SnapshotExt = ".snap"
+
+// snapshotLayout formats the time in snapshot names so that they sort chronologically
+const snapshotLayout = "20060102T150405.000000000Z"
+
+// Snapshot writes a backup of the database to a new timestamped file in dir and returns its
+// name
+func (s *Store) Snapshot(dir string, opts BackupOptions) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		logger.Error("could not create snapshot directory", logger.Err(err))
+		return "", errors.Wrap(err, "could not create snapshot directory")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path))
+	filename := filepath.Join(dir, name+"-"+time.Now().UTC().Format(snapshotLayout)+SnapshotExt)
+	if err := s.BackupFile(filename, opts); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// Snapshots returns the snapshots of the database in dir, oldest first
+func (s *Store) Snapshots(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logger.Error("could not read snapshot directory", logger.Err(err))
+		return nil, errors.Wrap(err, "could not read snapshot directory")
+	}
+
+	prefix := strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path)) + "-"
+	var snapshots []string
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, SnapshotExt) {
+			continue
+		}
+		// the snapshots of foo-bar.db also start with foo-
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), SnapshotExt)
+		if _, err := time.Parse(snapshotLayout, stamp); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, filepath.Join(dir, name))
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes all but the newest keep snapshots of the database in dir
+func (s *Store) PruneSnapshots(dir string, keep int) error {
+	snapshots, err := s.Snapshots(dir)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(snapshots)-keep; i++ {
+		if err := os.Remove(snapshots[i]); err != nil {
+			logger.Error("could not delete snapshot", logger.Err(err))
+			return errors.Wrap(err, "could not delete snapshot")
+		}
+	}
+	return nil
+}
+
+// Scheduler runs a task of a Store periodically, such as taking snapshots or sweeping
+// expired records
+type Scheduler struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// ScheduleSnapshots takes a snapshot of the database in dir every interval, keeping the
+// newest keep snapshots (all of them if keep is 0). Errors are logged and the next snapshot
+// is attempted as usual. Stop must be called before the Store is closed
+func (s *Store) ScheduleSnapshots(dir string, interval time.Duration, keep int, opts BackupOptions) *Scheduler {
+	return s.schedule(interval, func() {
+		if _, err := s.Snapshot(dir, opts); err != nil {
+			logger.Error("could not take snapshot", logger.Err(err))
+			return
+		}
+		if keep > 0 {
+			if err := s.PruneSnapshots(dir, keep); err != nil {
+				logger.Error("could not prune snapshots", logger.Err(err))
+			}
+		}
+	})
+}
+
+// schedule calls fn every interval until the returned Scheduler is stopped
+func (s *Store) schedule(interval time.Duration, fn func()) *Scheduler {
+	sc := &Scheduler{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sc.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sc.stop:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+
+	return sc
+}
+
+// Stop stops the Scheduler, waiting for a run in progress to finish
+func (sc *Scheduler) Stop() {
+	sc.once.Do(func() {
+		close(sc.stop)
+	})
+	<-sc.done
+}
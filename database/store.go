@@ -0,0 +1,293 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Store is a long lived handle to a database, stored in bolt unless another Backend is set.
+// Bolt allows only one handle per file, so Open returns the same Store to every caller asking
+// for the same path and the database is closed when the last of them calls Close. A Store is
+// safe for concurrent use
+type Store struct {
+	backend Backend
+	path    string
+	refs    int // guarded by storesMu
+
+	// ready is closed once Open has opened the backend, openErr is set if that failed
+	ready   chan struct{}
+	openErr error
+
+	indexMu sync.RWMutex
+	indexes map[string][]Index
+
+	encMu    sync.RWMutex
+	keyrings map[string]*Keyring
+
+	watchMu  sync.RWMutex
+	watchers map[string]map[*Subscription]struct{}
+
+	// writeMu is held from the start of Update until its events are published, so that
+	// subscribers receive events in commit order
+	writeMu sync.Mutex
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]*Store)
+)
+
+// Open opens the database at dir, creating it and the passed buckets if they don't exist.
+// Every call to Open must be paired with a call to Close. Open fails after OpenTimeout if
+// another process holds the database open
+func Open(dir string, buckets ...[]byte) (*Store, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve database path")
+	}
+
+	// the backend is opened without holding storesMu since opening may block on the file
+	// lock, callers opening the same path meanwhile wait for ready
+	storesMu.Lock()
+	s, ok := stores[path]
+	if !ok {
+		s = newStore(nil, path)
+		s.ready = make(chan struct{})
+		stores[path] = s
+	}
+	s.refs++
+	storesMu.Unlock()
+
+	if ok {
+		<-s.ready
+	} else {
+		s.openErr = s.open()
+		if s.openErr != nil {
+			storesMu.Lock()
+			delete(stores, path)
+			storesMu.Unlock()
+		}
+		close(s.ready)
+	}
+	if s.openErr != nil {
+		return nil, s.openErr
+	}
+
+	if err := s.CreateBuckets(buckets...); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the backend of a Store returned by Open and migrates its keys
+func (s *Store) open() error {
+	backend, err := OpenBackend(s.path)
+	if err != nil {
+		logger.Error("couldn't open database", logger.Err(err))
+		return errors.Wrap(err, "could not open database")
+	}
+	s.backend = backend
+	if err := s.migrateAll(); err != nil {
+		backend.Close()
+		logger.Error("could not migrate database keys", logger.Err(err))
+		return errors.Wrap(err, "could not migrate database keys")
+	}
+	return nil
+}
+
+// OpenReadOnly opens the database at dir for reading only, failing after OpenTimeout if
+// another process holds it open for writing. The database isn't created and its keys aren't
+// migrated, databases written by older versions fail with ErrNotMigrated until they have
+// been opened with Open. The Store isn't shared with Open, closing it closes the database
+func OpenReadOnly(dir string) (*Store, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve database path")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: OpenTimeout, ReadOnly: true})
+	if err != nil {
+		logger.Error("couldn't open database", logger.Err(err))
+		return nil, errors.Wrap(err, "could not open database")
+	}
+	s := newStore(NewBoltBackend(db), path)
+	s.refs = 1
+	if err := s.checkMigrated(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewStore returns a Store using backend, creating the passed buckets if they don't exist.
+// The Store isn't shared with Open, closing it closes the backend
+func NewStore(backend Backend, buckets ...[]byte) (*Store, error) {
+	s := newStore(backend, "")
+	s.refs = 1
+	if err := s.migrateAll(); err != nil {
+		logger.Error("could not migrate database keys", logger.Err(err))
+		return nil, errors.Wrap(err, "could not migrate database keys")
+	}
+	if err := s.CreateBuckets(buckets...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newStore returns a Store for an open database
+func newStore(backend Backend, path string) *Store {
+	return &Store{
+		backend:  backend,
+		path:     path,
+		indexes:  make(map[string][]Index),
+		keyrings: make(map[string]*Keyring),
+	}
+}
+
+// Close releases the Store, closing the database once every caller of Open has released it
+func (s *Store) Close() error {
+	storesMu.Lock()
+	if s.refs == 0 {
+		storesMu.Unlock()
+		return ErrStoreClosed
+	}
+	s.refs--
+	if s.refs > 0 {
+		storesMu.Unlock()
+		return nil
+	}
+	if stores[s.path] == s {
+		delete(stores, s.path)
+	}
+	storesMu.Unlock()
+
+	// closing waits for open transactions, so it is done without holding storesMu. A
+	// concurrent Open of the same path waits for the file lock until then
+	s.closeWatchers()
+	if err := s.backend.Close(); err != nil {
+		logger.Error("could not close database", logger.Err(err))
+		return errors.Wrap(err, "could not close database")
+	}
+	return nil
+}
+
+// Backend returns the Backend of the Store
+func (s *Store) Backend() Backend {
+	return s.backend
+}
+
+// DB returns the underlying bolt database, or nil if the Store doesn't use bolt
+func (s *Store) DB() *bolt.DB {
+	if b, ok := s.backend.(*BoltBackend); ok {
+		return b.DB()
+	}
+	return nil
+}
+
+// Path returns the absolute path of the database file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// CreateBuckets creates the passed buckets if they don't exist
+func (s *Store) CreateBuckets(buckets ...[]byte) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+	err := s.Update(func(tx *Tx) error {
+		for _, bucket := range buckets {
+			if err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("could not create bucket", logger.Err(err))
+		return errors.Wrap(err, "could not create bucket")
+	}
+	return nil
+}
+
+// DeleteKeyFromBucket deletes a given key from a bucket
+func (s *Store) DeleteKeyFromBucket(key int, bucketName []byte) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Delete(bucketName, key)
+	})
+}
+
+// Save inserts an interface with an integer key
+func (s *Store) Save(bucketName []byte, x interface{}, key int) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Save(bucketName, x, key)
+	})
+}
+
+// Insert saves an interface under a new key from NextID and returns the key
+func (s *Store) Insert(bucketName []byte, x interface{}) (int, error) {
+	var id int
+	err := s.Update(func(tx *Tx) error {
+		var err error
+		id, err = tx.NextID(bucketName)
+		if err != nil {
+			return err
+		}
+		return tx.Save(bucketName, x, id)
+	})
+	return id, err
+}
+
+// NextID returns an unused integer key for a bucket, see Tx.NextID. Use Insert or a
+// transaction if the key must not be taken before it is used
+func (s *Store) NextID(bucketName []byte) (int, error) {
+	var id int
+	err := s.Update(func(tx *Tx) error {
+		var err error
+		id, err = tx.NextID(bucketName)
+		return err
+	})
+	return id, err
+}
+
+// Retrieve retrieves a byteString from the database
+func (s *Store) Retrieve(bucketName []byte, key int) ([]byte, error) {
+	var returnBytes []byte
+	err := s.View(func(tx *Tx) error {
+		var err error
+		returnBytes, err = tx.Retrieve(bucketName, key)
+		return err
+	})
+	return returnBytes, err
+}
+
+// RetrieveAllKeys retrieves all key value pairs from the database
+func (s *Store) RetrieveAllKeys(bucketName []byte) ([][]byte, error) {
+	var arr [][]byte
+	err := s.View(func(tx *Tx) error {
+		var err error
+		arr, err = tx.RetrieveAll(bucketName)
+		return err
+	})
+	return arr, err
+}
+
+// RetrieveAllKeysLim gets the total number of keys in a bucket
+func (s *Store) RetrieveAllKeysLim(bucketName []byte) (int, error) {
+	lim := 0
+	err := s.View(func(tx *Tx) error {
+		var err error
+		lim, err = tx.Count(bucketName)
+		return err
+	})
+
+	if err != nil {
+		logger.Error("could not open db for reading", logger.Err(err))
+	}
+
+	return lim, err
+}
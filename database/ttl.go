@@ -0,0 +1,323 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Records can be given an expiry time. Expired records are hidden from reads as soon as they
+// expire and deleted by Sweep. Expiry times are stored in two raw companion buckets:
+// TTLBucket maps record keys to their expiry, and expiryBucket stores expiry || record key so
+// that Sweep can find expired records without scanning the whole bucket.
+
+// now returns the current time, replaced in tests
+var now = time.Now
+
+// ttlKey returns the key marking bucket as having expiring records in metaBucket
+func ttlKey(bucket []byte) []byte {
+	return append([]byte("ttl/"), bucket...)
+}
+
+// TTLBucket returns the name of the companion bucket storing the expiry of the records of
+// bucket
+func TTLBucket(bucket []byte) []byte {
+	return companionBucket("ttl", bucket)
+}
+
+// expiryBucket returns the name of the companion bucket ordering the records of bucket by
+// expiry
+func expiryBucket(bucket []byte) []byte {
+	return companionBucket("exp", bucket)
+}
+
+// encodeTime encodes t so that times sort in chronological order, flipping the sign bit like
+// EncodeKey so that times before 1970 sort first
+func encodeTime(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano())^(1<<63))
+	return b
+}
+
+// decodeTime decodes a time encoded with encodeTime
+func decodeTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)^(1<<63)))
+}
+
+// SaveTTL saves x under key like Save, deleting it once ttl has elapsed
+func (tx *Tx) SaveTTL(bucketName []byte, x interface{}, key int, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if err := tx.Save(bucketName, x, key); err != nil {
+		return err
+	}
+	return tx.setExpiry(bucketName, EncodeKey(key), now().Add(ttl))
+}
+
+// Expire sets the time at which a record expires. A zero time makes the record permanent
+func (tx *Tx) Expire(bucketName []byte, key int, at time.Time) error {
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+	iK := EncodeKey(key)
+	if b.Get(iK) == nil || tx.expired(bucketName, iK) {
+		return ErrElementNotFound
+	}
+	if at.IsZero() {
+		return tx.clearExpiry(bucketName, iK)
+	}
+	return tx.setExpiry(bucketName, iK, at)
+}
+
+// ExpiresAt returns the time at which a record expires, or a zero time if it doesn't
+func (tx *Tx) ExpiresAt(bucketName []byte, key int) (time.Time, error) {
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	iK := EncodeKey(key)
+	if b.Get(iK) == nil || tx.expired(bucketName, iK) {
+		return time.Time{}, ErrElementNotFound
+	}
+	tb := tx.tx.Bucket(TTLBucket(bucketName))
+	if tb == nil {
+		return time.Time{}, nil
+	}
+	x := tb.Get(iK)
+	if x == nil {
+		return time.Time{}, nil
+	}
+	return decodeTime(x), nil
+}
+
+// setExpiry records the expiry of key, replacing its previous expiry
+func (tx *Tx) setExpiry(bucketName []byte, key []byte, at time.Time) error {
+	if err := tx.clearExpiry(bucketName, key); err != nil {
+		return err
+	}
+
+	meta, err := tx.tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	if err := meta.Put(ttlKey(bucketName), []byte{1}); err != nil {
+		return err
+	}
+	tb, err := createRawBucket(tx.tx, TTLBucket(bucketName))
+	if err != nil {
+		return err
+	}
+	eb, err := createRawBucket(tx.tx, expiryBucket(bucketName))
+	if err != nil {
+		return err
+	}
+
+	expiry := encodeTime(at)
+	if err := tb.Put(key, expiry); err != nil {
+		return err
+	}
+	return eb.Put(append(expiry, key...), []byte{})
+}
+
+// clearExpiry removes the expiry of key if it has one
+func (tx *Tx) clearExpiry(bucketName []byte, key []byte) error {
+	tb := tx.tx.Bucket(TTLBucket(bucketName))
+	if tb == nil {
+		return nil
+	}
+	expiry := tb.Get(key)
+	if expiry == nil {
+		return nil
+	}
+	// the slice is invalidated by Delete
+	expiry = append([]byte{}, expiry...)
+	if err := tb.Delete(key); err != nil {
+		return err
+	}
+	if eb := tx.tx.Bucket(expiryBucket(bucketName)); eb != nil {
+		return eb.Delete(append(expiry, key...))
+	}
+	return nil
+}
+
+// expired returns whether the record under key has expired
+func (tx *Tx) expired(bucketName []byte, key []byte) bool {
+	return tx.expiredFunc(bucketName)(key)
+}
+
+// expiredFunc returns a function reporting whether a record of the bucket has expired
+func (tx *Tx) expiredFunc(bucketName []byte) func(key []byte) bool {
+	tb := tx.tx.Bucket(TTLBucket(bucketName))
+	if tb == nil {
+		return func([]byte) bool { return false }
+	}
+	t := now()
+	return func(key []byte) bool {
+		x := tb.Get(key)
+		return x != nil && !decodeTime(x).After(t)
+	}
+}
+
+// expiredCount returns the number of expired records of a bucket that haven't been swept yet
+func (tx *Tx) expiredCount(b Bucket, bucketName []byte) int {
+	eb := tx.tx.Bucket(expiryBucket(bucketName))
+	if eb == nil {
+		return 0
+	}
+	n := 0
+	deadline := encodeTime(now())
+	c := eb.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:8], deadline) <= 0; k, _ = c.Next() {
+		if b.Get(k[8:]) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// sweep deletes up to limit expired records of a bucket and returns how many were deleted.
+// Records of a bucket that is locked can't be opened, so they are deleted as they are if the
+// bucket has no indexes that would need updating, and sent to watchers without their values
+func (tx *Tx) sweep(bucketName []byte, limit int) (int, error) {
+	eb := tx.tx.Bucket(expiryBucket(bucketName))
+	if eb == nil {
+		return 0, nil
+	}
+	b := tx.tx.Bucket(bucketName)
+
+	locked := false
+	if _, err := tx.keyring(bucketName); err == ErrBucketLocked {
+		indexes, err := tx.store.checkIndexes(tx.tx, bucketName)
+		if err != nil {
+			return 0, err
+		}
+		if len(indexes) != 0 {
+			return 0, errors.Wrap(ErrBucketLocked, "can't update indexes of expired records")
+		}
+		locked = true
+	}
+
+	var keys [][]byte
+	deadline := encodeTime(now())
+	c := eb.Cursor()
+	for k, _ := c.First(); k != nil && len(keys) < limit; k, _ = c.Next() {
+		if bytes.Compare(k[:8], deadline) > 0 {
+			break
+		}
+		keys = append(keys, append([]byte{}, k[8:]...))
+	}
+
+	for _, key := range keys {
+		if b != nil && locked && b.Get(key) != nil {
+			if err := b.Delete(key); err != nil {
+				return 0, err
+			}
+			tx.notify(EventDelete, bucketName, key, nil, nil)
+		} else if b != nil {
+			if err := tx.delete(b, bucketName, key); err != nil {
+				return 0, err
+			}
+		}
+		// the record may have been removed without its expiry
+		if err := tx.clearExpiry(bucketName, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// SaveTTL saves x under key in bucket, deleting it once ttl has elapsed
+func (s *Store) SaveTTL(bucket []byte, x interface{}, key int, ttl time.Duration) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.SaveTTL(bucket, x, key, ttl)
+	})
+}
+
+// Expire sets the time at which a record expires. A zero time makes the record permanent
+func (s *Store) Expire(bucket []byte, key int, at time.Time) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Expire(bucket, key, at)
+	})
+}
+
+// ExpiresAt returns the time at which a record expires, or a zero time if it doesn't
+func (s *Store) ExpiresAt(bucket []byte, key int) (time.Time, error) {
+	var at time.Time
+	err := s.View(func(tx *Tx) error {
+		var err error
+		at, err = tx.ExpiresAt(bucket, key)
+		return err
+	})
+	return at, err
+}
+
+// Sweep deletes the expired records of every bucket and returns how many were deleted. Each
+// batch of up to batchSize records is deleted in its own transaction, so writers are only
+// blocked briefly. A bucket that fails to be swept doesn't stop the others, the errors of all
+// buckets are returned together
+func (s *Store) Sweep(batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	var buckets [][]byte
+	err := s.View(func(tx *Tx) error {
+		meta := tx.tx.Bucket(metaBucket)
+		if meta == nil {
+			return nil
+		}
+		prefix := ttlKey(nil)
+		c := meta.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			buckets = append(buckets, append([]byte{}, k[len(prefix):]...))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("could not read expiring buckets", logger.Err(err))
+		return 0, errors.Wrap(err, "could not read expiring buckets")
+	}
+
+	total := 0
+	var failed []string
+	for _, bucket := range buckets {
+		for {
+			var n int
+			err := s.Update(func(tx *Tx) error {
+				var err error
+				n, err = tx.sweep(bucket, batchSize)
+				return err
+			})
+			if err != nil {
+				logger.Error("could not delete expired records", logger.F("bucket", string(bucket)), logger.Err(err))
+				failed = append(failed, string(bucket)+": "+err.Error())
+				break
+			}
+			total += n
+			if n < batchSize {
+				break
+			}
+		}
+	}
+	if len(failed) != 0 {
+		return total, errors.New("could not delete expired records of " + strings.Join(failed, ", "))
+	}
+	return total, nil
+}
+
+// ScheduleSweeps runs Sweep every interval. Errors are logged and the next sweep is attempted
+// as usual. Stop must be called before the Store is closed
+func (s *Store) ScheduleSweeps(interval time.Duration, batchSize int) *Scheduler {
+	return s.schedule(interval, func() {
+		if _, err := s.Sweep(batchSize); err != nil {
+			logger.Error("could not sweep expired records", logger.Err(err))
+		}
+	})
+}
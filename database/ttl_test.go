@@ -0,0 +1,233 @@
+// +build all travis
+
+package database
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestTTL(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	current := time.Unix(1000, 0)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	s, err := Open("test_files/ttl.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	sub := s.Watch(testBucket, 10)
+	defer sub.Unsubscribe()
+
+	for i := 1; i <= 5; i++ {
+		if err := s.SaveTTL(testBucket, i, i, time.Duration(i)*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Save(testBucket, 6, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveTTL(testBucket, 7, 7, 0); err == nil {
+		t.Fatal("zero ttl accepted")
+	}
+
+	at, err := s.ExpiresAt(testBucket, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.Equal(current.Add(2 * time.Minute)) {
+		t.Fatalf("unexpected expiry: %v", at)
+	}
+	at, err = s.ExpiresAt(testBucket, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.IsZero() {
+		t.Fatalf("unexpected expiry: %v", at)
+	}
+
+	// saving without a ttl and Expire with a zero time make records permanent
+	if err := s.Save(testBucket, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire(testBucket, 2, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	current = current.Add(3 * time.Minute)
+
+	// expired records are hidden before they are swept
+	if _, err := s.Retrieve(testBucket, 3); err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+	if err := s.Expire(testBucket, 3, current.Add(time.Hour)); err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+	arr, err := s.RetrieveAllKeys(testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arr) != 5 {
+		t.Fatalf("expected 5 values, got %d", len(arr))
+	}
+	count, err := s.RetrieveAllKeysLim(testBucket)
+	if err != nil || count != 5 {
+		t.Fatalf("expected 5 records, got %d: %v", count, err)
+	}
+	records, cursor, err := s.Find(testBucket, Query{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || cursor == nil {
+		t.Fatalf("unexpected page: %d records", len(records))
+	}
+	if id, _ := records[2].ID(); id != 4 {
+		t.Fatalf("expected record 4, got %d", id)
+	}
+
+	n, err := s.Sweep(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 swept record, got %d", n)
+	}
+	count, err = s.RetrieveAllKeysLim(testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Fatalf("expected 5 records, got %d", count)
+	}
+
+	current = current.Add(time.Hour)
+	n, err = s.Sweep(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 swept records, got %d", n)
+	}
+	arr, err = s.RetrieveAllKeys(testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arr) != 3 {
+		t.Fatalf("expected 3 values, got %d", len(arr))
+	}
+
+	// sweeping publishes delete events
+	deletes := 0
+	for len(sub.C) > 0 {
+		if event := <-sub.C; event.Type == EventDelete {
+			deletes++
+		}
+	}
+	if deletes != 3 {
+		t.Fatalf("expected 3 delete events, got %d", deletes)
+	}
+
+	// expiries before 1970 sort first
+	if err := s.Expire(testBucket, 1, current.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire(testBucket, 6, time.Unix(-1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	n, err = s.Sweep(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 swept record, got %d", n)
+	}
+	if _, err := s.Retrieve(testBucket, 6); err != ErrElementNotFound {
+		t.Fatalf("expected ErrElementNotFound, got %v", err)
+	}
+
+	// companion buckets can't be created or shadowed by users
+	for _, bucket := range [][]byte{TTLBucket(testBucket), IndexBucket(testBucket, "x"), metaBucket} {
+		if err := s.CreateBuckets(bucket); errors.Cause(err) != ErrReservedBucket {
+			t.Fatalf("bucket %q: expected ErrReservedBucket, got %v", bucket, err)
+		}
+	}
+	if err := s.Save([]byte("test_ttl"), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if at, err := s.ExpiresAt(testBucket, 1); err != nil || at.IsZero() {
+		t.Fatalf("unexpected expiry: %v %v", at, err)
+	}
+}
+
+func TestSweepLocked(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	current := time.Unix(1000, 0)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	secret := []byte("secret")
+	indexed := []byte("indexed")
+	s, err := Open("test_files/locked.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bucket := range [][]byte{indexed, secret} {
+		if err := s.EncryptBucket(bucket, keyring); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddIndex(indexed, Index{Name: "email", Field: "Email"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, bucket := range [][]byte{indexed, secret, testBucket} {
+		if err := s.SaveTTL(bucket, testAccount{Email: "a@test.com"}, 1, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open("test_files/locked.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// the bucket with an index can't be swept without its keyring, the others are swept anyway
+	current = current.Add(time.Hour)
+	n, err := s.Sweep(10)
+	if err == nil {
+		t.Fatal("locked bucket with an index swept")
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 swept records, got %d", n)
+	}
+	err = s.Backend().View(func(tx BackendTx) error {
+		if tx.Bucket(secret).Get(EncodeKey(1)) != nil {
+			return errors.New("expired record of locked bucket not deleted")
+		}
+		if tx.Bucket(indexed).Get(EncodeKey(1)) == nil {
+			return errors.New("record of locked bucket with an index deleted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,257 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Tx is a transaction on a Store. The operations of a Tx passed to Update are committed
+// together, or rolled back if the function returns an error. A Tx must not be used after the
+// function returns
+type Tx struct {
+	tx     BackendTx
+	store  *Store
+	events []Event // published after commit
+}
+
+// Update runs fn in a read-write transaction, committing it if fn returns nil and rolling it
+// back otherwise. Subscribers are notified of the changes once they are committed
+func (s *Store) Update(fn func(tx *Tx) error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var t *Tx
+	err := s.backend.Update(func(tx BackendTx) error {
+		t = &Tx{tx: tx, store: s}
+		return fn(t)
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(t.events)
+	return nil
+}
+
+// View runs fn in a read-only transaction
+func (s *Store) View(fn func(tx *Tx) error) error {
+	return s.backend.View(func(tx BackendTx) error {
+		return fn(&Tx{tx: tx, store: s})
+	})
+}
+
+// Backend returns the underlying transaction of the Backend
+func (tx *Tx) Backend() BackendTx {
+	return tx.tx
+}
+
+// Writable returns whether the transaction can write
+func (tx *Tx) Writable() bool {
+	return tx.tx.Writable()
+}
+
+// bucket returns the bucket with the given name or ErrBucketMissing
+func (tx *Tx) bucket(bucketName []byte) (Bucket, error) {
+	b := tx.tx.Bucket(bucketName)
+	if b == nil {
+		return nil, ErrBucketMissing
+	}
+	return b, nil
+}
+
+// CreateBucket creates a bucket if it doesn't exist
+func (tx *Tx) CreateBucket(bucketName []byte) error {
+	_, err := createBucket(tx.tx, bucketName)
+	return err
+}
+
+// Save inserts an interface with an integer key, creating the bucket if it doesn't exist
+func (tx *Tx) Save(bucketName []byte, x interface{}, key int) error {
+	encoded, err := json.Marshal(x)
+	if err != nil {
+		logger.Error("error while marshaling json struct", logger.Err(err))
+		return errors.Wrap(err, "error while marshaling json struct")
+	}
+
+	b, err := createBucket(tx.tx, bucketName)
+	if err != nil {
+		return err
+	}
+	iK := EncodeKey(key)
+	// a saved record replaces an expiring one and doesn't expire, see SaveTTL
+	if err := tx.clearExpiry(bucketName, iK); err != nil {
+		return err
+	}
+	return tx.put(b, bucketName, iK, encoded)
+}
+
+// Retrieve retrieves a byteString from the database. The returned slice is a copy and stays
+// valid after the transaction
+func (tx *Tx) Retrieve(bucketName []byte, key int) ([]byte, error) {
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	iK := EncodeKey(key)
+	x := b.Get(iK)
+	if x == nil {
+		return nil, ErrElementNotFound
+	}
+	if tx.expired(bucketName, iK) {
+		if tx.Writable() {
+			if err := tx.delete(b, bucketName, iK); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrElementNotFound
+	}
+	returnBytes := make([]byte, len(x))
+	copy(returnBytes, x)
+	return tx.openValue(bucketName, iK, returnBytes)
+}
+
+// Delete deletes a given key from a bucket. Deleting a key that doesn't exist isn't an error
+func (tx *Tx) Delete(bucketName []byte, key int) error {
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+	return tx.delete(b, bucketName, EncodeKey(key))
+}
+
+// put stores data under key in b, keeping the indexes of the bucket up to date
+func (tx *Tx) put(b Bucket, bucketName []byte, key, data []byte) error {
+	var old []byte
+	if x := b.Get(key); x != nil {
+		// the slice is invalidated by Put
+		var err error
+		old, err = tx.openValue(bucketName, key, append([]byte{}, x...))
+		if err != nil {
+			return err
+		}
+	}
+	sealed, err := tx.sealValue(bucketName, key, data)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(key, sealed); err != nil {
+		return err
+	}
+	if err := tx.updateIndexes(bucketName, key, old, data); err != nil {
+		return err
+	}
+	tx.notify(EventPut, bucketName, key, old, data)
+	return nil
+}
+
+// delete deletes key from b, keeping the indexes of the bucket up to date
+func (tx *Tx) delete(b Bucket, bucketName []byte, key []byte) error {
+	x := b.Get(key)
+	if x == nil {
+		return nil
+	}
+	old, err := tx.openValue(bucketName, key, append([]byte{}, x...))
+	if err != nil {
+		return err
+	}
+	if err := b.Delete(key); err != nil {
+		return err
+	}
+	if err := tx.clearExpiry(bucketName, key); err != nil {
+		return err
+	}
+	if err := tx.updateIndexes(bucketName, key, old, nil); err != nil {
+		return err
+	}
+	tx.notify(EventDelete, bucketName, key, old, nil)
+	return nil
+}
+
+// NextID returns an unused integer key for a bucket, creating the bucket if it doesn't
+// exist. IDs are increasing and start at 1, keys saved with larger IDs are skipped
+func (tx *Tx) NextID(bucketName []byte) (int, error) {
+	b, err := createBucket(tx.tx, bucketName)
+	if err != nil {
+		return 0, err
+	}
+
+	// keys may have been picked by callers, so make sure the sequence is past the last key
+	if k, _ := b.Cursor().Last(); k != nil {
+		last, err := DecodeKey(k)
+		if err == nil && last > 0 && uint64(last) > b.Sequence() {
+			if err := b.SetSequence(uint64(last)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	id, err := b.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// RetrieveAll retrieves all values of a bucket in key order
+func (tx *Tx) RetrieveAll(bucketName []byte) ([][]byte, error) {
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	var arr [][]byte
+	expired := tx.expiredFunc(bucketName)
+	c := b.Cursor()
+	for k, x := c.First(); k != nil; k, x = c.Next() {
+		if x == nil || expired(k) {
+			// nested bucket or expired record
+			continue
+		}
+		temp := make([]byte, len(x))
+		copy(temp, x)
+		temp, err := tx.openValue(bucketName, k, temp)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, temp)
+	}
+	return arr, nil
+}
+
+// Count gets the total number of keys in a bucket, not counting expired records
+func (tx *Tx) Count(bucketName []byte) (int, error) {
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return 0, err
+	}
+	return b.KeyN() - tx.expiredCount(b, bucketName), nil
+}
+
+// Find returns the records of a bucket matching the query and the cursor of the next page,
+// see Store.Find
+func (tx *Tx) Find(bucketName []byte, q Query) ([]Record, []byte, error) {
+	b, err := tx.bucket(bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, cursor := find(b, q, tx.expiredFunc(bucketName))
+	if err := tx.openRecords(bucketName, records); err != nil {
+		return nil, nil, err
+	}
+	return records, cursor, nil
+}
+
+// openRecords decrypts the values of records if their bucket is encrypted
+func (tx *Tx) openRecords(bucketName []byte, records []Record) error {
+	for i := range records {
+		value, err := tx.openValue(bucketName, records[i].Key, records[i].Value)
+		if err != nil {
+			return err
+		}
+		records[i].Value = value
+	}
+	return nil
+}
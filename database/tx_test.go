@@ -0,0 +1,104 @@
+// +build all travis
+
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestTx(t *testing.T) {
+	os.MkdirAll("test_files", os.ModePerm)
+	defer os.RemoveAll("test_files")
+
+	s, err := Open("test_files/tx.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 1; i <= 3; i++ {
+		id, err := s.Insert(testBucket, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != i {
+			t.Fatalf("expected id %d, got %d", i, id)
+		}
+	}
+
+	// keys picked by callers aren't handed out again
+	if err := s.Save(testBucket, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	id, err := NextID("test_files/tx.db", testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 11 {
+		t.Fatalf("expected id 11, got %d", id)
+	}
+
+	// move a value between buckets atomically
+	other := []byte("other")
+	err = s.Update(func(tx *Tx) error {
+		x, err := tx.Retrieve(testBucket, 1)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(testBucket, 1); err != nil {
+			return err
+		}
+		return tx.Save(other, string(x), 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// errors roll back every operation of the transaction
+	errAbort := errors.New("abort")
+	err = s.Update(func(tx *Tx) error {
+		if err := tx.Delete(testBucket, 2); err != nil {
+			return err
+		}
+		if err := tx.Save(other, 2, 2); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("expected errAbort, got %v", err)
+	}
+
+	err = s.View(func(tx *Tx) error {
+		if _, err := tx.Retrieve(testBucket, 1); err != ErrElementNotFound {
+			t.Fatalf("expected ErrElementNotFound, got %v", err)
+		}
+		if _, err := tx.Retrieve(testBucket, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Retrieve(other, 2); err != ErrElementNotFound {
+			t.Fatalf("expected ErrElementNotFound, got %v", err)
+		}
+		count, err := tx.Count(other)
+		if err != nil {
+			return err
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 key, got %d", count)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.View(func(tx *Tx) error {
+		return tx.Save(testBucket, 1, 1)
+	})
+	if err == nil {
+		t.Fatal("saved in a read only transaction")
+	}
+}
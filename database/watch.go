@@ -0,0 +1,135 @@
+package database
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventType is the kind of change an Event describes
+type EventType int
+
+const (
+	// EventPut is sent when a value is saved
+	EventPut EventType = iota + 1
+	// EventDelete is sent when a value is deleted
+	EventDelete
+)
+
+// Event describes a change to a bucket. Old is nil for new records and New is nil for deleted
+// records. Values of encrypted buckets are decrypted
+type Event struct {
+	Type   EventType
+	Bucket []byte
+	Key    []byte
+	Old    []byte
+	New    []byte
+}
+
+// ID decodes the key of the event with DecodeKey
+func (e Event) ID() (int, error) {
+	return DecodeKey(e.Key)
+}
+
+// Subscription receives the events of a bucket on C once the transactions causing them have
+// been committed, in the order of the commits. Events are dropped instead of blocking writers
+// when C is full
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	store   *Store
+	bucket  string
+	dropped uint64 // accessed atomically
+	once    sync.Once
+}
+
+// Watch subscribes to the events of a bucket, buffering up to buffer events. C is closed when
+// Unsubscribe is called or the Store is closed
+func (s *Store) Watch(bucket []byte, buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	sub := &Subscription{C: c, c: c, store: s, bucket: string(bucket)}
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if s.watchers == nil {
+		s.watchers = make(map[string]map[*Subscription]struct{})
+	}
+	if s.watchers[sub.bucket] == nil {
+		s.watchers[sub.bucket] = make(map[*Subscription]struct{})
+	}
+	s.watchers[sub.bucket][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops the delivery of events and closes C
+func (sub *Subscription) Unsubscribe() {
+	sub.once.Do(func() {
+		sub.store.watchMu.Lock()
+		defer sub.store.watchMu.Unlock()
+		delete(sub.store.watchers[sub.bucket], sub)
+		if len(sub.store.watchers[sub.bucket]) == 0 {
+			delete(sub.store.watchers, sub.bucket)
+		}
+		close(sub.c)
+	})
+}
+
+// Dropped returns the number of events dropped because C was full
+func (sub *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+// watched returns whether a bucket has subscribers
+func (s *Store) watched(bucket []byte) bool {
+	s.watchMu.RLock()
+	defer s.watchMu.RUnlock()
+	return len(s.watchers[string(bucket)]) > 0
+}
+
+// notify records an event of the transaction if the bucket is watched
+func (tx *Tx) notify(typ EventType, bucket, key, old, data []byte) {
+	if !tx.store.watched(bucket) {
+		return
+	}
+	tx.events = append(tx.events, Event{
+		Type:   typ,
+		Bucket: append([]byte{}, bucket...),
+		Key:    append([]byte{}, key...),
+		Old:    append([]byte(nil), old...),
+		New:    append([]byte(nil), data...),
+	})
+}
+
+// publish delivers the events of a committed transaction
+func (s *Store) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	s.watchMu.RLock()
+	defer s.watchMu.RUnlock()
+	for _, event := range events {
+		for sub := range s.watchers[string(event.Bucket)] {
+			select {
+			case sub.c <- event:
+			default:
+				atomic.AddUint64(&sub.dropped, 1)
+			}
+		}
+	}
+}
+
+// closeWatchers unsubscribes every subscription of the Store
+func (s *Store) closeWatchers() {
+	s.watchMu.RLock()
+	var subs []*Subscription
+	for _, watchers := range s.watchers {
+		for sub := range watchers {
+			subs = append(subs, sub)
+		}
+	}
+	s.watchMu.RUnlock()
+
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+}
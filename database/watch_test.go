@@ -0,0 +1,120 @@
+// +build all travis
+
+package database
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWatch(t *testing.T) {
+	s, err := NewStore(NewMemoryBackend(), testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := s.Watch(testBucket, 10)
+	other := s.Watch([]byte("other"), 1)
+
+	if err := s.Save(testBucket, "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(testBucket, "b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteKeyFromBucket(1, testBucket); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Event{
+		{Type: EventPut, New: []byte(`"a"`)},
+		{Type: EventPut, Old: []byte(`"a"`), New: []byte(`"b"`)},
+		{Type: EventDelete, Old: []byte(`"b"`)},
+	}
+	for _, e := range expected {
+		event := <-sub.C
+		id, err := event.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != e.Type || id != 1 || string(event.Bucket) != string(testBucket) ||
+			string(event.Old) != string(e.Old) || string(event.New) != string(e.New) {
+			t.Fatalf("unexpected event: %#v", event)
+		}
+		if (e.Old == nil) != (event.Old == nil) || (e.New == nil) != (event.New == nil) {
+			t.Fatalf("unexpected event: %#v", event)
+		}
+	}
+
+	// rolled back transactions aren't published
+	err = s.Update(func(tx *Tx) error {
+		if err := tx.Save(testBucket, "c", 2); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	select {
+	case event := <-sub.C:
+		t.Fatalf("rolled back event published: %#v", event)
+	default:
+	}
+
+	// full subscriptions drop events instead of blocking
+	for i := 0; i < 3; i++ {
+		if err := s.Save([]byte("other"), i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if other.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", other.Dropped())
+	}
+
+	// events are published in commit order
+	ordered := []byte("ordered")
+	orderedSub := s.Watch(ordered, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Update(func(tx *Tx) error {
+				id, err := tx.NextID(ordered)
+				if err != nil {
+					return err
+				}
+				return tx.Save(ordered, id, id)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 1; i <= 100; i++ {
+		if id, _ := (<-orderedSub.C).ID(); id != i {
+			t.Fatalf("expected event %d, got %d", i, id)
+		}
+	}
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("channel not closed by Unsubscribe")
+	}
+	if err := s.Save(testBucket, "d", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-other.C
+	if _, ok := <-other.C; ok {
+		t.Fatal("channel not closed by Close")
+	}
+}
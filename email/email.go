@@ -1,14 +1,15 @@
 package email
 
 import (
-	"log"
 	"net/smtp"
+
+	"github.com/Varunram/essentials/logger"
 )
 
 // SendMail is a handler for sending out an email to an entity, reading required params from the config file
 func SendMail(body string, to string) error {
 	var err error
-	log.Println("EMAIL FROM: ", From, " TO: ", to, " PASS: ", Pass)
+	logger.Debug("sending email", logger.F("from", From), logger.F("to", to), logger.Secret("pass", Pass))
 	auth := smtp.PlainAuth("", From, Pass, "smtp.gmail.com")
 	// to can also be an array of addresses if needed
 	msg := "From: " + From + "\n" +
@@ -17,7 +18,7 @@ func SendMail(body string, to string) error {
 
 	err = smtp.SendMail("smtp.gmail.com:587", auth, From, []string{to}, []byte(msg))
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not send email", logger.Err(err))
 	}
 
 	return nil
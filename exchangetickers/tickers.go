@@ -1,12 +1,14 @@
 package tickers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
 	"sync"
 
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
+	"github.com/Varunram/essentials/retry"
 	erpc "github.com/Varunram/essentials/rpc"
 	utils "github.com/Varunram/essentials/utils"
 )
@@ -29,6 +31,14 @@ var KrakenReq = "https://api.kraken.com/0/public/Ticker?pair=XLMUSD"
 // BinanceVol is the binance ticker from the API
 var BinanceVol = "https://api.binance.com/api/v1/ticker/24hr?symbol=XLMUSDT"
 
+// RetryPolicy is the policy failed requests to the exchange APIs are retried with
+var RetryPolicy = retry.DefaultPolicy
+
+// get fetches a ticker endpoint, retrying with RetryPolicy
+func get(url string) ([]byte, error) {
+	return erpc.GetRequestContext(context.Background(), RetryPolicy, url)
+}
+
 // BinanceTickerResponse defines the ticker API response from Binanace
 type BinanceTickerResponse struct {
 	Symbol string `json:"symbol"`
@@ -63,9 +73,9 @@ type KrakenTickerResponse struct {
 
 // BinanceTicker gets price data from Binance
 func BinanceTicker() (float64, error) {
-	data, err := erpc.GetRequest(BinanceReq)
+	data, err := get(BinanceReq)
 	if err != nil {
-		log.Println("did not get response", err)
+		logger.Error("did not get response", logger.F("url", BinanceReq), logger.Err(err))
 		return -1, errors.Wrap(err, "did not get response from Binance API")
 	}
 
@@ -89,9 +99,9 @@ func BinanceTicker() (float64, error) {
 
 // BinanceVolume gets volume data from Binance
 func BinanceVolume() (float64, error) {
-	data, err := erpc.GetRequest(BinanceVol)
+	data, err := get(BinanceVol)
 	if err != nil {
-		log.Println("did not get response", err)
+		logger.Error("did not get response", logger.F("url", BinanceVol), logger.Err(err))
 		return -1, errors.Wrap(err, "did not get response from Binance API")
 	}
 
@@ -115,9 +125,9 @@ func BinanceVolume() (float64, error) {
 
 // CoinbaseTicker gets ticker data from coinbase
 func CoinbaseTicker() (float64, error) {
-	data, err := erpc.GetRequest(CoinbaseReq)
+	data, err := get(CoinbaseReq)
 	if err != nil {
-		log.Println("did not get response", err)
+		logger.Error("did not get response", logger.F("url", CoinbaseReq), logger.Err(err))
 		return -1, errors.Wrap(err, "did not get response from Coinbase API")
 	}
 
@@ -138,9 +148,9 @@ func CoinbaseTicker() (float64, error) {
 
 // CoinbaseVolume gets volume data from coinbase
 func CoinbaseVolume() (float64, error) {
-	data, err := erpc.GetRequest(CoinbaseReq)
+	data, err := get(CoinbaseReq)
 	if err != nil {
-		log.Println("did not get response", err)
+		logger.Error("did not get response", logger.F("url", CoinbaseReq), logger.Err(err))
 		return -1, errors.Wrap(err, "did not get response from Coinbase API")
 	}
 
@@ -161,9 +171,9 @@ func CoinbaseVolume() (float64, error) {
 
 // KrakenTicker gets ticker data from kraken
 func KrakenTicker() (float64, error) {
-	data, err := erpc.GetRequest(KrakenReq)
+	data, err := get(KrakenReq)
 	if err != nil {
-		log.Println("did not get response", err)
+		logger.Error("did not get response", logger.F("url", KrakenReq), logger.Err(err))
 		return -1, errors.Wrap(err, "did not get response from Kraken API")
 	}
 
@@ -184,9 +194,9 @@ func KrakenTicker() (float64, error) {
 
 // KrakenVolume gets volume data from kraken
 func KrakenVolume() (float64, error) {
-	data, err := erpc.GetRequest(KrakenReq)
+	data, err := get(KrakenReq)
 	if err != nil {
-		log.Println("did not get response", err)
+		logger.Error("did not get response", logger.F("url", KrakenReq), logger.Err(err))
 		return -1, errors.Wrap(err, "did not get response from Kraken API")
 	}
 
@@ -218,7 +228,7 @@ func XLMUSD() (float64, error) {
 		var err error
 		binanceVolume, err = CoinbaseVolume()
 		if err != nil {
-			log.Println(err)
+			logger.Warn("could not get volume", logger.F("exchange", "coinbase"), logger.Err(err))
 		}
 	}(&wg)
 
@@ -228,7 +238,7 @@ func XLMUSD() (float64, error) {
 		var err error
 		cbVolume, err = CoinbaseVolume()
 		if err != nil {
-			log.Println(err)
+			logger.Warn("could not get volume", logger.F("exchange", "coinbase"), logger.Err(err))
 		}
 	}(&wg)
 
@@ -238,7 +248,7 @@ func XLMUSD() (float64, error) {
 		var err error
 		krakenVolume, err = KrakenVolume()
 		if err != nil {
-			log.Println(err)
+			logger.Warn("could not get volume", logger.F("exchange", "kraken"), logger.Err(err))
 		}
 	}(&wg)
 
@@ -248,7 +258,7 @@ func XLMUSD() (float64, error) {
 		var err error
 		binanceTicker, err = CoinbaseTicker()
 		if err != nil {
-			log.Println(err)
+			logger.Warn("could not get ticker", logger.F("exchange", "coinbase"), logger.Err(err))
 		}
 	}(&wg)
 
@@ -258,7 +268,7 @@ func XLMUSD() (float64, error) {
 		var err error
 		cbTicker, err = CoinbaseTicker()
 		if err != nil {
-			log.Println(err)
+			logger.Warn("could not get ticker", logger.F("exchange", "coinbase"), logger.Err(err))
 		}
 	}(&wg)
 
@@ -268,7 +278,7 @@ func XLMUSD() (float64, error) {
 		var err error
 		krakenTicker, err = KrakenTicker()
 		if err != nil {
-			log.Println(err)
+			logger.Warn("could not get ticker", logger.F("exchange", "kraken"), logger.Err(err))
 		}
 	}(&wg)
 
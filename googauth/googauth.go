@@ -6,11 +6,12 @@ import (
 	"encoding/base32"
 	"encoding/binary"
 	"fmt"
-	"log"
 	"net/url"
 	"sort"
 	"strconv"
 	"time"
+
+	"github.com/Varunram/essentials/logger"
 )
 
 // ComputeCode computes the response code for a 64-bit challenge 'value' using the secret 'secret'.
@@ -99,7 +100,7 @@ func (c *OTPConfig) Authenticate(password string) (bool, error) {
 	code, err := strconv.Atoi(password)
 
 	if err != nil {
-		log.Println("invalid code")
+		logger.Warn("invalid code", logger.Err(err))
 		return false, fmt.Errorf("invalid code, exiting")
 	}
 
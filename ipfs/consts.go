@@ -1,5 +1,9 @@
 package ipfs
 
+import (
+	"github.com/Varunram/essentials/retry"
+)
+
 // IpfsFileLength defines the length of the ipfs filename
 var IpfsFileLength int
 
@@ -7,3 +11,6 @@ var IpfsFileLength int
 func SetConsts(fileLength int) {
 	IpfsFileLength = fileLength
 }
+
+// RetryPolicy is the policy failed calls to the ipfs daemon are retried with
+var RetryPolicy = retry.DefaultPolicy
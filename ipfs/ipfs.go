@@ -2,11 +2,12 @@ package ipfs
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
-	"log"
 	"os"
-	"strings"
 
+	"github.com/Varunram/essentials/logger"
+	"github.com/Varunram/essentials/retry"
 	utils "github.com/Varunram/essentials/utils"
 	shell "github.com/ipfs/go-ipfs-api"
 )
@@ -34,17 +35,37 @@ func SetPath(newPath string) {
 func ReadfromFile(filepath string) ([]byte, error) {
 	data, err := ioutil.ReadFile(filepath)
 	if err != nil {
-		log.Println("error while reading file")
+		logger.Error("error while reading file", logger.F("path", filepath), logger.Err(err))
 	}
 	return data, err
 }
 
+// add stores data in ipfs and returns the hash, retrying with RetryPolicy
+func add(data []byte) (string, error) {
+	sh := RetrieveShell()
+	var hash string
+	err := retry.Do(context.Background(), RetryPolicy, func(ctx context.Context) error {
+		var err error
+		// the reader is consumed by a failed attempt, so every attempt gets its own
+		hash, err = sh.Add(bytes.NewReader(data))
+		return err
+	})
+	return hash, err
+}
+
+// get stores the contents of an ipfs hash at path, retrying with RetryPolicy
+func get(hash string, path string) error {
+	sh := RetrieveShell()
+	return retry.Do(context.Background(), RetryPolicy, func(ctx context.Context) error {
+		return sh.Get(hash, path)
+	})
+}
+
 // AddString stores the passed string in ipfs and returns the hash
 func AddString(a string) (string, error) {
-	sh := RetrieveShell()
-	hash, err := sh.Add(strings.NewReader(a)) // input must be an io.Reader
+	hash, err := add([]byte(a))
 	if err != nil {
-		log.Println("Error while adding string to ipfs: ", err)
+		logger.Error("error while adding string to ipfs", logger.Err(err))
 	}
 	return hash, err
 }
@@ -54,26 +75,22 @@ func AddFile(filepath string) (string, error) {
 	var dummy string
 	dataStream, err := ReadfromFile(filepath)
 	if err != nil {
-		log.Println("Error while reading from file", err)
+		logger.Error("error while reading from file", logger.Err(err))
 		return dummy, err
 	}
 	// need to get the ifps hash of this data stream and return hash
-	reader := bytes.NewReader(dataStream)
-	sh := RetrieveShell()
-	hash, err := sh.Add(reader)
+	hash, err := add(dataStream)
 	if err != nil {
-		log.Println("Error while adding string to ipfs", err)
+		logger.Error("error while adding string to ipfs", logger.Err(err))
 	}
 	return hash, err
 }
 
 // AddBytes hashes a byte string
 func AddBytes(data []byte) (string, error) {
-	reader := bytes.NewReader(data)
-	sh := RetrieveShell()
-	hash, err := sh.Add(reader)
+	hash, err := add(data)
 	if err != nil {
-		log.Println("Error while adding string to ipfs", err)
+		logger.Error("error while adding string to ipfs", logger.Err(err))
 	}
 	return hash, err
 }
@@ -84,28 +101,30 @@ func AddBytes(data []byte) (string, error) {
 // the file
 func GetFile(hash string, extension string) (string, error) {
 	// extension can be pdf, txt, ppt and others
-	sh := RetrieveShell()
 	// generate a random fileName and then return the file to the user
 	fileName := utils.GetRandomString(IpfsFileLength) + "." + extension
-	return fileName, sh.Get(hash, fileName)
+	return fileName, get(hash, fileName)
 }
 
 // GetString gets back the contents of an ipfs hash as a string
 func GetString(hash string) (string, error) {
-	sh := RetrieveShell()
 	// since ipfs doesn't provide a method to read the string directly, we create a
 	// random file at tmp/, decrypt contents to that fiel and then read the file
 	// contents from there
 	tmpFileDir := "/tmp/" + utils.GetRandomString(IpfsFileLength) // using the same length here for consistency
-	sh.Get(hash, tmpFileDir)
+	err := get(hash, tmpFileDir)
+	if err != nil {
+		logger.Error("error while getting hash from ipfs", logger.Err(err))
+		return "", err
+	}
 	data, err := ioutil.ReadFile(tmpFileDir)
 	if err != nil {
-		log.Println("Error while reading file", err)
+		logger.Error("error while reading file", logger.Err(err))
 		return "", err
 	}
 	err = os.Remove(tmpFileDir)
 	if err != nil {
-		log.Println("error while removing file")
+		logger.Error("error while removing file", logger.F("path", tmpFileDir), logger.Err(err))
 	}
 	return string(data), err
 }
@@ -0,0 +1,26 @@
+// +build all
+
+package kdf
+
+import (
+	"testing"
+)
+
+// BenchmarkProfiles measures how long each profile takes to derive a key, run this on the
+// target hardware before picking a profile
+func BenchmarkProfiles(b *testing.B) {
+	salt, _ := NewSalt()
+	profiles := map[string]Params{
+		"Interactive":    Interactive,
+		"Moderate":       Moderate,
+		"Sensitive":      Sensitive,
+		"ScryptModerate": ScryptModerate,
+	}
+	for name, params := range profiles {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _ = Key("cool", salt, params)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package kdf
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// package kdf turns low entropy passphrases into encryption keys using salted, memory hard
+// key derivation functions. The parameters used are serialized into a header that is stored
+// alongside the ciphertext so that they can be tuned without breaking older ciphertexts
+
+// Algorithm identifies a key derivation function
+type Algorithm byte
+
+const (
+	// Scrypt is the scrypt KDF (https://tools.ietf.org/html/rfc7914)
+	Scrypt Algorithm = 1
+	// Argon2id is the argon2id KDF (https://tools.ietf.org/html/draft-irtf-cfrg-argon2)
+	Argon2id Algorithm = 2
+)
+
+// KeySize is the size of the derived keys
+const KeySize = 32
+
+// SaltSize is the size of the random salts generated by NewSalt
+const SaltSize = 16
+
+// limits on the parameters accepted from a header so that a crafted ciphertext can't make us
+// allocate large amounts of memory or spin for long. Each cost may be up to twice that of
+// Sensitive, the strongest profile
+const (
+	minScryptLogN   = 10
+	maxScryptLogN   = 20
+	maxScryptMemory = 512 << 20 // 128 * r * N bytes
+	minArgon2Time   = 1
+	maxArgon2Time   = 8
+	minArgon2Memory = 8 * 1024   // in KiB
+	maxArgon2Memory = 512 * 1024 // 512MiB, in KiB
+	minParallelism  = 1
+	maxParallelism  = 8
+)
+
+// lengths of the serialized headers, including the salt
+const (
+	scryptHeaderLen = 1 + 1 + 4 + 1 + SaltSize
+	argon2HeaderLen = 1 + 4 + 4 + 1 + SaltSize
+)
+
+// ErrInvalidParams is returned when parameters are out of the accepted range
+var ErrInvalidParams = errors.New("kdf parameters out of range")
+
+// ErrInvalidHeader is returned when a header can't be parsed
+var ErrInvalidHeader = errors.New("kdf header too short or malformed")
+
+// Params holds the algorithm and the cost parameters used to derive a key
+type Params struct {
+	Algorithm Algorithm
+	// LogN is log2 of the scrypt CPU/memory cost N
+	LogN uint8
+	// R is the scrypt block size
+	R uint32
+	// Time is the number of argon2id passes over memory
+	Time uint32
+	// Memory is the argon2id memory cost in KiB
+	Memory uint32
+	// Parallelism is scrypt's p or argon2id's number of threads
+	Parallelism uint8
+}
+
+// The timings below were measured with BenchmarkProfiles on a Xeon cloud instance, rerun it
+// on the target hardware before picking a profile
+var (
+	// Interactive takes ~60ms and 32MiB, suitable for unlocking on every request
+	Interactive = Params{Algorithm: Argon2id, Time: 2, Memory: 32 * 1024, Parallelism: 4}
+	// Moderate takes ~200ms and 64MiB, it is the default profile
+	Moderate = Params{Algorithm: Argon2id, Time: 3, Memory: 64 * 1024, Parallelism: 4}
+	// Sensitive takes ~1.2s and 256MiB, suitable for seeds which are unlocked rarely
+	Sensitive = Params{Algorithm: Argon2id, Time: 4, Memory: 256 * 1024, Parallelism: 4}
+	// ScryptModerate takes ~200ms and 64MiB, for platforms where argon2 is slow
+	ScryptModerate = Params{Algorithm: Scrypt, LogN: 16, R: 8, Parallelism: 1}
+)
+
+// Default is the profile used by packages that don't pass in their own params
+var Default = Moderate
+
+// SetDefault sets the profile used by packages that don't pass in their own params
+func SetDefault(params Params) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	Default = params
+	return nil
+}
+
+// Validate checks whether the params are within the accepted range
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case Scrypt:
+		if p.LogN < minScryptLogN || p.LogN > maxScryptLogN || p.R == 0 ||
+			p.Parallelism < minParallelism || p.Parallelism > maxParallelism ||
+			128*uint64(p.R)<<p.LogN > maxScryptMemory {
+			return ErrInvalidParams
+		}
+	case Argon2id:
+		if p.Time < minArgon2Time || p.Time > maxArgon2Time ||
+			p.Memory < minArgon2Memory || p.Memory > maxArgon2Memory ||
+			p.Parallelism < minParallelism || p.Parallelism > maxParallelism {
+			return ErrInvalidParams
+		}
+	default:
+		return errors.Wrap(ErrInvalidParams, "unknown kdf algorithm")
+	}
+	return nil
+}
+
+// NewSalt returns a random salt of SaltSize bytes
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		logger.Error("could not generate random salt", logger.Err(err))
+		return nil, errors.Wrap(err, "could not generate random salt")
+	}
+	return salt, nil
+}
+
+// Key derives a KeySize byte key from the passphrase and salt using the passed params
+func Key(passphrase string, salt []byte, params Params) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch params.Algorithm {
+	case Scrypt:
+		key, err := scrypt.Key([]byte(passphrase), salt, 1<<params.LogN, int(params.R),
+			int(params.Parallelism), KeySize)
+		if err != nil {
+			logger.Error("could not derive scrypt key", logger.Err(err))
+			return nil, errors.Wrap(err, "could not derive scrypt key")
+		}
+		return key, nil
+	default: // Argon2id, Validate rejects unknown algorithms
+		return argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory,
+			params.Parallelism, KeySize), nil
+	}
+}
+
+// Header serializes the params and the salt. The layout is the algorithm byte followed by
+// logN (1), r (4), p (1) for scrypt or time (4), memory (4), threads (1) for argon2id,
+// integers being big endian, and then the salt
+func (p Params) Header(salt []byte) ([]byte, error) {
+	if len(salt) != SaltSize {
+		return nil, errors.New("salt must be SaltSize bytes long")
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	var header []byte
+	switch p.Algorithm {
+	case Scrypt:
+		header = make([]byte, scryptHeaderLen)
+		header[0] = byte(Scrypt)
+		header[1] = p.LogN
+		binary.BigEndian.PutUint32(header[2:6], p.R)
+		header[6] = p.Parallelism
+	default:
+		header = make([]byte, argon2HeaderLen)
+		header[0] = byte(Argon2id)
+		binary.BigEndian.PutUint32(header[1:5], p.Time)
+		binary.BigEndian.PutUint32(header[5:9], p.Memory)
+		header[9] = p.Parallelism
+	}
+
+	copy(header[len(header)-SaltSize:], salt)
+	return header, nil
+}
+
+// ParseHeader parses a header written by Header from the start of data. It returns the
+// params, the salt and the length of the header
+func ParseHeader(data []byte) (Params, []byte, int, error) {
+	var p Params
+	if len(data) == 0 {
+		return p, nil, 0, ErrInvalidHeader
+	}
+
+	var n int
+	p.Algorithm = Algorithm(data[0])
+	switch p.Algorithm {
+	case Scrypt:
+		n = scryptHeaderLen
+		if len(data) < n {
+			return p, nil, 0, ErrInvalidHeader
+		}
+		p.LogN = data[1]
+		p.R = binary.BigEndian.Uint32(data[2:6])
+		p.Parallelism = data[6]
+	case Argon2id:
+		n = argon2HeaderLen
+		if len(data) < n {
+			return p, nil, 0, ErrInvalidHeader
+		}
+		p.Time = binary.BigEndian.Uint32(data[1:5])
+		p.Memory = binary.BigEndian.Uint32(data[5:9])
+		p.Parallelism = data[9]
+	default:
+		return p, nil, 0, ErrInvalidHeader
+	}
+
+	if err := p.Validate(); err != nil {
+		return p, nil, 0, err
+	}
+
+	salt := make([]byte, SaltSize)
+	copy(salt, data[n-SaltSize:n])
+	return p, salt, n, nil
+}
+
+// ReadHeader reads a header written by Header from r. It returns the params, the salt and
+// the raw header that was read
+func ReadHeader(r io.Reader) (Params, []byte, []byte, error) {
+	var p Params
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return p, nil, nil, errors.Wrap(err, "could not read kdf header")
+	}
+
+	var n int
+	switch Algorithm(header[0]) {
+	case Scrypt:
+		n = scryptHeaderLen
+	case Argon2id:
+		n = argon2HeaderLen
+	default:
+		return p, nil, nil, ErrInvalidHeader
+	}
+
+	header = append(header, make([]byte, n-1)...)
+	if _, err := io.ReadFull(r, header[1:]); err != nil {
+		return p, nil, nil, errors.Wrap(err, "could not read kdf header")
+	}
+
+	p, salt, _, err := ParseHeader(header)
+	if err != nil {
+		return p, nil, nil, err
+	}
+	return p, salt, header, nil
+}
@@ -0,0 +1,82 @@
+// +build all travis
+
+package kdf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKDF(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, params := range []Params{Interactive, ScryptModerate} {
+		key1, err := Key("cool", salt, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key1) != KeySize {
+			t.Fatalf("derived key has the wrong size")
+		}
+		key2, err := Key("cool", salt, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key1, key2) {
+			t.Fatalf("key derivation is not deterministic")
+		}
+		otherSalt, _ := NewSalt()
+		key3, err := Key("cool", otherSalt, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(key1, key3) {
+			t.Fatalf("salt doesn't change the derived key")
+		}
+
+		header, err := params.Header(salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, parsedSalt, n, err := ParseHeader(append(header, 0xff))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != params || !bytes.Equal(parsedSalt, salt) || n != len(header) {
+			t.Fatalf("header doesn't round trip")
+		}
+		_, _, _, err = ParseHeader(header[:len(header)-1])
+		if err == nil {
+			t.Fatalf("truncated header not detected")
+		}
+	}
+
+	bad := Params{Algorithm: Argon2id, Time: 1, Memory: maxArgon2Memory + 1, Parallelism: 1}
+	if _, err := Key("cool", salt, bad); err == nil {
+		t.Fatalf("out of range params not detected")
+	}
+	// headers can't demand much more than the strongest profile
+	for _, p := range []Params{
+		{Algorithm: Argon2id, Time: 64, Memory: Sensitive.Memory, Parallelism: 4},
+		{Algorithm: Argon2id, Time: 4, Memory: 4 << 20, Parallelism: 4},
+		{Algorithm: Scrypt, LogN: 16, R: 1 << 20, Parallelism: 1},
+		{Algorithm: Scrypt, LogN: 22, R: 8, Parallelism: 1},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("expensive params not rejected: %+v", p)
+		}
+	}
+	for _, p := range []Params{Interactive, Moderate, Sensitive, ScryptModerate} {
+		if err := p.Validate(); err != nil {
+			t.Fatalf("profile rejected: %+v", p)
+		}
+	}
+	if err := SetDefault(Params{Algorithm: 9}); err == nil {
+		t.Fatalf("unknown algorithm not detected")
+	}
+	if _, _, _, err := ParseHeader([]byte{9}); err == nil {
+		t.Fatalf("unknown algorithm not detected")
+	}
+}
@@ -0,0 +1,193 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// package logger is the levelled, structured logger used by the other packages. Entries
+// carry a message and key/value fields and are passed to a pluggable Logger, which writes
+// them to stderr by default. Fields created with Secret are redacted before any Logger sees
+// them, so seeds and passwords never end up in the logs
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	// DebugLevel is for detailed output that is only useful while debugging
+	DebugLevel Level = iota
+	// InfoLevel is for the normal operation of a package
+	InfoLevel
+	// WarnLevel is for problems that are handled but may need attention
+	WarnLevel
+	// ErrorLevel is for operations that failed
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the lowercase name of the level
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses the name of a level, as returned by String
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return DebugLevel, errors.New("unknown log level: " + s)
+}
+
+// Redacted replaces the value of secret fields
+const Redacted = "[REDACTED]"
+
+// Field is a key/value pair attached to a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+	// Secret fields have their value replaced with Redacted before they are logged
+	Secret bool
+}
+
+// F returns a field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err returns a field for an error
+func Err(err error) Field {
+	return Field{Key: "err", Value: err}
+}
+
+// Secret returns a field that is redacted before it is logged
+func Secret(key string, value interface{}) Field {
+	return Field{Key: key, Value: value, Secret: true}
+}
+
+// redact returns fields with the values of secret fields replaced. fields is copied only if
+// it contains secrets since the caller's slice must not be modified
+func redact(fields []Field) []Field {
+	for i := range fields {
+		if !fields[i].Secret {
+			continue
+		}
+		redacted := make([]Field, len(fields))
+		copy(redacted, fields)
+		for j := i; j < len(redacted); j++ {
+			if redacted[j].Secret {
+				redacted[j].Value = Redacted
+			}
+		}
+		return redacted
+	}
+	return fields
+}
+
+// Logger receives log entries. Secret fields are already redacted when Log is called
+type Logger interface {
+	Log(level Level, msg string, fields []Field)
+}
+
+type nop struct{}
+
+func (nop) Log(level Level, msg string, fields []Field) {}
+
+// Nop is a logger that discards all entries
+var Nop Logger = nop{}
+
+type std struct {
+	min Level
+	l   *log.Logger
+}
+
+// NewStd returns a logger that writes entries at or above min to w, one per line in the
+// form "2006/01/02 15:04:05 level msg key=value"
+func NewStd(w io.Writer, min Level) Logger {
+	return &std{min: min, l: log.New(w, "", log.LstdFlags)}
+}
+
+func (s *std) Log(level Level, msg string, fields []Field) {
+	if level < s.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(formatValue(f.Value))
+	}
+	s.l.Println(b.String())
+}
+
+// formatValue formats a field value, quoting it if it would be ambiguous otherwise
+func formatValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var (
+	mu      sync.RWMutex
+	current = NewStd(os.Stderr, InfoLevel)
+)
+
+// SetLogger sets the logger entries are passed to, nil discards all entries
+func SetLogger(l Logger) {
+	if l == nil {
+		l = Nop
+	}
+	mu.Lock()
+	current = l
+	mu.Unlock()
+}
+
+// GetLogger returns the logger entries are passed to
+func GetLogger() Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Log passes an entry with secret fields redacted to the current logger
+func Log(level Level, msg string, fields ...Field) {
+	GetLogger().Log(level, msg, redact(fields))
+}
+
+// Debug logs an entry at DebugLevel
+func Debug(msg string, fields ...Field) {
+	Log(DebugLevel, msg, fields...)
+}
+
+// Info logs an entry at InfoLevel
+func Info(msg string, fields ...Field) {
+	Log(InfoLevel, msg, fields...)
+}
+
+// Warn logs an entry at WarnLevel
+func Warn(msg string, fields ...Field) {
+	Log(WarnLevel, msg, fields...)
+}
+
+// Error logs an entry at ErrorLevel
+func Error(msg string, fields ...Field) {
+	Log(ErrorLevel, msg, fields...)
+}
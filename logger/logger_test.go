@@ -0,0 +1,86 @@
+// +build all travis
+
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type entry struct {
+	level  Level
+	msg    string
+	fields []Field
+}
+
+type recorder struct {
+	entries []entry
+}
+
+func (r *recorder) Log(level Level, msg string, fields []Field) {
+	r.entries = append(r.entries, entry{level, msg, fields})
+}
+
+func TestLogger(t *testing.T) {
+	defer SetLogger(GetLogger())
+	r := &recorder{}
+	SetLogger(r)
+
+	fields := []Field{F("user", "alice"), Secret("seed", "SXXX"), Secret("pass", "hunter2")}
+	Error("could not send", fields...)
+	Debug("details", Err(errors.New("boom")))
+
+	if len(r.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(r.entries))
+	}
+	e := r.entries[0]
+	if e.level != ErrorLevel || e.msg != "could not send" {
+		t.Fatalf("unexpected entry: %v", e)
+	}
+	if e.fields[0].Value != "alice" || e.fields[1].Value != Redacted || e.fields[2].Value != Redacted {
+		t.Fatalf("secrets weren't redacted: %v", e.fields)
+	}
+	if fields[1].Value != "SXXX" {
+		t.Fatal("redaction modified the caller's fields")
+	}
+	if r.entries[1].level != DebugLevel || r.entries[1].fields[0].Key != "err" {
+		t.Fatalf("unexpected entry: %v", r.entries[1])
+	}
+
+	SetLogger(nil)
+	Error("discarded")
+	if GetLogger() != Nop || len(r.entries) != 2 {
+		t.Fatal("nil logger didn't discard entries")
+	}
+}
+
+func TestStd(t *testing.T) {
+	defer SetLogger(GetLogger())
+	var buf bytes.Buffer
+	SetLogger(NewStd(&buf, InfoLevel))
+
+	Debug("hidden")
+	Warn("disk almost full", F("path", "/var/db"), F("note", "two words"), Secret("key", "abc"))
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Fatalf("debug entry was written at info level: %s", out)
+	}
+	if !strings.HasSuffix(out, `warn disk almost full path=/var/db note="two words" key=[REDACTED]`+"\n") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for l := DebugLevel; l <= ErrorLevel; l++ {
+		parsed, err := ParseLevel(strings.ToUpper(l.String()))
+		if err != nil || parsed != l {
+			t.Fatalf("could not parse %s: %v", l, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatal("parsed unknown level")
+	}
+}
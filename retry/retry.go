@@ -0,0 +1,160 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// package retry calls functions that may fail temporarily again with exponential backoff,
+// such as requests to remote APIs. Errors are retried unless they are marked with Permanent or
+// the Retryable function of the policy rejects them
+
+// Policy describes how often and how long to retry
+type Policy struct {
+	// MaxAttempts is the maximum number of calls, 0 means no limit
+	MaxAttempts int
+	// MaxElapsed is the maximum time spent retrying, 0 means no limit
+	MaxElapsed time.Duration
+	// Initial is the wait before the first retry
+	Initial time.Duration
+	// Max caps the wait between two calls
+	Max time.Duration
+	// Multiplier is the factor the wait grows by after each retry
+	Multiplier float64
+	// Jitter randomizes each wait by up to this fraction of it, so that clients failing
+	// together don't retry together
+	Jitter float64
+	// Retryable decides whether an error is retried, IsRetryable is used if it is nil
+	Retryable func(err error) bool
+}
+
+// DefaultPolicy is a policy suitable for requests to remote APIs
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	MaxElapsed:  time.Minute,
+	Initial:     500 * time.Millisecond,
+	Max:         10 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+}
+
+// Never is a policy that calls the function once
+var Never = Policy{MaxAttempts: 1}
+
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Cause returns the wrapped error so that errors.Cause sees through Permanent
+func (p *permanentError) Cause() error {
+	return p.err
+}
+
+// Permanent marks an error as not worth retrying. Do returns the wrapped error
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// asPermanent returns the error marked with Permanent in the causes of err
+func asPermanent(err error) (*permanentError, bool) {
+	for err != nil {
+		if perm, ok := err.(*permanentError); ok {
+			return perm, true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil, false
+		}
+		err = cause.Cause()
+	}
+	return nil, false
+}
+
+// IsRetryable is the default classification of errors: errors marked with Permanent and
+// context errors aren't retried, any other error is
+func IsRetryable(err error) bool {
+	if _, ok := asPermanent(err); ok {
+		return false
+	}
+	cause := errors.Cause(err)
+	return cause != context.Canceled && cause != context.DeadlineExceeded
+}
+
+// Backoff returns the wait after the given number of failed attempts, without jitter
+func (p Policy) Backoff(attempt int) time.Duration {
+	wait := float64(p.Initial)
+	for i := 1; i < attempt; i++ {
+		wait *= p.Multiplier
+		if p.Max > 0 && wait >= float64(p.Max) {
+			return p.Max
+		}
+	}
+	if p.Max > 0 && wait > float64(p.Max) {
+		return p.Max
+	}
+	return time.Duration(wait)
+}
+
+// jitter randomizes wait by up to the Jitter fraction of the policy
+func (p Policy) jitter(wait time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return wait
+	}
+	return time.Duration(float64(wait) * (1 - p.Jitter + 2*p.Jitter*rand.Float64()))
+}
+
+// Do calls fn until it succeeds, returns an error that isn't retryable, the policy is
+// exhausted or ctx is done. The error of the last call is returned
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if perm, ok := err.(*permanentError); ok {
+			return perm.err
+		}
+		if _, ok := asPermanent(err); ok {
+			return err
+		}
+		if !retryable(err) {
+			return err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return errors.Wrapf(err, "giving up after %d attempts", attempt)
+		}
+
+		wait := p.jitter(p.Backoff(attempt))
+		if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+			return errors.Wrapf(err, "giving up after %s", time.Since(start).Round(time.Millisecond))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(ctx.Err(), "retry stopped, last error: %v", err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// +build all travis
+
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var fast = Policy{
+	MaxAttempts: 4,
+	Initial:     time.Millisecond,
+	Max:         4 * time.Millisecond,
+	Multiplier:  2,
+	Jitter:      0.5,
+}
+
+func TestDo(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	errFatal := errors.New("fatal")
+
+	calls := 0
+	err := Do(context.Background(), fast, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTemporary
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success after 3 calls, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = Do(context.Background(), fast, func(ctx context.Context) error {
+		calls++
+		return errTemporary
+	})
+	if errors.Cause(err) != errTemporary || calls != 4 {
+		t.Fatalf("expected errTemporary after 4 calls, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = Do(context.Background(), fast, func(ctx context.Context) error {
+		calls++
+		return Permanent(errors.Wrap(errFatal, "wrapped"))
+	})
+	if errors.Cause(err) != errFatal || calls != 1 {
+		t.Fatalf("expected errFatal after 1 call, got %v after %d", err, calls)
+	}
+
+	policy := fast
+	policy.Retryable = func(err error) bool {
+		return err != errFatal
+	}
+	calls = 0
+	err = Do(context.Background(), policy, func(ctx context.Context) error {
+		calls++
+		return errFatal
+	})
+	if err != errFatal || calls != 1 {
+		t.Fatalf("expected errFatal after 1 call, got %v after %d", err, calls)
+	}
+
+	// the elapsed time limit stops retries before the attempts run out
+	policy = fast
+	policy.MaxAttempts = 0
+	policy.Initial = 20 * time.Millisecond
+	policy.Max = 0
+	policy.MaxElapsed = 30 * time.Millisecond
+	calls = 0
+	err = Do(context.Background(), policy, func(ctx context.Context) error {
+		calls++
+		return errTemporary
+	})
+	if errors.Cause(err) != errTemporary || calls != 2 {
+		t.Fatalf("expected errTemporary after 2 calls, got %v after %d", err, calls)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{Initial: time.Hour}
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- Do(ctx, policy, func(ctx context.Context) error {
+			calls++
+			return errors.New("temporary")
+		})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if errors.Cause(err) != context.Canceled || calls != 1 {
+			t.Fatalf("expected context.Canceled after 1 call, got %v after %d", err, calls)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Do didn't return after the context was canceled")
+	}
+
+	// context errors returned by fn aren't retried
+	calls = 0
+	err := Do(context.Background(), fast, func(ctx context.Context) error {
+		calls++
+		return errors.Wrap(context.DeadlineExceeded, "request")
+	})
+	if errors.Cause(err) != context.DeadlineExceeded || calls != 1 {
+		t.Fatalf("expected context.DeadlineExceeded after 1 call, got %v after %d", err, calls)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	expected := []time.Duration{1, 2, 4, 4, 4}
+	for i, wait := range expected {
+		if b := fast.Backoff(i + 1); b != wait*time.Millisecond {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, wait*time.Millisecond, b)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		wait := fast.jitter(4 * time.Millisecond)
+		if wait < 2*time.Millisecond || wait > 6*time.Millisecond {
+			t.Fatalf("jitter out of range: %s", wait)
+		}
+	}
+}
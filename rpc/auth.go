@@ -0,0 +1,436 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// ID identifies the caller, eg. the name of an api key or the subject of a token
+	ID string
+	// Scheme is the authentication scheme that was used, eg. "apikey", "hmac" or "jwt"
+	Scheme string
+	// Claims are the claims of a JWT, nil for other schemes
+	Claims map[string]interface{}
+}
+
+// Authenticator authenticates requests. It returns ErrNoCredentials if the request carries
+// no credentials for its scheme, so that the next authenticator can be tried
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Challenger is implemented by authenticators that name their scheme in the WWW-Authenticate
+// header of StatusUnauthorized responses
+type Challenger interface {
+	Challenge() string
+}
+
+// ErrNoCredentials is returned by authenticators for requests without credentials
+var ErrNoCredentials = errors.New("no credentials")
+
+// Auth authenticates every request with the first of the passed authenticators that finds
+// credentials in it and responds with StatusUnauthorized if there are none or they are
+// invalid. Handlers read the caller with PrincipalFrom. Auth should run after CORS so that
+// preflight requests, which carry no credentials, are answered. Responses to requests with
+// invalid credentials challenge the caller with the scheme of the authenticator that rejected
+// them, responses to requests without credentials with the schemes of every authenticator
+func Auth(authenticators ...Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				p, err := a.Authenticate(r)
+				if errors.Cause(err) == ErrNoCredentials {
+					continue
+				}
+				if err != nil {
+					logger.Warn("authentication failed", logger.F("method", r.Method),
+						logger.F("path", r.URL.Path), logger.F("request_id", RequestIDFrom(r)), logger.Err(err))
+					unauthorized(w, a)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey, p)))
+				return
+			}
+			unauthorized(w, authenticators...)
+		})
+	}
+}
+
+// unauthorized responds with StatusUnauthorized, challenging the caller with the schemes of
+// the passed authenticators
+func unauthorized(w http.ResponseWriter, authenticators ...Authenticator) {
+	for _, a := range authenticators {
+		if c, ok := a.(Challenger); ok {
+			w.Header().Add("WWW-Authenticate", c.Challenge())
+		}
+	}
+	ResponseHandler(w, StatusUnauthorized)
+}
+
+// PrincipalFrom returns the caller that Auth authenticated for r
+func PrincipalFrom(r *http.Request) (*Principal, bool) {
+	p, ok := r.Context().Value(principalKey).(*Principal)
+	return p, ok
+}
+
+// APIKeys authenticates requests with static keys sent in a header
+type APIKeys struct {
+	// Header is the header that carries the key, X-API-Key if empty
+	Header string
+	// Keys maps keys to the id of their principal
+	Keys map[string]string
+}
+
+// header returns the header that carries the key
+func (a APIKeys) header() string {
+	if a.Header == "" {
+		return "X-API-Key"
+	}
+	return a.Header
+}
+
+// Challenge implements Challenger
+func (a APIKeys) Challenge() string {
+	return `ApiKey header="` + a.header() + `"`
+}
+
+// Authenticate implements Authenticator
+func (a APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.header())
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	// compare against every key in constant time so the response time doesn't leak them
+	var id string
+	found := 0
+	for k, v := range a.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			id = v
+			found = 1
+		}
+	}
+	if found == 0 {
+		return nil, errors.New("unknown api key")
+	}
+	return &Principal{ID: id, Scheme: "apikey"}, nil
+}
+
+// headers used by HMAC signed requests
+const (
+	KeyIDHeader     = "X-Key-ID"
+	TimestampHeader = "X-Timestamp"
+	NonceHeader     = "X-Nonce"
+	SignatureHeader = "X-Signature"
+)
+
+// maxSignedBody limits the size of the bodies of HMAC signed requests since they are read
+// into memory to be hashed
+const maxSignedBody = 10 << 20
+
+// NonceStore remembers the nonces of signed requests so that they can't be replayed
+type NonceStore interface {
+	// Use records nonce until expires and returns false if it was already recorded
+	Use(nonce string, expires time.Time) bool
+}
+
+type memoryNonces struct {
+	sync.Mutex
+	nonces map[string]time.Time
+	pruned time.Time
+}
+
+// NewMemoryNonceStore returns a NonceStore that keeps nonces in memory. It can only be used by
+// servers running in a single process
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonces{nonces: make(map[string]time.Time)}
+}
+
+func (m *memoryNonces) Use(nonce string, expires time.Time) bool {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	if now.Sub(m.pruned) > time.Minute {
+		for n, exp := range m.nonces {
+			if now.After(exp) {
+				delete(m.nonces, n)
+			}
+		}
+		m.pruned = now
+	}
+	if exp, ok := m.nonces[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	m.nonces[nonce] = expires
+	return true
+}
+
+// HMACAuth authenticates requests signed with SignRequest. The signature covers the method,
+// the request uri, the timestamp, the nonce and the body, requests are rejected if their
+// timestamp is off by more than MaxSkew or their nonce was already used
+type HMACAuth struct {
+	// Secrets maps key ids to their secret, the key id is used as the principal id
+	Secrets map[string][]byte
+	// MaxSkew is how far the timestamp of requests may be from the server's time, 5 minutes
+	// if zero
+	MaxSkew time.Duration
+	// Nonces records used nonces, it must be set
+	Nonces NonceStore
+
+	now func() time.Time
+}
+
+// signature returns the hex encoded signature of a request
+func signature(secret []byte, method string, uri string, timestamp string, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readBody reads the body of r and replaces it so that handlers can still read it
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read body")
+	}
+	r.Body.Close()
+	if len(body) > maxSignedBody {
+		return nil, errors.New("body too large to sign")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// SignRequest signs r for HMACAuth with the passed key. It must be called after the body of r
+// is set
+func SignRequest(r *http.Request, keyID string, secret []byte) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return errors.Wrap(err, "could not generate nonce")
+	}
+	nonce := hex.EncodeToString(b)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	r.Header.Set(KeyIDHeader, keyID)
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, signature(secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+	return nil
+}
+
+// Challenge implements Challenger
+func (a HMACAuth) Challenge() string {
+	return "HMAC"
+}
+
+// Authenticate implements Authenticator
+func (a HMACAuth) Authenticate(r *http.Request) (*Principal, error) {
+	keyID := r.Header.Get(KeyIDHeader)
+	sig := r.Header.Get(SignatureHeader)
+	if keyID == "" && sig == "" {
+		return nil, ErrNoCredentials
+	}
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	if keyID == "" || sig == "" || timestamp == "" || nonce == "" {
+		return nil, errors.New("incomplete signature headers")
+	}
+	if a.Nonces == nil {
+		return nil, errors.New("no nonce store configured")
+	}
+
+	secret, ok := a.Secrets[keyID]
+	if !ok {
+		return nil, errors.New("unknown key id")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid timestamp")
+	}
+	skew := a.MaxSkew
+	if skew == 0 {
+		skew = 5 * time.Minute
+	}
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	signed := time.Unix(unix, 0)
+	if signed.Before(now().Add(-skew)) || signed.After(now().Add(skew)) {
+		return nil, errors.New("timestamp outside allowed window")
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	expected := signature(secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(sig))) {
+		return nil, errors.New("invalid signature")
+	}
+	// only record nonces of valid requests so that others can't burn them. A nonce can't be
+	// replayed once its timestamp is outside the window, so it is kept until then
+	if !a.Nonces.Use(keyID+":"+nonce, signed.Add(skew)) {
+		return nil, errors.New("nonce already used")
+	}
+	return &Principal{ID: keyID, Scheme: "hmac"}, nil
+}
+
+// JWTAuth authenticates requests with JWT bearer tokens in the Authorization header. Tokens
+// must be signed with HS256 if HMACKey is set or EdDSA if PublicKey is set and must carry an
+// exp claim and a string sub claim, which is used as the principal id
+type JWTAuth struct {
+	// HMACKey verifies HS256 tokens
+	HMACKey []byte
+	// PublicKey verifies EdDSA tokens
+	PublicKey ed25519.PublicKey
+	// Issuer is compared with the iss claim if it is set
+	Issuer string
+	// Audience must be in the aud claim if it is set
+	Audience string
+	// Leeway allows for clock differences when checking exp and nbf
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// Challenge implements Challenger
+func (a JWTAuth) Challenge() string {
+	return "Bearer"
+}
+
+// Authenticate implements Authenticator
+func (a JWTAuth) Authenticate(r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	parts := strings.Split(strings.TrimSpace(auth[7:]), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed token header")
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.Wrap(err, "malformed token header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed token signature")
+	}
+
+	// the algorithm is checked against the configured keys so that tokens can't pick a
+	// weaker one, eg. "none"
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && len(a.HMACKey) > 0:
+		mac := hmac.New(sha256.New, a.HMACKey)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return nil, errors.New("invalid token signature")
+		}
+	case header.Alg == "EdDSA" && len(a.PublicKey) == ed25519.PublicKeySize:
+		if !ed25519.Verify(a.PublicKey, signed, sig) {
+			return nil, errors.New("invalid token signature")
+		}
+	default:
+		return nil, errors.New("unsupported token algorithm: " + header.Alg)
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed token claims")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, errors.Wrap(err, "malformed token claims")
+	}
+	if err := a.validate(claims); err != nil {
+		return nil, err
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return nil, errors.New("token has no sub claim")
+	}
+	return &Principal{ID: sub, Scheme: "jwt", Claims: claims}, nil
+}
+
+// validate checks the time, issuer and audience claims of a token
+func (a JWTAuth) validate(claims map[string]interface{}) error {
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	t := now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no exp claim")
+	}
+	if t.After(time.Unix(int64(exp), 0).Add(a.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && t.Before(time.Unix(int64(nbf), 0).Add(-a.Leeway)) {
+		return errors.New("token not valid yet")
+	}
+	if a.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.Issuer {
+			return errors.New("invalid token issuer")
+		}
+	}
+	if a.Audience != "" {
+		switch aud := claims["aud"].(type) {
+		case string:
+			if aud == a.Audience {
+				return nil
+			}
+		case []interface{}:
+			for _, x := range aud {
+				if s, _ := x.(string); s == a.Audience {
+					return nil
+				}
+			}
+		}
+		return errors.New("invalid token audience")
+	}
+	return nil
+}
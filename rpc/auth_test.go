@@ -0,0 +1,188 @@
+// +build all travis
+
+package rpc
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func authServer(authenticators ...Authenticator) *Server {
+	s := NewServer(Auth(authenticators...))
+	s.Post("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFrom(r)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(p.Scheme + ":" + p.ID + ":" + string(body)))
+	})
+	return s
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := authServer(APIKeys{Keys: map[string]string{"secret-key": "billing"}})
+
+	r := httptest.NewRequest("POST", "/whoami", strings.NewReader("hi"))
+	r.Header.Set("X-API-Key", "secret-key")
+	if w := serve(s, r); w.Code != StatusOK || w.Body.String() != "apikey:billing:hi" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+
+	for _, key := range []string{"", "wrong-key"} {
+		r = httptest.NewRequest("POST", "/whoami", nil)
+		r.Header.Set("X-API-Key", key)
+		w := serve(s, r)
+		if w.Code != StatusUnauthorized {
+			t.Fatalf("key %q: expected status 401, got %d", key, w.Code)
+		}
+		if h := w.Header().Get("WWW-Authenticate"); h != `ApiKey header="X-API-Key"` {
+			t.Fatalf("key %q: unexpected challenge %q", key, h)
+		}
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	secret := []byte("shared secret")
+	now := time.Now()
+	auth := HMACAuth{
+		Secrets: map[string][]byte{"worker": secret},
+		Nonces:  NewMemoryNonceStore(),
+		now:     func() time.Time { return now },
+	}
+	s := authServer(auth)
+
+	r := httptest.NewRequest("POST", "/whoami?x=1", strings.NewReader("payload"))
+	if err := SignRequest(r, "worker", secret); err != nil {
+		t.Fatal(err)
+	}
+	header := r.Header.Clone()
+	if w := serve(s, r); w.Code != StatusOK || w.Body.String() != "hmac:worker:payload" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+
+	// replaying the same request fails
+	r = httptest.NewRequest("POST", "/whoami?x=1", strings.NewReader("payload"))
+	r.Header = header.Clone()
+	if w := serve(s, r); w.Code != StatusUnauthorized {
+		t.Fatalf("replayed request wasn't rejected: %d", w.Code)
+	}
+
+	// tampering with the body or query fails
+	for _, target := range []string{"/whoami?x=1", "/whoami?x=2"} {
+		r = httptest.NewRequest("POST", "/whoami?x=1", strings.NewReader("payload"))
+		if err := SignRequest(r, "worker", secret); err != nil {
+			t.Fatal(err)
+		}
+		tampered := httptest.NewRequest("POST", target, strings.NewReader("other"))
+		tampered.Header = r.Header
+		if w := serve(s, tampered); w.Code != StatusUnauthorized {
+			t.Fatalf("tampered request to %s wasn't rejected: %d", target, w.Code)
+		}
+	}
+
+	// old requests fail
+	now = now.Add(10 * time.Minute)
+	s = authServer(auth)
+	r = httptest.NewRequest("POST", "/whoami", nil)
+	if err := SignRequest(r, "worker", secret); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(s, r); w.Code != StatusUnauthorized {
+		t.Fatalf("expired request wasn't rejected: %d", w.Code)
+	}
+}
+
+func jwt(t *testing.T, alg string, claims map[string]interface{}, sign func([]byte) []byte) string {
+	header, _ := json.Marshal(jwtHeader{Alg: alg, Typ: "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestJWTAuth(t *testing.T) {
+	key := []byte("jwt secret")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256 := func(data []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return mac.Sum(nil)
+	}
+	eddsa := func(data []byte) []byte {
+		return ed25519.Sign(priv, data)
+	}
+	none := func(data []byte) []byte {
+		return nil
+	}
+
+	s := authServer(JWTAuth{HMACKey: key, PublicKey: pub, Issuer: "essentials", Audience: "api"},
+		APIKeys{Keys: map[string]string{"k": "keyed"}})
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := map[string]interface{}{"sub": "alice", "iss": "essentials", "aud": []string{"web", "api"}, "exp": exp}
+
+	for _, token := range []string{jwt(t, "HS256", valid, hs256), jwt(t, "EdDSA", valid, eddsa)} {
+		r := httptest.NewRequest("POST", "/whoami", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if w := serve(s, r); w.Code != StatusOK || w.Body.String() != "jwt:alice:" {
+			t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+		}
+	}
+
+	invalid := []string{
+		jwt(t, "none", valid, none),
+		jwt(t, "HS256", valid, eddsa),
+		jwt(t, "EdDSA", valid, hs256),
+		jwt(t, "HS256", map[string]interface{}{"sub": "alice", "iss": "essentials", "aud": "api"}, hs256),
+		jwt(t, "HS256", map[string]interface{}{"sub": "alice", "iss": "essentials", "aud": "api", "exp": time.Now().Add(-time.Hour).Unix()}, hs256),
+		jwt(t, "HS256", map[string]interface{}{"sub": "alice", "iss": "other", "aud": "api", "exp": exp}, hs256),
+		jwt(t, "HS256", map[string]interface{}{"sub": "alice", "iss": "essentials", "aud": "web", "exp": exp}, hs256),
+		jwt(t, "HS256", map[string]interface{}{"iss": "essentials", "aud": "api", "exp": exp}, hs256),
+		jwt(t, "HS256", map[string]interface{}{"sub": 1, "iss": "essentials", "aud": "api", "exp": exp}, hs256),
+		"not.a.token",
+	}
+	for i, token := range invalid {
+		r := httptest.NewRequest("POST", "/whoami", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		// an invalid token isn't rescued by a later authenticator
+		r.Header.Set("X-API-Key", "k")
+		w := serve(s, r)
+		if w.Code != StatusUnauthorized {
+			t.Fatalf("invalid token %d wasn't rejected: %d", i, w.Code)
+		}
+		// only the rejecting authenticator challenges the caller
+		if h := w.Header()["Www-Authenticate"]; len(h) != 1 || h[0] != "Bearer" {
+			t.Fatalf("invalid token %d: unexpected challenge %q", i, h)
+		}
+	}
+
+	// requests without credentials are challenged with every scheme
+	w := serve(s, httptest.NewRequest("POST", "/whoami", nil))
+	if h := w.Header()["Www-Authenticate"]; w.Code != StatusUnauthorized || len(h) != 2 {
+		t.Fatalf("unexpected response: %d %q", w.Code, h)
+	}
+
+	r := httptest.NewRequest("POST", "/whoami", nil)
+	r.Header.Set("X-API-Key", "k")
+	if w := serve(s, r); w.Code != StatusOK || w.Body.String() != "apikey:keyed:" {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,8 @@ package rpc
 
 import (
 	"time"
+
+	"github.com/Varunram/essentials/retry"
 )
 
 // TimeoutVal is the timeout associated with a single call
@@ -11,3 +13,11 @@ var TimeoutVal = 5 * time.Second
 func SetConsts(timeout int) {
 	TimeoutVal = time.Duration(time.Duration(timeout) * time.Second)
 }
+
+// RetryPolicy is the policy GetRequest retries failed requests with
+var RetryPolicy = retry.DefaultPolicy
+
+// SetRetryPolicy sets the policy GetRequest retries failed requests with
+func SetRetryPolicy(policy retry.Policy) {
+	RetryPolicy = policy
+}
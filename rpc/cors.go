@@ -0,0 +1,194 @@
+package rpc
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which cross origin requests a server accepts. It is applied with the
+// CORS middleware, which adds the CORS headers to responses and answers preflight requests
+type CORSPolicy struct {
+	// AllowedOrigins are the origins that may make requests, eg. https://example.com. "*"
+	// allows any origin
+	AllowedOrigins []string
+	// AllowedOriginPattern allows origins matching it in addition to AllowedOrigins
+	AllowedOriginPattern *regexp.Regexp
+	// AllowedMethods are the methods allowed in preflight requests, GET, HEAD, POST, PUT
+	// and DELETE if empty
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in preflight requests, "*" allows any
+	// header. Accept, Authorization, Cache-Control and Content-Type are allowed if empty
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that scripts may read
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies and authorization headers
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses, they use their own default
+	// if it is zero
+	MaxAge time.Duration
+}
+
+// DefaultCORS allows requests from any origin, as the handlers of this package used to
+var DefaultCORS = CORSPolicy{AllowedOrigins: []string{"*"}}
+
+// LocalhostCORS allows requests from pages served on localhost
+var LocalhostCORS = CORSPolicy{
+	AllowedOriginPattern: regexp.MustCompile(`^https?://(localhost|127\.0\.0\.1|\[::1\])(:[0-9]+)?$`),
+}
+
+// DefaultServeMuxCORS is the policy applied to http.DefaultServeMux by DefaultServeMuxHandler,
+// StartServer and StartTLSServer. ResponseHandler and MarshalSend used to allow any origin
+// themselves, so it is DefaultCORS unless changed
+var DefaultServeMuxCORS = DefaultCORS
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCORSHeaders = []string{"Accept", "Authorization", "Cache-Control", "Content-Type"}
+)
+
+// AllowsOrigin returns whether requests from origin are allowed. Origins are compared
+// exactly, so http://localhost.example.com is not allowed by http://localhost
+func (p CORSPolicy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return p.AllowedOriginPattern != nil && p.AllowedOriginPattern.MatchString(origin)
+}
+
+func (p CORSPolicy) anyOrigin() bool {
+	return contains(p.AllowedOrigins, "*")
+}
+
+func (p CORSPolicy) methods() []string {
+	if len(p.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return p.AllowedMethods
+}
+
+func (p CORSPolicy) headers() []string {
+	if len(p.AllowedHeaders) == 0 {
+		return defaultCORSHeaders
+	}
+	return p.AllowedHeaders
+}
+
+// allowsHeaders returns whether all headers in the comma separated list are allowed
+func (p CORSPolicy) allowsHeaders(list string) bool {
+	allowed := p.headers()
+	if contains(allowed, "*") {
+		return true
+	}
+	for _, header := range strings.Split(list, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		ok := false
+		for _, a := range allowed {
+			if strings.EqualFold(a, header) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// CORS applies the passed policy to every request. It should be passed to NewServer or
+// Server.Use rather than to single routes so that it sees preflight requests before they are
+// routed. Requests from origins that aren't allowed are served without CORS headers, which
+// makes browsers reject the response
+func CORS(policy CORSPolicy) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			h := w.Header()
+			// responses depend on the origin unless every origin gets the same one
+			if !policy.anyOrigin() || policy.AllowCredentials {
+				h.Add("Vary", "Origin")
+			}
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if !policy.AllowsOrigin(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if preflight {
+				method := r.Header.Get("Access-Control-Request-Method")
+				requested := r.Header.Get("Access-Control-Request-Headers")
+				if !contains(policy.methods(), method) || !policy.allowsHeaders(requested) {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+
+			if policy.anyOrigin() && !policy.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				// browsers reject "*" on requests with credentials
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(policy.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Methods", strings.Join(policy.methods(), ", "))
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" && contains(policy.headers(), "*") {
+				h.Set("Access-Control-Allow-Headers", requested)
+			} else {
+				h.Set("Access-Control-Allow-Headers", strings.Join(policy.headers(), ", "))
+			}
+			if policy.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// DefaultServeMuxHandler returns http.DefaultServeMux with DefaultServeMuxCORS applied, for
+// servers registering their handlers with SetupBasicHandlers and http.HandleFunc
+func DefaultServeMuxHandler() http.Handler {
+	return CORS(DefaultServeMuxCORS)(http.DefaultServeMux)
+}
+
+// StartServer serves http.DefaultServeMux on addr with DefaultServeMuxCORS applied. It replaces
+// http.ListenAndServe(addr, nil) for servers that relied on the CORS headers older versions of
+// ResponseHandler and MarshalSend added
+func StartServer(addr string) error {
+	return http.ListenAndServe(addr, DefaultServeMuxHandler())
+}
+
+// StartTLSServer serves http.DefaultServeMux on addr over TLS with DefaultServeMuxCORS applied
+func StartTLSServer(addr string, certFile string, keyFile string) error {
+	return http.ListenAndServeTLS(addr, certFile, keyFile, DefaultServeMuxHandler())
+}
@@ -0,0 +1,135 @@
+// +build all travis
+
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func corsRequest(h http.Handler, method string, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/data", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCORS(t *testing.T) {
+	policy := CORSPolicy{
+		AllowedOrigins:       []string{"https://app.example.com"},
+		AllowedOriginPattern: regexp.MustCompile(`^https://[a-z]+\.example\.org$`),
+		AllowedMethods:       []string{"GET", "POST"},
+		AllowedHeaders:       []string{"Content-Type", "X-Api-Key"},
+		ExposedHeaders:       []string{RequestIDHeader},
+		AllowCredentials:     true,
+		MaxAge:               10 * time.Minute,
+	}
+	s := NewServer(CORS(policy))
+	s.Get("/data", func(w http.ResponseWriter, r *http.Request) {
+		MarshalSend(w, "data")
+	})
+
+	w := corsRequest(s, "GET", "https://app.example.com", nil)
+	h := w.Header()
+	if w.Code != StatusOK || h.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" || h.Get("Access-Control-Expose-Headers") != RequestIDHeader {
+		t.Fatalf("unexpected response: %d %v", w.Code, h)
+	}
+	if len(h["Access-Control-Allow-Origin"]) != 1 || h.Get("Vary") != "Origin" {
+		t.Fatalf("unexpected headers: %v", h)
+	}
+
+	w = corsRequest(s, "OPTIONS", "https://docs.example.org", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "x-api-key, content-type",
+	})
+	h = w.Header()
+	if w.Code != http.StatusNoContent || h.Get("Access-Control-Allow-Origin") != "https://docs.example.org" ||
+		h.Get("Access-Control-Allow-Methods") != "GET, POST" || h.Get("Access-Control-Allow-Headers") != "Content-Type, X-Api-Key" ||
+		h.Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("unexpected preflight response: %d %v", w.Code, h)
+	}
+
+	rejected := []struct {
+		method  string
+		origin  string
+		headers map[string]string
+	}{
+		{"GET", "https://evil.com", nil},
+		{"GET", "https://app.example.com.evil.com", nil},
+		{"OPTIONS", "https://evil.com", map[string]string{"Access-Control-Request-Method": "GET"}},
+		{"OPTIONS", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"}},
+		{"OPTIONS", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Other"}},
+	}
+	for _, c := range rejected {
+		w = corsRequest(s, c.method, c.origin, c.headers)
+		if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Methods") != "" {
+			t.Fatalf("%s from %s wasn't rejected: %v", c.method, c.origin, w.Header())
+		}
+	}
+
+	// requests without an origin aren't cross origin requests
+	w = corsRequest(s, "GET", "", nil)
+	if w.Code != StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+
+	s = NewServer(CORS(DefaultCORS))
+	s.Get("/data", func(w http.ResponseWriter, r *http.Request) {
+		ResponseHandler(w, StatusOK)
+	})
+	w = corsRequest(s, "GET", "https://anywhere.com", nil)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Vary") != "" {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+}
+
+func TestDefaultServeMuxCORS(t *testing.T) {
+	http.HandleFunc("/cors-test", func(w http.ResponseWriter, r *http.Request) {
+		MarshalSend(w, "data")
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/cors-test", nil)
+	r.Header.Set("Origin", "https://anywhere.com")
+	DefaultServeMuxHandler().ServeHTTP(w, r)
+	if w.Code != StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("OPTIONS", "/cors-test", nil)
+	r.Header.Set("Origin", "https://anywhere.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	DefaultServeMuxHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Fatalf("unexpected preflight response: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	for origin, ok := range map[string]bool{
+		"http://localhost":            true,
+		"http://localhost:8080":       true,
+		"https://127.0.0.1:443":       true,
+		"http://localhost.evil.com":   false,
+		"https://evil.com/?localhost": false,
+		"":                            false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		if err := CheckOrigin(w, r); (err == nil) != ok {
+			t.Fatalf("origin %q: expected allowed %v, got %v", origin, ok, err)
+		}
+	}
+}
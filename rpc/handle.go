@@ -1,8 +1,9 @@
 package rpc
 
 import (
-	"log"
 	"net/http"
+
+	"github.com/Varunram/essentials/logger"
 )
 
 // Err prints an error and returns to the caller
@@ -19,10 +20,11 @@ func Err(w http.ResponseWriter, err error, status int, msgs ...string) bool {
 	}
 
 	if err != nil {
-		log.Println(err)
+		msg := "request failed"
 		if print {
-			log.Println(msgs[0])
+			msg = msgs[0]
 		}
+		logger.Error(msg, logger.Err(err))
 		if retmsg {
 			ResponseHandler(w, StatusBadRequest, msgs[1])
 		} else {
@@ -4,12 +4,13 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
 )
 
 // SetupLocalHttpsClient can be used to setup a local client configured to accept a user generated cert
@@ -21,13 +22,13 @@ func SetupLocalHttpsClient(path string, timeout time.Duration) *http.Client {
 
 	certs, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Println("failed to read from file: ", err)
+		logger.Error("failed to read from file", logger.Err(err))
 		panic(err)
 	}
 
 	// Append our cert to the system pool
 	if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
-		log.Println("No certs appended, using system certs only")
+		logger.Warn("no certs appended, using system certs only", logger.F("path", path))
 	}
 
 	config := &tls.Config{
@@ -43,7 +44,7 @@ func HttpsGet(client *http.Client, url string) ([]byte, error) {
 	// Read in the cert file
 	res, err := client.Get(url)
 	if err != nil {
-		log.Println("did not make request: ", err)
+		logger.Error("did not make request", logger.Err(err))
 		return nil, errors.Wrap(err, "did not make request")
 	}
 
@@ -55,7 +56,7 @@ func HttpsGet(client *http.Client, url string) ([]byte, error) {
 
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not read response body", logger.Err(err))
 	}
 	return data, err
 }
@@ -65,7 +66,7 @@ func HttpsPost(client *http.Client, url string, postdata url.Values) ([]byte, er
 	// Read in the cert file
 	res, err := client.PostForm(url, postdata)
 	if err != nil {
-		log.Println("did not make request: ", err)
+		logger.Error("did not make request", logger.Err(err))
 		return nil, errors.Wrap(err, "did not make request")
 	}
 
@@ -77,7 +78,7 @@ func HttpsPost(client *http.Client, url string, postdata url.Values) ([]byte, er
 
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not read response body", logger.Err(err))
 	}
 	return data, err
 }
@@ -0,0 +1,152 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// middleware that can be passed to NewServer, Server.Use and Server.Handle. A typical server
+// uses NewServer(RequestID, Logging, Recovery) so that log entries carry the request id and
+// panics are logged like any other failed request
+
+// statusWriter records the status code and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Flush sends buffered data to the client if the underlying writer supports it
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Logging logs every request with its status, size and duration
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		fields := []logger.Field{
+			logger.F("method", r.Method),
+			logger.F("path", r.URL.Path),
+			logger.F("status", status),
+			logger.F("size", sw.size),
+			logger.F("duration", time.Since(start)),
+			logger.F("remote", r.RemoteAddr),
+		}
+		if id := RequestIDFrom(r); id != "" {
+			fields = append(fields, logger.F("request_id", id))
+		}
+		logger.Info("request", fields...)
+	})
+}
+
+// Recovery recovers from panics in handlers, logs them and responds with
+// StatusInternalServerError so that one bad request doesn't take down the connection
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// net/http uses this panic to abort responses on purpose
+				panic(p)
+			}
+			logger.Error("recovered from panic", logger.F("panic", p), logger.F("method", r.Method),
+				logger.F("path", r.URL.Path), logger.F("request_id", RequestIDFrom(r)), logger.F("stack", string(debug.Stack())))
+			ResponseHandler(w, StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestIDHeader is the header RequestID reads request ids from and writes them to
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID gives every request an id that is returned in the RequestIDHeader of the response
+// and can be read by handlers with RequestIDFrom. Ids sent by the client are kept if they are
+// short and contain only letters, digits, '-', '_' and '.'
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestIDFrom returns the id that RequestID assigned to r, or an empty string
+func RequestIDFrom(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// the id is only used to correlate log entries, a fixed one is better than failing
+		logger.Error("could not generate request id", logger.Err(err))
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Timeout cancels the context of requests that take longer than d and responds to them with
+// StatusServiceUnavailable. Handlers should stop working once their context is done
+func Timeout(d time.Duration) Middleware {
+	body, _ := json.Marshal(StatusResponse{
+		Code:    StatusServiceUnavailable,
+		Status:  "Service Unavailable error",
+		Message: "request timed out",
+	})
+	return func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, d, string(body))
+	}
+}
@@ -2,8 +2,9 @@ package rpc
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+
+	"github.com/Varunram/essentials/logger"
 )
 
 // define these here since we only have stuff that's needed / supported
@@ -15,6 +16,7 @@ const (
 	StatusUnauthorized        = http.StatusUnauthorized        //  401 RFC 7235, 3.1
 	StatusPaymentRequired     = http.StatusPaymentRequired     //  402 RFC 7231, 6.5.2
 	StatusNotFound            = http.StatusNotFound            //  404 RFC 7231, 6.5.4
+	StatusMethodNotAllowed    = http.StatusMethodNotAllowed    //  405 RFC 7231, 6.5.5
 	StatusInternalServerError = http.StatusInternalServerError //  500 RFC 7231, 6.6.1
 	StatusBadGateway          = http.StatusBadGateway          //  502 RFC 7231, 6.6.3
 	StatusLocked              = http.StatusLocked              //  423 RFC 4918, 11.3
@@ -35,9 +37,6 @@ type StatusResponse struct {
 // completion of certain calls
 func ResponseHandler(w http.ResponseWriter, status int, messages ...string) {
 	var response StatusResponse
-	w.Header().Add("Access-Control-Allow-Headers", "Accept, Authorization, Cache-Control, Content-Type")
-	w.Header().Add("Access-Control-Allow-Methods", "*")
-	w.Header().Add("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 	response.Code = status
 	switch status {
@@ -62,6 +61,9 @@ func ResponseHandler(w http.ResponseWriter, status int, messages ...string) {
 	case StatusNotFound:
 		w.WriteHeader(StatusNotFound)
 		response.Status = "404 Error Not Found!"
+	case StatusMethodNotAllowed:
+		w.WriteHeader(StatusMethodNotAllowed)
+		response.Status = "Method not allowed"
 	case StatusInternalServerError:
 		w.WriteHeader(StatusInternalServerError)
 		response.Status = "Internal Server Error"
@@ -98,13 +100,10 @@ func ResponseHandler(w http.ResponseWriter, status int, messages ...string) {
 
 // MarshalSend marshals and writes a json string
 func MarshalSend(w http.ResponseWriter, x interface{}) {
-	w.Header().Add("Access-Control-Allow-Headers", "Accept, Authorization, Cache-Control, Content-Type")
-	w.Header().Add("Access-Control-Allow-Methods", "*")
-	w.Header().Add("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 	xJSON, err := json.Marshal(x)
 	if err != nil {
-		log.Println("could not marshal json: ", err)
+		logger.Error("could not marshal json", logger.Err(err))
 		WriteToHandler(w, []byte("did not marshal json"))
 		return
 	}
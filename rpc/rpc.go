@@ -1,28 +1,33 @@
 package rpc
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
-	"strings"
 
 	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+	"github.com/Varunram/essentials/retry"
 )
 
 // SetupBasicHandlers sets up two handler functions that serve ping and default response at /
+// on the default mux. New servers should use NewServer and Server.HandlePing instead
 func SetupBasicHandlers() {
 	SetupDefaultHandler()
 	SetupPingHandler()
 }
 
-// CheckOrigin checks if the origin of the incoming request is localhost
+// CheckOrigin checks if the origin of the incoming request is allowed by LocalhostCORS. Servers
+// that accept cross origin requests should use the CORS middleware instead
 func CheckOrigin(w http.ResponseWriter, r *http.Request) error {
-	if !strings.Contains(r.Header.Get("Origin"), "localhost") {
+	if !LocalhostCORS.AllowsOrigin(r.Header.Get("Origin")) {
 		ResponseHandler(w, StatusNotFound)
-		log.Println("origin not localhost")
+		logger.Warn("origin not localhost", logger.F("origin", r.Header.Get("Origin")))
 		return errors.New("origin not localhost")
 	}
 	return nil
@@ -33,7 +38,7 @@ func CheckGet(w http.ResponseWriter, r *http.Request) error {
 	//err := CheckOrigin(w, r)
 	if r.Method != "GET" {
 		ResponseHandler(w, StatusNotFound)
-		log.Println("method not get")
+		logger.Warn("method not get", logger.F("method", r.Method), logger.F("path", r.URL.Path))
 		return errors.New("method not get")
 	}
 	return nil
@@ -44,7 +49,7 @@ func CheckPost(w http.ResponseWriter, r *http.Request) error {
 	//err := CheckOrigin(w, r)
 	if r.Method != "POST" {
 		ResponseHandler(w, StatusNotFound)
-		log.Println("method not post")
+		logger.Warn("method not post", logger.F("method", r.Method), logger.F("path", r.URL.Path))
 		return errors.New("method not post")
 	}
 	return nil
@@ -53,42 +58,82 @@ func CheckPost(w http.ResponseWriter, r *http.Request) error {
 // CheckPut checks whether the incoming request is a PUT request
 func CheckPut(w http.ResponseWriter, r *http.Request) error {
 	err := CheckOrigin(w, r)
-	if err != nil || r.Method != "PUT" {
+	if err != nil {
+		// CheckOrigin has already responded
+		return err
+	}
+	if r.Method != "PUT" {
 		ResponseHandler(w, StatusNotFound)
-		log.Println("method not put or origin not localhost")
-		return errors.New("method not put or origin not localhost")
+		logger.Warn("method not put", logger.F("method", r.Method), logger.F("path", r.URL.Path))
+		return errors.New("method not put")
 	}
 	return nil
 }
 
-// GetRequest is a handler that makes it easy to send out GET requests
+// StatusError is returned by GetRequestContext for responses with an error status code
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d", e.Code)
+}
+
+// Temporary returns whether the request may succeed if it is retried
+func (e *StatusError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// GetRequest is a handler that makes it easy to send out GET requests. Requests failing with
+// a network error or a temporary status code are retried with RetryPolicy, the bodies of other
+// error responses are returned without an error
 func GetRequest(url string) ([]byte, error) {
-	var dummy []byte
-	client := &http.Client{
-		Timeout: TimeoutVal,
+	data, err := GetRequestContext(context.Background(), RetryPolicy, url)
+	if serr, ok := errors.Cause(err).(*StatusError); ok && !serr.Temporary() {
+		return data, nil
 	}
+	return data, err
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Println("did not create new GET request: ", err)
-		return dummy, errors.Wrap(err, "did not create new GET request")
+// GetRequestContext sends out a GET request, retrying with policy on network errors and
+// temporary status codes. Error responses return a StatusError along with their body
+func GetRequestContext(ctx context.Context, policy retry.Policy, url string) ([]byte, error) {
+	client := &http.Client{
+		Timeout: TimeoutVal,
 	}
 
-	req.Close = true
+	var data []byte
+	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			logger.Error("did not create new GET request", logger.Err(err))
+			return retry.Permanent(errors.Wrap(err, "did not create new GET request"))
+		}
 
-	res, err := client.Do(req)
-	if err != nil {
-		log.Println("did not make request: ", err)
-		return dummy, errors.Wrap(err, "did not make request")
-	}
+		req = req.WithContext(ctx)
+		req.Close = true
 
-	defer func() {
-		if ferr := res.Body.Close(); ferr != nil {
-			err = ferr
+		res, err := client.Do(req)
+		if err != nil {
+			logger.Error("did not make request", logger.Err(err))
+			return errors.Wrap(err, "did not make request")
 		}
-	}()
+		defer res.Body.Close()
 
-	return ioutil.ReadAll(res.Body)
+		data, err = ioutil.ReadAll(res.Body)
+		if err != nil {
+			return errors.Wrap(err, "could not read response body")
+		}
+		if res.StatusCode >= 400 {
+			serr := &StatusError{Code: res.StatusCode}
+			if !serr.Temporary() {
+				return retry.Permanent(serr)
+			}
+			return serr
+		}
+		return nil
+	})
+	return data, err
 }
 
 // PutRequest is a handler that makes it easy to send out PUT requests
@@ -100,7 +145,7 @@ func PutRequest(body string, payload io.Reader) ([]byte, error) {
 
 	req, err := http.NewRequest("PUT", body, payload)
 	if err != nil {
-		log.Println("did not create new PUT request: ", err)
+		logger.Error("did not create new PUT request", logger.Err(err))
 		return nil, errors.Wrap(err, "did not create new PUT request")
 	}
 
@@ -108,7 +153,7 @@ func PutRequest(body string, payload io.Reader) ([]byte, error) {
 
 	res, err := client.Do(req)
 	if err != nil {
-		log.Println("did not make request: ", err)
+		logger.Error("did not make request", logger.Err(err))
 		return nil, errors.Wrap(err, "did not make request")
 	}
 
@@ -130,13 +175,13 @@ func PostRequest(body string, payload io.Reader) ([]byte, error) {
 
 	req, err := http.NewRequest("POST", body, payload)
 	if err != nil {
-		log.Println("did not create new POST request: ", err)
+		logger.Error("did not create new POST request", logger.Err(err))
 		return nil, errors.Wrap(err, "did not create new POST request")
 	}
 
 	res, err := client.Do(req)
 	if err != nil {
-		log.Println("did not make request: ", err)
+		logger.Error("did not make request", logger.Err(err))
 		return nil, errors.Wrap(err, "did not make request")
 	}
 
@@ -153,7 +198,7 @@ func PostRequest(body string, payload io.Reader) ([]byte, error) {
 func PostForm(body string, postdata url.Values) ([]byte, error) {
 	data, err := http.PostForm(body, postdata)
 	if err != nil {
-		log.Println("could not relay get request: ", err)
+		logger.Error("could not relay get request", logger.Err(err))
 		return nil, errors.Wrap(err, "could not relay get request")
 	}
 
@@ -170,14 +215,14 @@ func PostForm(body string, postdata url.Values) ([]byte, error) {
 func GetAndSendJson(w http.ResponseWriter, body string, x interface{}) {
 	data, err := GetRequest(body)
 	if err != nil {
-		log.Println("did not get response: ", err)
+		logger.Error("did not get response", logger.Err(err))
 		ResponseHandler(w, StatusBadRequest)
 		return
 	}
 	// now data is in byte, we need the other structure now
 	err = json.Unmarshal(data, &x)
 	if err != nil {
-		log.Println("did not unmarshal json: ", err)
+		logger.Error("did not unmarshal json", logger.Err(err))
 		ResponseHandler(w, StatusInternalServerError)
 		return
 	}
@@ -189,7 +234,7 @@ func GetAndSendJson(w http.ResponseWriter, body string, x interface{}) {
 func GetAndSendByte(w http.ResponseWriter, body string) {
 	data, err := GetRequest(body)
 	if err != nil {
-		log.Println("did not get response: ", err)
+		logger.Error("did not get response", logger.Err(err))
 		ResponseHandler(w, StatusBadRequest)
 		return
 	}
@@ -201,7 +246,7 @@ func GetAndSendByte(w http.ResponseWriter, body string) {
 func PutAndSend(w http.ResponseWriter, body string, payload io.Reader) {
 	data, err := PutRequest(body, payload)
 	if err != nil {
-		log.Println("did not receive success response", err)
+		logger.Error("did not receive success response", logger.Err(err))
 		ResponseHandler(w, StatusBadRequest)
 		return
 	}
@@ -209,7 +254,7 @@ func PutAndSend(w http.ResponseWriter, body string, payload io.Reader) {
 	var x interface{}
 	err = json.Unmarshal(data, &x)
 	if err != nil {
-		log.Println("did not unmarshal json", err)
+		logger.Error("did not unmarshal json", logger.Err(err))
 		ResponseHandler(w, StatusInternalServerError)
 		return
 	}
@@ -221,7 +266,7 @@ func SetupDefaultHandler() {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		err := CheckGet(w, r)
 		if err != nil {
-			log.Println(err) // don't return a response since we've already written to the API caller
+			// don't return a response since we've already written to the API caller
 			return
 		}
 		ResponseHandler(w, StatusNotFound) // default response for routes not found is 404
@@ -233,7 +278,7 @@ func SetupPingHandler() {
 	http.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		err := CheckGet(w, r)
 		if err != nil {
-			log.Println(err) // don't return a response since we've already written to the API caller
+			// don't return a response since we've already written to the API caller
 			return
 		}
 		ResponseHandler(w, StatusOK)
@@ -244,12 +289,12 @@ func SetupPingHandler() {
 func CheckHTTPSRedirect(urlString string) (bool, error) {
 	url, err := url.Parse(urlString)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not parse url string", logger.Err(err))
 		return false, errors.Wrap(err, "could not parse url string")
 	}
 	req, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not create new GET request", logger.Err(err))
 		return false, errors.Wrap(err, "errros while constructing new get request")
 	}
 
@@ -271,7 +316,7 @@ func CheckHTTPSRedirect(urlString string) (bool, error) {
 					return true, nil
 				}
 			} else {
-				log.Println(err)
+				logger.Error("could not parse redirect url", logger.Err(err))
 			}
 		}
 	}
@@ -0,0 +1,68 @@
+// +build all travis
+
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/retry"
+)
+
+func TestGetRequestRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+		case calls < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	policy := retry.Policy{MaxAttempts: 3, Initial: time.Millisecond, Multiplier: 2}
+	data, err := GetRequestContext(context.Background(), policy, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ok" || calls != 3 {
+		t.Fatalf("expected ok after 3 calls, got %q after %d", data, calls)
+	}
+
+	// client errors aren't retried
+	calls = 0
+	data, err = GetRequestContext(context.Background(), policy, server.URL+"/missing")
+	serr, ok := errors.Cause(err).(*StatusError)
+	if !ok || serr.Code != http.StatusNotFound || calls != 1 {
+		t.Fatalf("expected a 404 StatusError after 1 call, got %v after %d", err, calls)
+	}
+	if string(data) != "not found" {
+		t.Fatalf("unexpected body: %q", data)
+	}
+
+	// GetRequest returns the body of client errors as before
+	old := RetryPolicy
+	SetRetryPolicy(policy)
+	defer SetRetryPolicy(old)
+	data, err = GetRequest(server.URL + "/missing")
+	if err != nil || string(data) != "not found" {
+		t.Fatalf("unexpected response: %q, %v", data, err)
+	}
+
+	calls = -10
+	_, err = GetRequest(server.URL)
+	serr, ok = errors.Cause(err).(*StatusError)
+	if !ok || !serr.Temporary() {
+		t.Fatalf("expected a temporary StatusError, got %v", err)
+	}
+}
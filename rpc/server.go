@@ -0,0 +1,308 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Middleware wraps a handler to run code before or after it, eg. to log requests or to check
+// authentication
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in the passed middleware. The first middleware is the outermost one, so it
+// sees the request first and the response last
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+type ctxKey int
+
+const (
+	paramsKey ctxKey = iota
+	requestIDKey
+	principalKey
+)
+
+// Param returns the value of the path parameter name of the route that matched r, eg. the id
+// in /users/:id. It returns an empty string if the route has no such parameter
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey).(map[string]string)
+	return params[name]
+}
+
+type route struct {
+	method   string
+	segments []string
+	handler  http.Handler
+}
+
+// match returns the path parameters if the route matches the path segments
+func (rt *route) match(segments []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, seg := range rt.segments {
+		if strings.HasPrefix(seg, "*") {
+			params[seg[1:]] = strings.Join(segments[i:], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, ":") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[seg[1:]] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(segments) == len(rt.segments)
+}
+
+// specificity ranks routes so that literal segments take precedence over parameters, and
+// parameters over wildcards, eg. /users/me is chosen over /users/:id
+func (rt *route) specificity() []int {
+	rank := make([]int, len(rt.segments))
+	for i, seg := range rt.segments {
+		switch {
+		case strings.HasPrefix(seg, "*"):
+			rank[i] = 0
+		case strings.HasPrefix(seg, ":"):
+			rank[i] = 1
+		default:
+			rank[i] = 2
+		}
+	}
+	return rank
+}
+
+// shape returns the route's pattern without parameter names, two routes with the same shape
+// match the same paths
+func (rt *route) shape() string {
+	shape := make([]string, len(rt.segments))
+	for i, seg := range rt.segments {
+		switch {
+		case strings.HasPrefix(seg, "*"):
+			shape[i] = "*"
+		case strings.HasPrefix(seg, ":"):
+			shape[i] = ":"
+		default:
+			shape[i] = seg
+		}
+	}
+	return strings.Join(shape, "/")
+}
+
+// moreSpecific returns whether a is ranked before b
+func moreSpecific(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return len(a) > len(b)
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits a path into its segments, ignoring the leading and trailing slash
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// Server is an http.Handler with its own routes and middleware, so several servers can run
+// in one process. Routes are registered per method and may contain path parameters such as
+// /users/:id, which are read with Param, and a final wildcard such as /static/*file that
+// matches the rest of the path
+type Server struct {
+	// NotFound handles requests that match no route, ResponseHandler with StatusNotFound
+	// is used if it is nil
+	NotFound http.Handler
+
+	mu         sync.RWMutex
+	routes     []*route
+	middleware []Middleware
+	handler    http.Handler
+	srv        *http.Server
+}
+
+// NewServer returns a server that runs the passed middleware on every request
+func NewServer(middleware ...Middleware) *Server {
+	s := &Server{}
+	s.Use(middleware...)
+	return s
+}
+
+// Use adds middleware that runs on every request, including those that match no route
+func (s *Server) Use(middleware ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middleware = append(s.middleware, middleware...)
+	s.handler = Chain(http.HandlerFunc(s.route), s.middleware...)
+}
+
+// Handle registers h for requests with the passed method and a path matching pattern. The
+// passed middleware only runs for this route, after the middleware of the server. Handle
+// panics if the route is already registered
+func (s *Server) Handle(method string, pattern string, h http.Handler, middleware ...Middleware) {
+	rt := &route{
+		method:   strings.ToUpper(method),
+		segments: splitPath(pattern),
+		handler:  Chain(h, middleware...),
+	}
+	for i, seg := range rt.segments {
+		if seg == ":" || seg == "*" {
+			panic("rpc: unnamed parameter in pattern " + pattern)
+		}
+		if strings.HasPrefix(seg, "*") && i != len(rt.segments)-1 {
+			panic("rpc: wildcard must be the last segment of pattern " + pattern)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.routes {
+		if other.method == rt.method && other.shape() == rt.shape() {
+			panic("rpc: multiple registrations for " + rt.method + " " + pattern)
+		}
+	}
+	s.routes = append(s.routes, rt)
+	// keep the most specific routes first so that the first match is the best one
+	sort.SliceStable(s.routes, func(i, j int) bool {
+		return moreSpecific(s.routes[i].specificity(), s.routes[j].specificity())
+	})
+}
+
+// HandleFunc registers a handler function, see Handle
+func (s *Server) HandleFunc(method string, pattern string, h http.HandlerFunc, middleware ...Middleware) {
+	s.Handle(method, pattern, h, middleware...)
+}
+
+// Get registers a handler function for GET requests. It also handles HEAD requests
+func (s *Server) Get(pattern string, h http.HandlerFunc, middleware ...Middleware) {
+	s.Handle(http.MethodGet, pattern, h, middleware...)
+}
+
+// Post registers a handler function for POST requests
+func (s *Server) Post(pattern string, h http.HandlerFunc, middleware ...Middleware) {
+	s.Handle(http.MethodPost, pattern, h, middleware...)
+}
+
+// Put registers a handler function for PUT requests
+func (s *Server) Put(pattern string, h http.HandlerFunc, middleware ...Middleware) {
+	s.Handle(http.MethodPut, pattern, h, middleware...)
+}
+
+// Delete registers a handler function for DELETE requests
+func (s *Server) Delete(pattern string, h http.HandlerFunc, middleware ...Middleware) {
+	s.Handle(http.MethodDelete, pattern, h, middleware...)
+}
+
+// HandlePing registers the /ping route remote callers use to check if the server is up
+func (s *Server) HandlePing() {
+	s.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+		ResponseHandler(w, StatusOK)
+	})
+}
+
+// ServeHTTP runs the middleware of the server and the handler of the matching route
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	h := s.handler
+	s.mu.RUnlock()
+	if h == nil {
+		h = http.HandlerFunc(s.route)
+	}
+	h.ServeHTTP(w, r)
+}
+
+// route dispatches a request to the matching route. Requests whose path matches a route
+// registered for another method get StatusMethodNotAllowed
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+
+	s.mu.RLock()
+	var allowed []string
+	var found *route
+	var params map[string]string
+	for _, rt := range s.routes {
+		p, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+		if rt.method == r.Method || (r.Method == http.MethodHead && rt.method == http.MethodGet) {
+			found, params = rt, p
+			break
+		}
+		if !contains(allowed, rt.method) {
+			allowed = append(allowed, rt.method)
+		}
+	}
+	notFound := s.NotFound
+	s.mu.RUnlock()
+
+	if found != nil {
+		if len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), paramsKey, params))
+		}
+		found.handler.ServeHTTP(w, r)
+		return
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		ResponseHandler(w, StatusMethodNotAllowed)
+		return
+	}
+	if notFound != nil {
+		notFound.ServeHTTP(w, r)
+		return
+	}
+	ResponseHandler(w, StatusNotFound)
+}
+
+// ListenAndServe listens on addr and serves requests until Shutdown is called
+func (s *Server) ListenAndServe(addr string) error {
+	return s.httpServer(addr).ListenAndServe()
+}
+
+// ListenAndServeTLS listens on addr and serves requests over TLS until Shutdown is called
+func (s *Server) ListenAndServeTLS(addr string, certFile string, keyFile string) error {
+	return s.httpServer(addr).ListenAndServeTLS(certFile, keyFile)
+}
+
+func (s *Server) httpServer(addr string) *http.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srv = &http.Server{Addr: addr, Handler: s}
+	return s.srv
+}
+
+// Shutdown stops the server gracefully, waiting for active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.RLock()
+	srv := s.srv
+	s.mu.RUnlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,127 @@
+// +build all travis
+
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerRoutes(t *testing.T) {
+	s := NewServer()
+	s.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user " + Param(r, "id")))
+	})
+	s.Get("/users/me", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("me"))
+	})
+	s.Post("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("updated " + Param(r, "id")))
+	})
+	s.Get("/static/*file", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("file " + Param(r, "file")))
+	})
+	s.HandlePing()
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/users/42", 200, "user 42"},
+		{"GET", "/users/me/", 200, "me"},
+		{"POST", "/users/42", 200, "updated 42"},
+		{"HEAD", "/users/42", 200, ""},
+		{"GET", "/static/css/main.css", 200, "file css/main.css"},
+		{"GET", "/ping", 200, `"Status":"OK"`},
+		{"DELETE", "/users/42", 405, `"Code":405`},
+		{"GET", "/users", 404, `"Code":404`},
+		{"GET", "/users/42/posts", 404, `"Code":404`},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.body) {
+			t.Fatalf("%s %s: expected %d %q, got %d %q", c.method, c.path, c.status, c.body, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("PUT", "/users/42", nil))
+	if allow := w.Header().Get("Allow"); allow != "GET, POST" {
+		t.Fatalf("unexpected Allow header: %q", allow)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a route twice didn't panic")
+		}
+	}()
+	s.Get("/users/:name", func(w http.ResponseWriter, r *http.Request) {})
+}
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	s := NewServer(RequestID, Logging, Recovery, trace("server"))
+	s.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}, trace("route"))
+	s.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("too late"))
+		}
+	}, Timeout(10*time.Millisecond))
+	s.Get("/id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RequestIDFrom(r)))
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != StatusInternalServerError {
+		t.Fatalf("expected status 500 after a panic, got %d", w.Code)
+	}
+	if len(order) != 2 || order[0] != "server" || order[1] != "route" {
+		t.Fatalf("middleware ran in the wrong order: %v", order)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	var response StatusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != StatusServiceUnavailable || response.Message != "request timed out" {
+		t.Fatalf("expected a timeout, got %d %q", w.Code, w.Body.String())
+	}
+
+	r := httptest.NewRequest("GET", "/id", nil)
+	r.Header.Set(RequestIDHeader, "client-id.1")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Body.String() != "client-id.1" || w.Header().Get(RequestIDHeader) != "client-id.1" {
+		t.Fatalf("client request id wasn't kept: %q", w.Body.String())
+	}
+
+	r.Header.Set(RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if id := w.Body.String(); len(id) != 32 || id != w.Header().Get(RequestIDHeader) {
+		t.Fatalf("expected a new request id, got %q", id)
+	}
+}
@@ -3,13 +3,13 @@ package scan
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 	"syscall"
 
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
 	utils "github.com/Varunram/essentials/utils"
 	"golang.org/x/crypto/ssh/terminal"
 )
@@ -90,7 +90,7 @@ func Password() (string, error) {
 	bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
 	fmt.Println()
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not read password", logger.Err(err))
 		return "", err
 	}
 	tempString := string(bytePassword)
@@ -103,7 +103,7 @@ func RawPassword() (string, error) {
 	bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
 	fmt.Println()
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not read password", logger.Err(err))
 		return "", err
 	}
 	password := string(bytePassword)
@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StellarDecimals is the number of decimal places of Stellar amounts
+const StellarDecimals = 7
+
+// One is an Amount of 1, ie. 10^7 stroops
+const One Amount = 10000000
+
+// ErrInvalidAmount is returned when parsing a string that isn't a decimal number
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// ErrPrecision is returned when an amount has more decimal places than its type can store
+var ErrPrecision = errors.New("amount has too many decimal places")
+
+// ErrOverflow is returned when a value doesn't fit in the type it is converted to, or the
+// result of an operation on amounts doesn't fit in their type
+var ErrOverflow = errors.New("value overflows its type")
+
+// Amount is an exact Stellar amount, stored as an integer number of stroops (10^-7)
+type Amount int64
+
+// ParseAmount parses a decimal string such as "12.5" into an Amount. Strings with more than
+// seven decimal places are rejected rather than rounded
+func ParseAmount(s string) (Amount, error) {
+	x, err := parseDecimal(s, StellarDecimals)
+	if err != nil {
+		return 0, err
+	}
+	if !x.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return Amount(x.Int64()), nil
+}
+
+// AmountFromFloat converts a float to the nearest Amount. Floats can't represent most
+// decimal amounts exactly, so prefer ParseAmount where possible
+func AmountFromFloat(f float64) (Amount, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrInvalidAmount
+	}
+	return ParseAmount(strconv.FormatFloat(f, 'f', StellarDecimals, 64))
+}
+
+// String formats the amount with seven decimal places, the format used by horizon
+func (a Amount) String() string {
+	return formatDecimal(big.NewInt(int64(a)), StellarDecimals)
+}
+
+// Float64 returns the closest float to the amount
+func (a Amount) Float64() float64 {
+	f, _ := strconv.ParseFloat(a.String(), 64)
+	return f
+}
+
+// Add returns a + b
+func (a Amount) Add(b Amount) (Amount, error) {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return 0, ErrOverflow
+	}
+	return c, nil
+}
+
+// Sub returns a - b
+func (a Amount) Sub(b Amount) (Amount, error) {
+	c := a - b
+	if (c < a) != (b > 0) {
+		return 0, ErrOverflow
+	}
+	return c, nil
+}
+
+// Mul returns a * b, rounded towards zero
+func (a Amount) Mul(b Amount) (Amount, error) {
+	x := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(b)))
+	x.Quo(x, big.NewInt(int64(One)))
+	if !x.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return Amount(x.Int64()), nil
+}
+
+// Div returns a / b, rounded towards zero
+func (a Amount) Div(b Amount) (Amount, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	x := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(One)))
+	x.Quo(x, big.NewInt(int64(b)))
+	if !x.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return Amount(x.Int64()), nil
+}
+
+// Cmp returns -1, 0 or 1 if a is less than, equal to or greater than b
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// MarshalJSON encodes the amount as a decimal string so that no precision is lost
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON decodes an amount from a decimal string or number
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	x, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = x
+	return nil
+}
+
+// BigAmount is an exact amount with an arbitrary number of decimal places, such as wei
+// amounts with 18 decimals. Amounts with different decimals can't be combined
+type BigAmount struct {
+	units    *big.Int
+	decimals int
+}
+
+// NewBigAmount returns the amount units * 10^-decimals
+func NewBigAmount(units *big.Int, decimals int) BigAmount {
+	return BigAmount{units: new(big.Int).Set(units), decimals: decimals}
+}
+
+// ParseBigAmount parses a decimal string into a BigAmount with the given decimal places
+func ParseBigAmount(s string, decimals int) (BigAmount, error) {
+	x, err := parseDecimal(s, decimals)
+	if err != nil {
+		return BigAmount{}, err
+	}
+	return BigAmount{units: x, decimals: decimals}, nil
+}
+
+// Units returns the amount as an integer number of its smallest unit
+func (a BigAmount) Units() *big.Int {
+	if a.units == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.units)
+}
+
+// Decimals returns the number of decimal places of the amount
+func (a BigAmount) Decimals() int {
+	return a.decimals
+}
+
+// Rescale returns the amount with the given decimal places. ErrPrecision is returned if the
+// amount has more significant decimal places than that
+func (a BigAmount) Rescale(decimals int) (BigAmount, error) {
+	x := a.Units()
+	if decimals >= a.decimals {
+		return BigAmount{units: x.Mul(x, pow10(decimals-a.decimals)), decimals: decimals}, nil
+	}
+	q, r := new(big.Int).QuoRem(x, pow10(a.decimals-decimals), new(big.Int))
+	if r.Sign() != 0 {
+		return BigAmount{}, ErrPrecision
+	}
+	return BigAmount{units: q, decimals: decimals}, nil
+}
+
+// String formats the amount with all of its decimal places
+func (a BigAmount) String() string {
+	return formatDecimal(a.Units(), a.decimals)
+}
+
+// Add returns a + b
+func (a BigAmount) Add(b BigAmount) (BigAmount, error) {
+	if a.decimals != b.decimals {
+		return BigAmount{}, errors.New("amounts have different decimals")
+	}
+	return BigAmount{units: new(big.Int).Add(a.Units(), b.Units()), decimals: a.decimals}, nil
+}
+
+// Sub returns a - b
+func (a BigAmount) Sub(b BigAmount) (BigAmount, error) {
+	if a.decimals != b.decimals {
+		return BigAmount{}, errors.New("amounts have different decimals")
+	}
+	return BigAmount{units: new(big.Int).Sub(a.Units(), b.Units()), decimals: a.decimals}, nil
+}
+
+// Cmp returns -1, 0 or 1 if a is less than, equal to or greater than b. Amounts with
+// different decimals are compared by value
+func (a BigAmount) Cmp(b BigAmount) int {
+	x, y := a.Units(), b.Units()
+	if a.decimals < b.decimals {
+		x.Mul(x, pow10(b.decimals-a.decimals))
+	} else if b.decimals < a.decimals {
+		y.Mul(y, pow10(a.decimals-b.decimals))
+	}
+	return x.Cmp(y)
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// parseDecimal parses a decimal string into an integer number of 10^-decimals units
+func parseDecimal(s string, decimals int) (*big.Int, error) {
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return nil, ErrInvalidAmount
+	}
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return nil, ErrInvalidAmount
+		}
+	}
+
+	// trailing zeros don't add precision
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > decimals {
+		return nil, ErrPrecision
+	}
+
+	x, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if !ok {
+		return nil, ErrInvalidAmount
+	}
+	if neg {
+		x.Neg(x)
+	}
+	return x, nil
+}
+
+// formatDecimal formats an integer number of 10^-decimals units as a decimal string
+func formatDecimal(x *big.Int, decimals int) string {
+	digits := new(big.Int).Abs(x).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	s := digits
+	if decimals > 0 {
+		s = digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+	}
+	if x.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
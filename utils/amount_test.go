@@ -0,0 +1,142 @@
+// +build all travis
+
+package utils
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestAmount(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+		err error
+	}{
+		{"0", "0.0000000", nil},
+		{"12.5", "12.5000000", nil},
+		{"-0.0000001", "-0.0000001", nil},
+		{"+.25", "0.2500000", nil},
+		{"3.", "3.0000000", nil},
+		{"1.10000000000", "1.1000000", nil},
+		{"922337203685.4775807", "922337203685.4775807", nil},
+		{"922337203685.4775808", "", ErrOverflow},
+		{"0.00000001", "", ErrPrecision},
+		{"", "", ErrInvalidAmount},
+		{".", "", ErrInvalidAmount},
+		{"1e7", "", ErrInvalidAmount},
+		{"1,5", "", ErrInvalidAmount},
+	}
+	for _, c := range cases {
+		a, err := ParseAmount(c.in)
+		if err != c.err {
+			t.Fatalf("%q: expected error %v, got %v", c.in, c.err, err)
+		}
+		if err == nil && a.String() != c.out {
+			t.Fatalf("%q: expected %s, got %s", c.in, c.out, a)
+		}
+	}
+
+	// 0.1 + 0.2 is exact
+	x, _ := ParseAmount("0.1")
+	y, _ := ParseAmount("0.2")
+	sum, err := x.Add(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.String() != "0.3000000" {
+		t.Fatalf("unexpected sum: %s", sum)
+	}
+	f, err := AmountFromFloat(0.1 + 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != sum || f.Cmp(sum) != 0 || f.Cmp(x) != 1 || x.Cmp(f) != -1 {
+		t.Fatalf("unexpected amount from float: %s", f)
+	}
+
+	if _, err := Amount(1<<63 - 1).Add(1); err != ErrOverflow {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+	if _, err := Amount(-1 << 63).Sub(1); err != ErrOverflow {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+	product, err := sum.Mul(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.String() != "0.0600000" {
+		t.Fatalf("unexpected product: %s", product)
+	}
+	quotient, err := One.Div(3 * One)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quotient.String() != "0.3333333" {
+		t.Fatalf("unexpected quotient: %s", quotient)
+	}
+	if _, err := One.Div(0); err == nil {
+		t.Fatal("division by zero succeeded")
+	}
+
+	var v struct {
+		A Amount
+		B Amount
+	}
+	if err := json.Unmarshal([]byte(`{"A":"1.5","B":2.25}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"A":"1.5000000","B":"2.2500000"}` {
+		t.Fatalf("unexpected json: %s", data)
+	}
+}
+
+func TestBigAmount(t *testing.T) {
+	wei, err := ParseBigAmount("1.000000000000000001", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wei.Units().String() != "1000000000000000001" {
+		t.Fatalf("unexpected units: %s", wei.Units())
+	}
+	fee := NewBigAmount(big.NewInt(2), 18)
+	diff, err := fee.Sub(wei)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.String() != "-0.999999999999999999" {
+		t.Fatalf("unexpected difference: %s", diff)
+	}
+
+	btc, err := ParseBigAmount("1", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := btc.Add(wei); err == nil {
+		t.Fatal("added amounts with different decimals")
+	}
+	if btc.Cmp(wei) != -1 || wei.Cmp(btc) != 1 {
+		t.Fatal("amounts with different decimals compared wrongly")
+	}
+	if _, err := wei.Rescale(8); err != ErrPrecision {
+		t.Fatalf("expected ErrPrecision, got %v", err)
+	}
+	sats, err := btc.Rescale(18)
+	if err != nil || sats.Cmp(btc) != 0 || sats.Decimals() != 18 {
+		t.Fatalf("could not rescale amount: %v", err)
+	}
+	back, err := sats.Rescale(8)
+	if err != nil || back.Units().String() != "100000000" {
+		t.Fatalf("could not rescale amount: %v", err)
+	}
+
+	var zero BigAmount
+	if zero.String() != "0" {
+		t.Fatalf("unexpected zero value: %s", zero)
+	}
+}
@@ -0,0 +1,400 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/logger"
+)
+
+// The To* functions convert between the basic types without losing information, returning
+// ErrOverflow when a value doesn't fit in the target type and ErrLossy when it can't be
+// represented exactly. Numbers are converted to and from decimal strings, and byte slices are
+// read and written like strings, so ToByte(x) is []byte(ToString(x)) for every number. Binary
+// encodings have an explicit byte order and are handled by EncodeInt, EncodeUint, DecodeInt and
+// DecodeUint. Converting a value to a string or bytes and back returns the same value.
+
+// ErrTypeNotSupported is an error returned if the given type conversion isn't supported yet
+var ErrTypeNotSupported = errors.New("type not supported, please feel free to PR")
+
+// ErrLossy is returned when a value can't be converted without losing precision
+var ErrLossy = errors.New("conversion loses precision")
+
+// ErrInvalidNumber is returned when parsing a string that isn't a number
+var ErrInvalidNumber = errors.New("invalid number")
+
+// ErrInvalidSize is returned when encoding or decoding an integer of a size other than 1, 2, 4
+// or 8 bytes
+var ErrInvalidSize = errors.New("integer size must be 1, 2, 4 or 8 bytes")
+
+// integer converts x to a big.Int
+func integer(x interface{}) (*big.Int, error) {
+	switch v := x.(type) {
+	case int:
+		return big.NewInt(int64(v)), nil
+	case int8:
+		return big.NewInt(int64(v)), nil
+	case int16:
+		return big.NewInt(int64(v)), nil
+	case int32:
+		return big.NewInt(int64(v)), nil
+	case int64:
+		return big.NewInt(v), nil
+	case uint:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint8:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint16:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint32:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	case float32:
+		return floatInteger(float64(v))
+	case float64:
+		return floatInteger(v)
+	case *big.Int:
+		if v == nil {
+			return nil, ErrInvalidNumber
+		}
+		return new(big.Int).Set(v), nil
+	case big.Int:
+		return new(big.Int).Set(&v), nil
+	case string:
+		return parseInteger(v)
+	case []byte:
+		return parseInteger(string(v))
+	}
+
+	logger.Warn("type conversion not supported", logger.F("type", fmt.Sprintf("%T", x)))
+	return nil, ErrTypeNotSupported
+}
+
+// parseInteger parses a decimal integer
+func parseInteger(s string) (*big.Int, error) {
+	// SetString accepts underscores and base prefixes with base 0 only, so base 10 is strict
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidNumber, strconv.Quote(s))
+	}
+	return v, nil
+}
+
+// floatInteger converts an integral float to a big.Int
+func floatInteger(f float64) (*big.Int, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, ErrInvalidNumber
+	}
+	if f != math.Trunc(f) {
+		return nil, ErrLossy
+	}
+	v, _ := big.NewFloat(f).Int(nil)
+	return v, nil
+}
+
+// bounds returns the range of a signed or unsigned integer of size bytes
+func bounds(size int, signed bool) (*big.Int, *big.Int) {
+	bits := uint(8 * size)
+	if signed {
+		max := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		min := new(big.Int).Neg(max)
+		return min, max.Sub(max, big.NewInt(1))
+	}
+	max := new(big.Int).Lsh(big.NewInt(1), bits)
+	return new(big.Int), max.Sub(max, big.NewInt(1))
+}
+
+// toSigned converts x to a signed integer of size bytes
+func toSigned(x interface{}, size int) (int64, error) {
+	v, err := integer(x)
+	if err != nil {
+		return 0, err
+	}
+	min, max := bounds(size, true)
+	if v.Cmp(min) < 0 || v.Cmp(max) > 0 {
+		return 0, ErrOverflow
+	}
+	return v.Int64(), nil
+}
+
+// toUnsigned converts x to an unsigned integer of size bytes
+func toUnsigned(x interface{}, size int) (uint64, error) {
+	v, err := integer(x)
+	if err != nil {
+		return 0, err
+	}
+	min, max := bounds(size, false)
+	if v.Cmp(min) < 0 || v.Cmp(max) > 0 {
+		return 0, ErrOverflow
+	}
+	return v.Uint64(), nil
+}
+
+// ToInt converts a passed interface to int
+func ToInt(x interface{}) (int, error) {
+	v, err := toSigned(x, strconv.IntSize/8)
+	return int(v), err
+}
+
+// ToInt8 converts a passed interface to int8
+func ToInt8(x interface{}) (int8, error) {
+	v, err := toSigned(x, 1)
+	return int8(v), err
+}
+
+// ToInt16 converts a passed interface to int16
+func ToInt16(x interface{}) (int16, error) {
+	v, err := toSigned(x, 2)
+	return int16(v), err
+}
+
+// ToInt32 converts a passed interface to int32
+func ToInt32(x interface{}) (int32, error) {
+	v, err := toSigned(x, 4)
+	return int32(v), err
+}
+
+// ToInt64 converts a passed interface to int64
+func ToInt64(x interface{}) (int64, error) {
+	return toSigned(x, 8)
+}
+
+// ToUint converts a passed interface to uint
+func ToUint(x interface{}) (uint, error) {
+	v, err := toUnsigned(x, strconv.IntSize/8)
+	return uint(v), err
+}
+
+// ToUint8 converts a passed interface to uint8
+func ToUint8(x interface{}) (uint8, error) {
+	v, err := toUnsigned(x, 1)
+	return uint8(v), err
+}
+
+// ToUint16 converts a passed interface to uint16
+func ToUint16(x interface{}) (uint16, error) {
+	v, err := toUnsigned(x, 2)
+	return uint16(v), err
+}
+
+// ToUint32 converts a passed interface to uint32
+func ToUint32(x interface{}) (uint32, error) {
+	v, err := toUnsigned(x, 4)
+	return uint32(v), err
+}
+
+// ToUint64 converts a passed interface to uint64
+func ToUint64(x interface{}) (uint64, error) {
+	return toUnsigned(x, 8)
+}
+
+// ToBigInt converts a passed interface to big.Int
+func ToBigInt(x interface{}) (*big.Int, error) {
+	return integer(x)
+}
+
+// ToFloat converts a passed interface to float. Integers that can't be represented exactly
+// return ErrLossy
+func ToFloat(x interface{}) (float64, error) {
+	switch v := x.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case string:
+		return parseFloat(v, 64)
+	case []byte:
+		return parseFloat(string(v), 64)
+	}
+
+	v, err := integer(x)
+	if err != nil {
+		return 0, err
+	}
+	f, accuracy := new(big.Float).SetInt(v).Float64()
+	if accuracy != big.Exact {
+		return 0, ErrLossy
+	}
+	return f, nil
+}
+
+// ToFloat32 converts a passed interface to float32, rounding to the nearest float32
+func ToFloat32(x interface{}) (float32, error) {
+	switch v := x.(type) {
+	case string:
+		f, err := parseFloat(v, 32)
+		return float32(f), err
+	case []byte:
+		f, err := parseFloat(string(v), 32)
+		return float32(f), err
+	}
+
+	f, err := ToFloat(x)
+	if err != nil {
+		return 0, err
+	}
+	if f32 := float32(f); !math.IsInf(f, 0) && math.IsInf(float64(f32), 0) {
+		return 0, ErrOverflow
+	}
+	return float32(f), nil
+}
+
+// parseFloat parses a float of bitSize bits
+func parseFloat(s string, bitSize int) (float64, error) {
+	f, err := strconv.ParseFloat(s, bitSize)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, ErrOverflow
+		}
+		return 0, errors.Wrap(ErrInvalidNumber, strconv.Quote(s))
+	}
+	return f, nil
+}
+
+// formatFloat formats a float with the fewest digits that parse back to it, always including
+// a decimal point so that the result reads as a float
+func formatFloat(f float64, bitSize int) string {
+	s := strconv.FormatFloat(f, 'f', -1, bitSize)
+	if math.IsInf(f, 0) || math.IsNaN(f) || strings.ContainsRune(s, '.') {
+		return s
+	}
+	return s + ".0"
+}
+
+// ToString converts a passed interface to string. Floats are formatted with the fewest digits
+// that parse back to them, eg. "10.0" and "0.1", rather than with six decimals as before
+func ToString(x interface{}) (string, error) {
+	switch v := x.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return formatFloat(float64(v), 32), nil
+	case float64:
+		return formatFloat(v, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case *big.Int:
+		if v == nil {
+			return "", ErrInvalidNumber
+		}
+		return v.String(), nil
+	case big.Int:
+		return v.String(), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+
+	logger.Warn("type conversion not supported", logger.F("type", fmt.Sprintf("%T", x)))
+	return "", ErrTypeNotSupported
+}
+
+// ToByte converts a passed interface to bytes. Numbers are encoded as decimal text like
+// ToString, use EncodeInt or EncodeUint for binary encodings
+func ToByte(x interface{}) ([]byte, error) {
+	switch v := x.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64, *big.Int, big.Int:
+		s, err := ToString(v)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	}
+
+	logger.Warn("type conversion not supported", logger.F("type", fmt.Sprintf("%T", x)))
+	return nil, ErrTypeNotSupported
+}
+
+// EncodeUint encodes x in size bytes with the given byte order
+func EncodeUint(x uint64, size int, order binary.ByteOrder) ([]byte, error) {
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return nil, ErrInvalidSize
+	}
+	if size < 8 && x>>uint(8*size) != 0 {
+		return nil, ErrOverflow
+	}
+
+	b := make([]byte, size)
+	switch size {
+	case 1:
+		b[0] = byte(x)
+	case 2:
+		order.PutUint16(b, uint16(x))
+	case 4:
+		order.PutUint32(b, uint32(x))
+	case 8:
+		order.PutUint64(b, x)
+	}
+	return b, nil
+}
+
+// EncodeInt encodes x as a two's complement integer of size bytes with the given byte order
+func EncodeInt(x int64, size int, order binary.ByteOrder) ([]byte, error) {
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return nil, ErrInvalidSize
+	}
+	shift := uint(64 - 8*size)
+	if x<<shift>>shift != x {
+		return nil, ErrOverflow
+	}
+	// drop the sign extension above the width of the type
+	return EncodeUint(uint64(x)<<shift>>shift, size, order)
+}
+
+// DecodeUint decodes an unsigned integer of 1, 2, 4 or 8 bytes with the given byte order
+func DecodeUint(b []byte, order binary.ByteOrder) (uint64, error) {
+	switch len(b) {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(order.Uint16(b)), nil
+	case 4:
+		return uint64(order.Uint32(b)), nil
+	case 8:
+		return order.Uint64(b), nil
+	}
+	return 0, ErrInvalidSize
+}
+
+// DecodeInt decodes a two's complement integer of 1, 2, 4 or 8 bytes with the given byte order
+func DecodeInt(b []byte, order binary.ByteOrder) (int64, error) {
+	u, err := DecodeUint(b, order)
+	if err != nil {
+		return 0, err
+	}
+	shift := uint(64 - 8*len(b))
+	return int64(u<<shift) >> shift, nil
+}
@@ -0,0 +1,320 @@
+// +build all travis
+
+package utils
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"testing"
+	"testing/quick"
+
+	"github.com/pkg/errors"
+)
+
+func TestToInteger(t *testing.T) {
+	cases := []struct {
+		name string
+		fn   func(interface{}) (interface{}, error)
+		in   interface{}
+		out  interface{}
+		err  error
+	}{
+		{"int from string", toInt, "-42", -42, nil},
+		{"int from text bytes", toInt, []byte("42"), 42, nil},
+		{"int from integral float", toInt, 42.0, 42, nil},
+		{"int from fractional float", toInt, 42.5, nil, ErrLossy},
+		{"int from NaN", toInt, math.NaN(), nil, ErrInvalidNumber},
+		{"int from invalid string", toInt, "4x2", nil, ErrInvalidNumber},
+		{"int from prefixed string", toInt, "0x10", nil, ErrInvalidNumber},
+		{"int from uint64", toInt, uint64(math.MaxUint64), nil, ErrOverflow},
+		{"int from bool", toInt, true, nil, ErrTypeNotSupported},
+		{"int8 from int", toInt8, 127, int8(127), nil},
+		{"int8 overflow", toInt8, 128, nil, ErrOverflow},
+		{"int8 from text bytes", toInt8, []byte("-1"), int8(-1), nil},
+		{"int16 from binary", toInt16, []byte{0xff, 0xfe}, nil, ErrInvalidNumber},
+		{"int32 from text bytes", toInt32, []byte("-2"), int32(-2), nil},
+		{"int64 from big.Int", toInt64, *big.NewInt(-7), int64(-7), nil},
+		{"int64 from *big.Int overflow", toInt64, new(big.Int).Lsh(big.NewInt(1), 63), nil, ErrOverflow},
+		{"uint from negative", toUint, -1, nil, ErrOverflow},
+		{"uint8 from string", toUint8, "255", uint8(255), nil},
+		{"uint8 overflow", toUint8, "256", nil, ErrOverflow},
+		{"uint16 from text bytes", toUint16, []byte("258"), uint16(258), nil},
+		{"uint16 from binary", toUint16, []byte{0x01, 0x02}, nil, ErrInvalidNumber},
+		{"uint64 from text bytes", toUint64, []byte("18446744073709551615"), uint64(math.MaxUint64), nil},
+		{"uint32 from int64", toUint32, int64(math.MaxUint32), uint32(math.MaxUint32), nil},
+		{"uint64 from string", toUint64, "18446744073709551615", uint64(math.MaxUint64), nil},
+		{"uint64 overflow", toUint64, "18446744073709551616", nil, ErrOverflow},
+		{"big from text bytes", toBigInt, []byte("-256"), "-256", nil},
+		{"big from string", toBigInt, "-123456789012345678901234567890", "-123456789012345678901234567890", nil},
+		{"big from nil", toBigInt, (*big.Int)(nil), nil, ErrInvalidNumber},
+		{"float from string", toFloat, "0.1", 0.1, nil},
+		{"float from 64 bit string", toFloat, "16777217", 16777217.0, nil},
+		{"float overflow", toFloat, "1e400", nil, ErrOverflow},
+		{"float from large int", toFloat, int64(1<<53 + 1), nil, ErrLossy},
+		{"float from int", toFloat, 3, 3.0, nil},
+		{"float32 overflow", toFloat32, 1e300, nil, ErrOverflow},
+		{"float32 from string", toFloat32, "0.1", float32(0.1), nil},
+	}
+
+	for _, c := range cases {
+		out, err := c.fn(c.in)
+		if errors.Cause(err) != c.err {
+			t.Fatalf("%s: expected error %v, got %v", c.name, c.err, err)
+		}
+		if err == nil && out != c.out {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.out, out)
+		}
+	}
+}
+
+func toInt(x interface{}) (interface{}, error)     { return wrap(ToInt(x)) }
+func toInt8(x interface{}) (interface{}, error)    { return wrap(ToInt8(x)) }
+func toInt16(x interface{}) (interface{}, error)   { return wrap(ToInt16(x)) }
+func toInt32(x interface{}) (interface{}, error)   { return wrap(ToInt32(x)) }
+func toInt64(x interface{}) (interface{}, error)   { return wrap(ToInt64(x)) }
+func toUint(x interface{}) (interface{}, error)    { return wrap(ToUint(x)) }
+func toUint8(x interface{}) (interface{}, error)   { return wrap(ToUint8(x)) }
+func toUint16(x interface{}) (interface{}, error)  { return wrap(ToUint16(x)) }
+func toUint32(x interface{}) (interface{}, error)  { return wrap(ToUint32(x)) }
+func toUint64(x interface{}) (interface{}, error)  { return wrap(ToUint64(x)) }
+func toFloat(x interface{}) (interface{}, error)   { return wrap(ToFloat(x)) }
+func toFloat32(x interface{}) (interface{}, error) { return wrap(ToFloat32(x)) }
+
+func toBigInt(x interface{}) (interface{}, error) {
+	v, err := ToBigInt(x)
+	if err != nil {
+		return nil, err
+	}
+	return v.String(), nil
+}
+
+// wrap returns x as an interface, or nil if err is set
+func wrap(x interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func TestToByte(t *testing.T) {
+	cases := []struct {
+		in  interface{}
+		out []byte
+	}{
+		{10, []byte("10")},
+		{uint(10), []byte("10")},
+		{"10", []byte("10")},
+		{1.5, []byte("1.5")},
+		{int8(-1), []byte("-1")},
+		{int16(-2), []byte("-2")},
+		{int32(1), []byte("1")},
+		{int64(-1), []byte("-1")},
+		{uint16(258), []byte("258")},
+		{uint32(16909060), []byte("16909060")},
+		{uint64(math.MaxUint64), []byte("18446744073709551615")},
+		{big.NewInt(-256), []byte("-256")},
+		{*big.NewInt(256), []byte("256")},
+	}
+	for _, c := range cases {
+		out, err := ToByte(c.in)
+		if err != nil {
+			t.Fatalf("%T %v: %v", c.in, c.in, err)
+		}
+		if string(out) != string(c.out) {
+			t.Fatalf("%T %v: expected %x, got %x", c.in, c.in, c.out, out)
+		}
+	}
+
+	if _, err := ToByte((*big.Int)(nil)); err != ErrInvalidNumber {
+		t.Fatalf("expected ErrInvalidNumber, got %v", err)
+	}
+	if _, err := ToByte(true); err != ErrTypeNotSupported {
+		t.Fatalf("expected ErrTypeNotSupported, got %v", err)
+	}
+}
+
+func TestEncodeInt(t *testing.T) {
+	b, err := EncodeUint(0x0102, 2, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "\x02\x01" {
+		t.Fatalf("unexpected encoding: %x", b)
+	}
+	if _, err := EncodeUint(256, 1, binary.BigEndian); err != ErrOverflow {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+	if _, err := EncodeInt(-129, 1, binary.BigEndian); err != ErrOverflow {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+	if _, err := EncodeInt(1, 3, binary.BigEndian); err != ErrInvalidSize {
+		t.Fatalf("expected ErrInvalidSize, got %v", err)
+	}
+	if _, err := DecodeUint(make([]byte, 5), binary.BigEndian); err != ErrInvalidSize {
+		t.Fatalf("expected ErrInvalidSize, got %v", err)
+	}
+	x, err := DecodeInt([]byte{0xfe, 0xff}, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != -2 {
+		t.Fatalf("expected -2, got %d", x)
+	}
+}
+
+func TestTimeConversions(t *testing.T) {
+	human, err := StringToHumanTime("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix, err := StringToIntTime(human)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unix != 0 {
+		t.Fatalf("expected 0, got %d", unix)
+	}
+	if _, err := StringToHumanTime("yesterday"); err == nil {
+		t.Fatal("invalid time accepted")
+	}
+	if _, err := StringToIntTime("yesterday"); err == nil {
+		t.Fatal("invalid time accepted")
+	}
+}
+
+// the round trip tests check random values with testing/quick
+func TestRoundTrip(t *testing.T) {
+	check := func(name string, f interface{}) {
+		if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	check("int", func(x int) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToInt(s)
+		z, err2 := ToInt(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("int8", func(x int8) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToInt8(s)
+		z, err2 := ToInt8(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("int16", func(x int16) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToInt16(s)
+		z, err2 := ToInt16(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("int32", func(x int32) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToInt32(s)
+		z, err2 := ToInt32(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("int64", func(x int64) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToInt64(s)
+		z, err2 := ToInt64(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("uint", func(x uint) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToUint(s)
+		z, err2 := ToUint(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("uint8", func(x uint8) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToUint8(s)
+		z, err2 := ToUint8(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("uint16", func(x uint16) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToUint16(s)
+		z, err2 := ToUint16(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("uint32", func(x uint32) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToUint32(s)
+		z, err2 := ToUint32(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("uint64", func(x uint64) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToUint64(s)
+		z, err2 := ToUint64(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("float64", func(x float64) bool {
+		s, _ := ToString(x)
+		b, _ := ToByte(x)
+		y, err1 := ToFloat(s)
+		z, err2 := ToFloat(b)
+		return err1 == nil && err2 == nil && x == y && x == z
+	})
+	check("float32", func(x float32) bool {
+		s, _ := ToString(x)
+		y, err := ToFloat32(s)
+		return err == nil && x == y
+	})
+	check("big.Int", func(x int64, shift uint8) bool {
+		v := new(big.Int).Lsh(big.NewInt(x), uint(shift))
+		s, _ := ToString(v)
+		b, _ := ToByte(v)
+		y, err1 := ToBigInt(s)
+		z, err2 := ToBigInt(b)
+		return err1 == nil && err2 == nil && v.Cmp(y) == 0 && v.Cmp(z) == 0
+	})
+	check("amount", func(x int64) bool {
+		y, err := ParseAmount(Amount(x).String())
+		return err == nil && Amount(x) == y
+	})
+	check("endianness", func(x int64) bool {
+		for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+			b, err := EncodeInt(x, 8, order)
+			if err != nil {
+				return false
+			}
+			y, err := DecodeInt(b, order)
+			if err != nil || x != y {
+				return false
+			}
+			b, err = EncodeInt(int64(int16(x)), 2, order)
+			if err != nil {
+				return false
+			}
+			y, err = DecodeInt(b, order)
+			if err != nil || int16(x) != int16(y) {
+				return false
+			}
+		}
+		return true
+	})
+
+	// arbitrary strings never panic and either fail or parse to a value that formats back
+	check("strings", func(s string) bool {
+		x, err := ToInt64(s)
+		if err != nil {
+			return true
+		}
+		y, _ := ToString(x)
+		z, err := ToInt64(y)
+		return err == nil && x == z
+	})
+}
@@ -3,22 +3,18 @@ package utils
 // utils contains utility functions that are used in packages
 import (
 	"crypto/rand"
-	"encoding/binary"
 	"encoding/hex"
-	"log"
 	"math/big"
 	"os/user"
 	"runtime"
-	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"golang.org/x/crypto/sha3"
-)
 
-// ErrTypeNotSupported is an error returned if the given type conversion isn't supported yet
-var ErrTypeNotSupported = errors.New("type not supported, please feel free to PR")
+	"github.com/Varunram/essentials/logger"
+)
 
 // Timestamp gets the human readable timestamp
 func Timestamp() string {
@@ -36,24 +32,23 @@ func IntToHumanTime(inputInt int64) string {
 }
 
 // StringToHumanTime converts an int64 in string form to human readable time
-func StringToHumanTime(inputString string) string {
-	inputInt, err := strconv.ParseInt(inputString, 10, 64)
+func StringToHumanTime(inputString string) (string, error) {
+	inputInt, err := ToInt64(inputString)
 	if err != nil {
-		log.Println(err)
+		return "", err
 	}
 
-	return IntToHumanTime(inputInt)
+	return IntToHumanTime(inputInt), nil
 }
 
-// StringToIntTime converts a string to unix time
-func StringToIntTime(inputString string) int64 {
-	layout := "Monday, 02-Jan-06 15:04:05 MST"
-	t, err := time.Parse(layout, inputString)
+// StringToIntTime converts a human readable time to unix time
+func StringToIntTime(inputString string) (int64, error) {
+	t, err := time.Parse(time.RFC850, inputString)
 	if err != nil {
-		return 0
+		return 0, errors.Wrap(err, "could not parse time")
 	}
 
-	return t.Unix()
+	return t.Unix(), nil
 }
 
 // SHA3hash gets the SHA3-512 hash of the passed string
@@ -67,7 +62,7 @@ func SHA3hash(inputString string) string {
 func GetHomeDir() (string, error) {
 	usr, err := user.Current()
 	if err != nil {
-		log.Println("error while getting current directory")
+		logger.Error("error while getting current user", logger.Err(err))
 	}
 	return usr.HomeDir, err
 }
@@ -111,131 +106,14 @@ func GetRandomString(n int) string {
 	return string(b)
 }
 
-// ToBigInt converts a passed interface to big.Int
-func ToBigInt(x interface{}) (*big.Int, error) {
-	log.Println("calling anything to byte function")
-	switch x.(type) {
-	case big.Int:
-		return x.(*big.Int), nil
-	case []byte:
-		return new(big.Int).SetBytes(x.([]byte)), nil
-	case int:
-		return big.NewInt(int64(x.(int))), nil
-	case uint64:
-		return new(big.Int).SetUint64(x.(uint64)), nil
-	case string:
-		log.Println([]byte(x.(string)))
-		return new(big.Int).SetBytes([]byte(x.(string))), nil
-	default:
-		return new(big.Int).SetUint64(0), nil
-	}
-}
-
-// ToByte converts a passed interface to bytes
-func ToByte(x interface{}) ([]byte, error) {
-	switch x.(type) {
-	case []byte:
-		return x.([]byte), nil
-	case int:
-		string1 := strconv.Itoa(x.(int))
-		return []byte(string1), nil
-	case uint32:
-		a := make([]byte, 4)
-		binary.BigEndian.PutUint32(a, x.(uint32))
-		return a, nil
-	case uint16:
-		a := make([]byte, 2)
-		binary.BigEndian.PutUint16(a, x.(uint16))
-		return a[1:], nil
-	case uint64:
-		b := make([]byte, 8)
-		binary.LittleEndian.PutUint64(b, x.(uint64))
-		return b, nil
-	}
-
-	log.Println("type conversion not supported")
-	return nil, ErrTypeNotSupported
-}
-
-// ToString converts a passed interface to string
-func ToString(x interface{}) (string, error) {
-	switch x.(type) {
-	case string:
-		return x.(string), nil
-	case float64:
-		return strconv.FormatFloat(x.(float64), 'f', 6, 64), nil
-	case int64:
-		return strconv.FormatInt(x.(int64), 10), nil // s == "97" (decimal)
-	case uint32:
-		return strconv.FormatUint(uint64(x.(uint32)), 10), nil
-	case int:
-		return strconv.Itoa(x.(int)), nil
-	}
-
-	log.Println("type conversion not supported")
-	return "", ErrTypeNotSupported
-}
-
-// ToInt converts a passed interface to int
-func ToInt(x interface{}) (int, error) {
-	switch x.(type) {
-	case int:
-		return x.(int), nil
-	case string:
-		return strconv.Atoi(x.(string))
-	case []byte:
-		return strconv.Atoi(string(x.([]byte)))
-	}
-
-	log.Println("type conversion not supported")
-	return -1, ErrTypeNotSupported
-}
-
-// ToFloat converts a passed interface to float
-func ToFloat(x interface{}) (float64, error) {
-	switch x.(type) {
-	case float64:
-		return x.(float64), nil
-	case []byte:
-		return ToFloat(string(x.([]byte)))
-	case string:
-		return strconv.ParseFloat(x.(string), 32)
-	case int:
-		return float64(x.(int)), nil
-	}
-
-	log.Println("type conversion not supported")
-	return -1, ErrTypeNotSupported
-}
-
-// ToUint16 converts a passed interface to uint16
-func ToUint16(x interface{}) (uint16, error) {
-	switch x.(type) {
-	case uint16:
-		return x.(uint16), nil
-	case []byte:
-		b := x.([]byte)
-		if len(b) == 1 {
-			zero := make([]byte, 1)
-			b = append(zero, b...)
-		}
-		return binary.BigEndian.Uint16(b), nil
-	}
-
-	log.Println("type conversion not supported")
-	return 0, ErrTypeNotSupported
-}
-
-// PrintMemUsage outputs the current, total and OS memory being used. As well as the number 
+// PrintMemUsage outputs the current, total and OS memory being used. As well as the number
 // of garage collection cycles completed.
 func PrintMemUsage() {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
-	log.Printf("Alloc = %v MiB", BToMb(m.Alloc))
-	log.Printf("\tTotalAlloc = %v MiB", BToMb(m.TotalAlloc))
-	log.Printf("\tSys = %v MiB", BToMb(m.Sys))
-	log.Printf("\tNumGC = %v\n", m.NumGC)
+	logger.Info("memory usage", logger.F("alloc_mib", BToMb(m.Alloc)), logger.F("total_alloc_mib", BToMb(m.TotalAlloc)),
+		logger.F("sys_mib", BToMb(m.Sys)), logger.F("num_gc", m.NumGC))
 }
 
 // BToMb converts bytes (b) to Mb
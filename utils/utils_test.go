@@ -12,7 +12,7 @@ import (
 func TestUtils(t *testing.T) {
 	// test out stuff here
 	testString := "10"
-	testStringFloat := "10.000000"
+	testStringFloat := "10.0"
 	testInt := 10
 	testByte := []byte("10")
 	testFloat := 10.0
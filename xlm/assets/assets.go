@@ -2,10 +2,10 @@ package assets
 
 import (
 	//"log"
-	"log"
 
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
 	utils "github.com/Varunram/essentials/utils"
 	xlm "github.com/Varunram/essentials/xlm"
 	build "github.com/stellar/go/txnbuild"
@@ -26,30 +26,37 @@ func CreateAsset(assetName string, PublicKey string) build.Asset {
 
 // TrustAsset trusts an asset issued by an account and signs a transaction with a
 // preset limit on how much it is willing to trust the issuer
+//
+// Deprecated: use TrustAssetAmount, floats can't represent most amounts exactly
 func TrustAsset(assetCode string, assetIssuer string, limitx float64, seed string) (string, error) {
-	// TRUST is FROM Seed TO assetIssuer
-	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
+	limit, err := utils.AmountFromFloat(limitx)
 	if err != nil {
-		log.Println(err)
-		return "", err
+		logger.Error("could not convert limit to string", logger.Err(err))
+		return "", errors.New("could not convert limit to string")
 	}
+	return TrustAssetAmount(assetCode, assetIssuer, limit, seed)
+}
 
-	limit, err := utils.ToString(limitx)
+// TrustAssetAmount trusts an asset issued by an account and signs a transaction with a
+// preset limit on how much it is willing to trust the issuer
+func TrustAssetAmount(assetCode string, assetIssuer string, limit utils.Amount, seed string) (string, error) {
+	// TRUST is FROM Seed TO assetIssuer
+	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
 	if err != nil {
-		log.Println(err)
-		return "", errors.New("could not convert limit to string")
+		logger.Error("could not return source account", logger.Err(err))
+		return "", err
 	}
 
 	op := build.ChangeTrust{
 		Line:  build.CreditAsset{assetCode, assetIssuer},
-		Limit: limit,
+		Limit: limit.String(),
 	}
 
 	memo := "trust asset"
 
 	_, txHash, err := xlm.SendTx(mykp, &sourceAccount, memo, build.Operation(&op))
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not trust asset", logger.F("asset", assetCode), logger.F("issuer", assetIssuer), logger.Err(err))
 		return "", err
 	}
 
@@ -57,22 +64,30 @@ func TrustAsset(assetCode string, assetIssuer string, limitx float64, seed strin
 }
 
 // SendAssetFromIssuer transfers an asset from the issuer to the desired publickey.
+//
+// Deprecated: use SendAssetFromIssuerAmount, floats can't represent most amounts exactly
 func SendAssetFromIssuer(assetCode string, destination string, amountx float64,
 	seed string, issuerPubkey string) (int32, string, error) {
 
-	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
+	amount, err := utils.AmountFromFloat(amountx)
 	if err != nil {
-		return -1, "", err
+		return -1, "", errors.New("could not convert limit to string")
 	}
+	return SendAssetFromIssuerAmount(assetCode, destination, amount, seed, issuerPubkey)
+}
 
-	amount, err := utils.ToString(amountx)
+// SendAssetFromIssuerAmount transfers an asset from the issuer to the desired publickey.
+func SendAssetFromIssuerAmount(assetCode string, destination string, amount utils.Amount,
+	seed string, issuerPubkey string) (int32, string, error) {
+
+	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
 	if err != nil {
-		return -1, "", errors.New("could not convert limit to string")
+		return -1, "", err
 	}
 
 	op := build.Payment{
 		Destination: destination,
-		Amount:      amount,
+		Amount:      amount.String(),
 		Asset:       build.CreditAsset{assetCode, issuerPubkey},
 	}
 
@@ -82,22 +97,30 @@ func SendAssetFromIssuer(assetCode string, destination string, amountx float64,
 }
 
 // SendAssetToIssuer sends an asset back to the issuer
+//
+// Deprecated: use SendAssetToIssuerAmount, floats can't represent most amounts exactly
 func SendAssetToIssuer(assetCode string, destination string, amountx float64,
 	seed string) (int32, string, error) {
 
-	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
+	amount, err := utils.AmountFromFloat(amountx)
 	if err != nil {
-		return -1, "", err
+		return -1, "", errors.New("could not convert limit to string")
 	}
+	return SendAssetToIssuerAmount(assetCode, destination, amount, seed)
+}
 
-	amount, err := utils.ToString(amountx)
+// SendAssetToIssuerAmount sends an asset back to the issuer
+func SendAssetToIssuerAmount(assetCode string, destination string, amount utils.Amount,
+	seed string) (int32, string, error) {
+
+	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
 	if err != nil {
-		return -1, "", errors.New("could not convert limit to string")
+		return -1, "", err
 	}
 
 	op := build.Payment{
 		Destination: destination,
-		Amount:      amount,
+		Amount:      amount.String(),
 		Asset:       build.CreditAsset{assetCode, destination},
 	}
 
@@ -107,22 +130,30 @@ func SendAssetToIssuer(assetCode string, destination string, amountx float64,
 }
 
 // SendAsset sends an asset to a destination which has an established trustline with the issuer
+//
+// Deprecated: use SendAssetAmount, floats can't represent most amounts exactly
 func SendAsset(assetCode string, issuerPubkey string, destination string, amountx float64,
 	seed string, memo string) (int32, string, error) {
 
-	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
+	amount, err := utils.AmountFromFloat(amountx)
 	if err != nil {
-		return -1, "", err
+		return -1, "", errors.New("could not convert limit to string")
 	}
+	return SendAssetAmount(assetCode, issuerPubkey, destination, amount, seed, memo)
+}
 
-	amount, err := utils.ToString(amountx)
+// SendAssetAmount sends an asset to a destination which has an established trustline with the issuer
+func SendAssetAmount(assetCode string, issuerPubkey string, destination string, amount utils.Amount,
+	seed string, memo string) (int32, string, error) {
+
+	sourceAccount, mykp, err := xlm.ReturnSourceAccount(seed)
 	if err != nil {
-		return -1, "", errors.New("could not convert limit to string")
+		return -1, "", err
 	}
 
 	op := build.Payment{
 		Destination: destination,
-		Amount:      amount,
+		Amount:      amount.String(),
 		Asset:       build.CreditAsset{assetCode, issuerPubkey},
 	}
 
@@ -1,9 +1,9 @@
 package xlm
 
 import (
-	"log"
 	"net/http"
 
+	"github.com/Varunram/essentials/logger"
 	horizon "github.com/stellar/go/clients/horizonclient"
 	"github.com/stellar/go/network"
 )
@@ -28,13 +28,13 @@ func SetConsts(amount float64, mainnet bool) {
 	Mainnet = mainnet
 	if mainnet {
 		Passphrase = network.PublicNetworkPassphrase
-		log.Println("Pointing horizon to mainnet")
+		logger.Info("pointing horizon to mainnet")
 		TestNetClient = &horizon.Client{
 			HorizonURL: "https://horizon.stellar.org/", // switch to mainnet horizon
 			HTTP:       http.DefaultClient,
 		}
 	} else {
-		log.Println("Pointing horizon to testnet")
+		logger.Info("pointing horizon to testnet")
 		Passphrase = network.TestNetworkPassphrase
 		TestNetClient = &horizon.Client{
 			HorizonURL: "https://horizon-testnet.stellar.org/",
@@ -35,6 +35,12 @@ func NewBuyOrder(seed string, assetName string, issuer string,
 	return xlm.SendTx(mykp, &sourceAccount, memo, build.Operation(&buyOffer))
 }
 
+// NewBuyOrderAmount creates a new buy order on the stellar dex
+func NewBuyOrderAmount(seed string, assetName string, issuer string,
+	amount utils.Amount, price utils.Amount) (int32, string, error) {
+	return NewBuyOrder(seed, assetName, issuer, amount.String(), price.String())
+}
+
 // NewSellOrder creates a new sell order on the stellar dex
 func NewSellOrder(seed string, assetName string, issuer string, amount string,
 	price string) (int32, string, error) {
@@ -57,6 +63,12 @@ func NewSellOrder(seed string, assetName string, issuer string, amount string,
 	return xlm.SendTx(mykp, &sourceAccount, memo, build.Operation(&sellOffer))
 }
 
+// NewSellOrderAmount creates a new sell order on the stellar dex
+func NewSellOrderAmount(seed string, assetName string, issuer string, amount utils.Amount,
+	price utils.Amount) (int32, string, error) {
+	return NewSellOrder(seed, assetName, issuer, amount.String(), price.String())
+}
+
 // StableCoinBuy gets the price from an oracle and places an order on the DEX to buy AnchorUSD
 func StableCoinBuy(seed string, amount string) (int32, string, error) {
 	assetName := "USD"
@@ -66,8 +78,11 @@ func StableCoinBuy(seed string, amount string) (int32, string, error) {
 		return -1, "", errors.New("could not fetch price form binance, quitting")
 	}
 	price = price * 1.02 // a small premium to get the order fulfilled immediately
-	ftss, _ := utils.ToString(price)
-	return NewBuyOrder(seed, assetName, issuer, amount, ftss)
+	ftss, err := utils.AmountFromFloat(price)
+	if err != nil {
+		return -1, "", errors.Wrap(err, "could not convert price to string")
+	}
+	return NewBuyOrder(seed, assetName, issuer, amount, ftss.String())
 }
 
 // StableCoinSell places a sell order for STABLEUSD on the Stellar dex
@@ -79,6 +94,19 @@ func StableCoinSell(seed string, amount string) (int32, string, error) {
 		return -1, "", errors.New("could not fetch price form binance, quitting")
 	}
 	price = price * 1.02 // a small premium to get the order fulfilled immediately
-	ftss, _ := utils.ToString(price)
-	return NewSellOrder(seed, assetName, issuer, amount, ftss)
+	ftss, err := utils.AmountFromFloat(price)
+	if err != nil {
+		return -1, "", errors.Wrap(err, "could not convert price to string")
+	}
+	return NewSellOrder(seed, assetName, issuer, amount, ftss.String())
+}
+
+// StableCoinBuyAmount gets the price from an oracle and places an order on the DEX to buy AnchorUSD
+func StableCoinBuyAmount(seed string, amount utils.Amount) (int32, string, error) {
+	return StableCoinBuy(seed, amount.String())
+}
+
+// StableCoinSellAmount places a sell order for STABLEUSD on the Stellar dex
+func StableCoinSellAmount(seed string, amount utils.Amount) (int32, string, error) {
+	return StableCoinSell(seed, amount.String())
 }
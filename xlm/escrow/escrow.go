@@ -1,8 +1,7 @@
 package escrow
 
 import (
-	"log"
-
+	"github.com/Varunram/essentials/logger"
 	xlm "github.com/Varunram/essentials/xlm"
 	assets "github.com/Varunram/essentials/xlm/assets"
 	multisig "github.com/Varunram/essentials/xlm/multisig"
@@ -25,18 +24,18 @@ func InitEscrow(projIndex int, seedpwd string, recpPubkey string, mySeed string,
 		return pubkey, errors.Wrap(err, "error while initializing multisig escrow, quitting!")
 	}
 
-	log.Println("successfully initialized multisig escrow")
+	logger.Info("successfully initialized multisig escrow", logger.F("pubkey", pubkey))
 	// define two seeds that are needed for signing transactions from the escrow
 	seed1 := otherSeed
 	seed2 := mySeed
 
-	log.Println("stored escrow pubkey successfully")
+	logger.Info("stored escrow pubkey successfully")
 	err = multisig.AuthImmutable2of2(pubkey, seed1, seed2)
 	if err != nil {
 		return pubkey, errors.Wrap(err, "could not set auth immutable on account, quitting!")
 	}
 
-	log.Println("set auth immutable on account successfully")
+	logger.Info("set auth immutable on account successfully")
 	if !xlm.Mainnet {
 		multisig.TrustAssetTx(stablecoin.StablecoinCode, stablecoin.StablecoinPublicKey, "10000000000", pubkey, seed1, seed2)
 		if err != nil {
@@ -70,7 +69,7 @@ func TransferFundsToEscrow(amount float64, projIndex int, escrowPubkey string, o
 		}
 	}
 
-	log.Println("tx hash for funding project escrow is: ", txhash)
+	logger.Info("funded project escrow", logger.F("project", projIndex), logger.F("txhash", txhash))
 	return nil
 }
 
@@ -2,12 +2,10 @@ package xlm
 
 import (
 	"encoding/json"
-	"io/ioutil"
-	"log"
-	"net/http"
 
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
 	utils "github.com/Varunram/essentials/utils"
 	protocols "github.com/stellar/go/protocols/horizon"
 )
@@ -22,19 +20,11 @@ func GetLedgerData(blockNumberx int) ([]byte, error) {
 		return data, err
 	}
 
-	resp, err := http.Get(TestNetClient.HorizonURL + "ledgers/" + blockNumber)
-	if err != nil || resp.Status != "200 OK" {
-		return data, errors.New("API Request did not succeed")
+	data, err = get(TestNetClient.HorizonURL + "ledgers/" + blockNumber)
+	if err != nil {
+		return data, errors.Wrap(err, "API Request did not succeed")
 	}
-
-	defer func() {
-		if ferr := resp.Body.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	data, err = ioutil.ReadAll(resp.Body)
-	return data, err
+	return data, nil
 }
 
 // GetBlockHash gets the block hash corresponding to a block number
@@ -49,27 +39,16 @@ func GetBlockHash(blockNumber int) (string, error) {
 	var x protocols.Ledger
 	err = json.Unmarshal(b, &x)
 	hash = x.Hash
-	log.Printf("The block hash for block %d is: %s and the prev hash is %s", x.Sequence, hash, x.PrevHash)
+	logger.Debug("got block hash", logger.F("block", x.Sequence), logger.F("hash", hash), logger.F("prev_hash", x.PrevHash))
 	return hash, err
 }
 
 // GetLatestBlockHash gets the lastest block hash
 func GetLatestBlockHash() (string, error) {
 	url := TestNetClient.HorizonURL + "ledgers?cursor=now&order=desc&limit=1"
-	resp, err := http.Get(url)
-	if err != nil || resp.Status != "200 OK" {
-		return "", errors.New("API Request did not succeed")
-	}
-
-	defer func() {
-		if ferr := resp.Body.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	data, err := ioutil.ReadAll(resp.Body)
+	data, err := get(url)
 	if err != nil {
-		return "", errors.Wrap(err, "could not read response body")
+		return "", errors.Wrap(err, "API Request did not succeed")
 	}
 	// hacks below follow because of stellar's incomplete go sdk support
 	var x map[string]*json.RawMessage
@@ -96,20 +75,9 @@ func GetLatestBlockHash() (string, error) {
 // GetLatestBlock fetches the latest block from the blockchain
 func GetLatestBlock() (int32, error) {
 	url := TestNetClient.HorizonURL + "ledgers?cursor=now&order=desc&limit=1"
-	resp, err := http.Get(url)
-	if err != nil || resp.Status != "200 OK" {
-		return -1, errors.New("API Request did not succeed")
-	}
-
-	defer func() {
-		if ferr := resp.Body.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	data, err := ioutil.ReadAll(resp.Body)
+	data, err := get(url)
 	if err != nil {
-		return -1, errors.Wrap(err, "could not read response body")
+		return -1, errors.Wrap(err, "API Request did not succeed")
 	}
 	// hacks below follow because of stellar's incomplete go sdk support
 	var x map[string]*json.RawMessage
@@ -137,112 +105,118 @@ func GetLatestBlock() (int32, error) {
 func GetAccountData(a string) ([]byte, error) {
 	var err error
 	var data []byte
-	resp, err := http.Get(TestNetClient.HorizonURL + "accounts/" + a)
+	data, err = get(TestNetClient.HorizonURL + "accounts/" + a)
 	if err != nil {
 		return data, errors.Wrap(err, "could not get /accounts/ endpoint from API")
 	}
-	if resp.Status != "200 OK" {
-		return data, errors.New("Request did not succeed")
-	}
-
-	defer func() {
-		if ferr := resp.Body.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	data, err = ioutil.ReadAll(resp.Body)
-	return data, err
+	return data, nil
 }
 
-// GetNativeBalance gets the xlm balance of a specific account
-func GetNativeBalance(publicKey string) float64 {
-	var err error
+// ErrBalanceNotFound is returned when an account doesn't hold the requested asset
+var ErrBalanceNotFound = errors.New("balance not found")
+
+// accountBalances returns the balances of an account
+func accountBalances(publicKey string) ([]protocols.Balance, error) {
 	b, err := GetAccountData(publicKey)
 	if err != nil {
-		log.Println(err)
-		return -1
+		logger.Error("could not get account data", logger.F("pubkey", publicKey), logger.Err(err))
+		return nil, err
 	}
 	var x protocols.Account
 	err = json.Unmarshal(b, &x)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not unmarshal account data", logger.F("pubkey", publicKey), logger.Err(err))
+		return nil, errors.Wrap(err, "could not unmarshal account data")
+	}
+	return x.Balances, nil
+}
+
+// floatBalance converts the result of a balance function for the float64 balance functions,
+// which return -1 on errors and 0 if the balance wasn't found
+func floatBalance(amount utils.Amount, err error) float64 {
+	if err == ErrBalanceNotFound {
+		return 0
+	}
+	if err != nil {
 		return -1
 	}
-	for _, balance := range x.Balances {
+	return amount.Float64()
+}
+
+// GetNativeBalance gets the xlm balance of a specific account
+//
+// Deprecated: use GetNativeBalanceAmount, floats can't represent most amounts exactly
+func GetNativeBalance(publicKey string) float64 {
+	return floatBalance(GetNativeBalanceAmount(publicKey))
+}
+
+// GetNativeBalanceAmount gets the xlm balance of a specific account
+func GetNativeBalanceAmount(publicKey string) (utils.Amount, error) {
+	balances, err := accountBalances(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	for _, balance := range balances {
 		if balance.Asset.Type == "native" {
-			balance, err := utils.ToFloat(balance.Balance)
-			if err != nil {
-				return 0
-			}
-			return balance
+			return utils.ParseAmount(balance.Balance)
 		}
 	}
 
-	log.Println("Native balance not found")
-	return 0
+	logger.Warn("native balance not found", logger.F("pubkey", publicKey))
+	return 0, ErrBalanceNotFound
 }
 
 // GetAssetBalance gets the balance of the user in the specific asset
+//
+// Deprecated: use GetAssetBalanceAmount, floats can't represent most amounts exactly
 func GetAssetBalance(publicKey string, assetName string) float64 {
-	var err error
-	b, err := GetAccountData(publicKey)
-	if err != nil {
-		log.Println(err)
-		return -1
-	}
-	var x protocols.Account
-	err = json.Unmarshal(b, &x)
+	return floatBalance(GetAssetBalanceAmount(publicKey, assetName))
+}
+
+// GetAssetBalanceAmount gets the balance of the user in the specific asset. ErrBalanceNotFound
+// is returned if the user doesn't have a trustline to the asset
+func GetAssetBalanceAmount(publicKey string, assetName string) (utils.Amount, error) {
+	balances, err := accountBalances(publicKey)
 	if err != nil {
-		log.Println(err)
-		return -1
+		return 0, err
 	}
-	for _, balance := range x.Balances {
+	for _, balance := range balances {
 		if balance.Asset.Code == assetName {
-			balance, err := utils.ToFloat(balance.Balance)
-			if err != nil {
-				return 0
-			}
-			return balance
+			return utils.ParseAmount(balance.Balance)
 		}
 	}
 
-	// if the asset does not exist, the balance associated is zero
-	// but to differentiate between not having the asset and never
-	// having had the asset, we return -1
-	log.Println("Asset: ", assetName, " publickey: ", publicKey, " balance not found")
-	return 0
+	logger.Warn("asset balance not found", logger.F("asset", assetName), logger.F("pubkey", publicKey))
+	return 0, ErrBalanceNotFound
 }
 
 // GetAssetTrustLimit gets the trust limit that the user has with an issuer
+//
+// Deprecated: use GetAssetTrustLimitAmount, floats can't represent most amounts exactly
 func GetAssetTrustLimit(publicKey string, assetName string) float64 {
-	var err error
-	b, err := GetAccountData(publicKey)
-	if err != nil {
-		return -1
-	}
-	var x protocols.Account
-	err = json.Unmarshal(b, &x)
+	return floatBalance(GetAssetTrustLimitAmount(publicKey, assetName))
+}
+
+// GetAssetTrustLimitAmount gets the trust limit that the user has with an issuer.
+// ErrBalanceNotFound is returned if the user doesn't have a trustline to the asset
+func GetAssetTrustLimitAmount(publicKey string, assetName string) (utils.Amount, error) {
+	balances, err := accountBalances(publicKey)
 	if err != nil {
-		return -1
+		return 0, err
 	}
-	for _, balance := range x.Balances {
+	for _, balance := range balances {
 		if balance.Asset.Code == assetName {
-			balance, err := utils.ToFloat(balance.Balance)
-			if err != nil {
-				return 0
-			}
-			return balance
+			return utils.ParseAmount(balance.Limit)
 		}
 	}
-	return 0
+	return 0, ErrBalanceNotFound
 }
 
 // GetAllBalances gets all the balances associated with a certain account.
 func GetAllBalances(publicKey string) ([]protocols.Balance, error) {
 	account, err := ReturnSourceAccountPubkey(publicKey)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not load account", logger.F("pubkey", publicKey), logger.Err(err))
 		return nil, errors.Wrap(err, "could not load account")
 	}
 	return account.Balances, nil
@@ -267,21 +241,13 @@ func HasStableCoin(publicKey string) bool {
 func GetTransactionData(txhash string) ([]byte, error) {
 	var err error
 	var data []byte
-	resp, err := http.Get(TestNetClient.HorizonURL + "transactions/" + txhash)
-	if err != nil || resp.Status != "200 OK" {
+	data, err = get(TestNetClient.HorizonURL + "transactions/" + txhash)
+	if err != nil {
 		// check here since if we don't, we need to check the body of the unmarshalled
 		// response to see if we have 0
-		return data, errors.New("API Request did not succeed")
+		return data, errors.Wrap(err, "API Request did not succeed")
 	}
-
-	defer func() {
-		if ferr := resp.Body.Close(); ferr != nil {
-			err = ferr
-		}
-	}()
-
-	data, err = ioutil.ReadAll(resp.Body)
-	return data, err
+	return data, nil
 }
 
 // GetTransactionHeight gets height at which a tx was confirmed
@@ -1,10 +1,10 @@
 package issuer
 
 import (
-	"log"
 	"os"
 	"time"
 
+	"github.com/Varunram/essentials/logger"
 	utils "github.com/Varunram/essentials/utils"
 	xlm "github.com/Varunram/essentials/xlm"
 	wallet "github.com/Varunram/essentials/xlm/wallet"
@@ -43,6 +43,16 @@ func InitIssuer(issuerPath string, projIndex int, seedpwd string) error {
 	return nil
 }
 
+// RotateIssuer changes the password of the keyfile of an issuer
+func RotateIssuer(issuerPath string, projIndex int, oldpwd string, newpwd string) error {
+	path := GetPath(issuerPath, projIndex)
+	err := wallet.ChangePassword(path, oldpwd, newpwd)
+	if err != nil {
+		return errors.Wrap(err, "Error while rotating seed")
+	}
+	return nil
+}
+
 // DeleteIssuer deletes the keyfile
 func DeleteIssuer(issuerPath string, projIndex int) error {
 	path := GetPath(issuerPath, projIndex)
@@ -52,25 +62,25 @@ func DeleteIssuer(issuerPath string, projIndex int) error {
 // FundIssuer creates an issuer account and funds it with a second account
 func FundIssuer(issuerPath string, projIndex int, seedpwd string, funderSeed string) error {
 	// need to read the seed from the file using the seedpwd
-	log.Println("Setting up issuer for project: ", projIndex)
+	logger.Info("setting up issuer for project", logger.F("project", projIndex))
 	path := GetPath(issuerPath, projIndex)
 	pubkey, seed, err := wallet.RetrieveSeed(path, seedpwd)
 	if err != nil {
 		return errors.Wrap(err, "Error while retrieving seed")
 	}
-	log.Printf("Project Index: %d, Seed: %s, Address: %s", projIndex, seed, pubkey)
-	_, txhash, err := xlm.SendXLMCreateAccount(pubkey, 5, funderSeed)
+	logger.Debug("retrieved issuer seed", logger.F("project", projIndex), logger.Secret("seed", seed), logger.F("pubkey", pubkey))
+	_, txhash, err := xlm.SendXLMCreateAccountAmount(pubkey, 5*utils.One, funderSeed)
 	if err != nil {
-		log.Println("FUNDER SEED: ", funderSeed)
+		logger.Error("could not fund issuer", logger.Secret("funder_seed", funderSeed), logger.Err(err))
 		return errors.Wrap(err, "Error while sending xlm to create issuer")
 	}
-	log.Printf("Txhash for setting up Project Issuer for project %d is %s", projIndex, txhash)
+	logger.Info("set up project issuer", logger.F("project", projIndex), logger.F("txhash", txhash))
 	time.Sleep(5 * time.Second)
 	_, txhash, err = xlm.SetAuthImmutable(seed)
 	if err != nil {
 		return errors.Wrap(err, "Error while setting auth immutable on account")
 	}
-	log.Printf("Txhash for setting Auth Immutable on project %d is %s", projIndex, txhash)
+	logger.Info("set auth immutable on issuer", logger.F("project", projIndex), logger.F("txhash", txhash))
 	return nil
 }
 
@@ -85,6 +95,6 @@ func FreezeIssuer(issuerPath string, projIndex int, seedpwd string) (string, err
 	if err != nil {
 		return "", errors.Wrap(err, "Error while freezing account")
 	}
-	log.Println("Tx hash for freezing account is: ", txhash)
+	logger.Info("froze issuer account", logger.F("project", projIndex), logger.F("txhash", txhash))
 	return txhash, nil
 }
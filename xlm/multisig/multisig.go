@@ -1,11 +1,13 @@
 package multisig
 
 import (
-	"log"
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
+	"github.com/Varunram/essentials/retry"
 	utils "github.com/Varunram/essentials/utils"
 	xlm "github.com/Varunram/essentials/xlm"
 	"github.com/stellar/go/keypair"
@@ -87,7 +89,7 @@ func Newxofy(x int, y int, signers ...string) (string, error) {
 	}
 
 	if xlm.Mainnet {
-		log.Println("SEND XLM TO THIS ADDRESS: ", pubkey)
+		logger.Warn("send xlm to this address to create the multisig account", logger.F("pubkey", pubkey))
 		time.Sleep(150 * time.Second)
 	} else {
 		err = xlm.GetXLM(pubkey)
@@ -155,66 +157,61 @@ func SendTx22(pubkey, signer1, signer2, memo string, ops ...build.Operation) (in
 
 	txsigned, err := tx.Sign(xlm.Passphrase, kp1.(*keypair.Full), kp2.(*keypair.Full))
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not sign transaction", logger.Err(err))
 		return -1, "", errors.Wrap(err, "could not sign")
 	}
 
 	txe, err := txsigned.Base64()
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not convert transaction to base 64", logger.Err(err))
 		return -1, "", errors.Wrap(err, "could not convert to base 64")
 	}
 
-	var resp horizonprotocol.Transaction
-	resp, err = xlm.TestNetClient.SubmitTransactionXDR(txe)
-	if err != nil {
-		// might be a problem with horizon that causes this
-		log.Println("failed to broadcast transaction the first time")
-		time.Sleep(5 * time.Second)
-		resp, err = xlm.TestNetClient.SubmitTransactionXDR(txe)
-		if err != nil {
-			log.Println(err)
-			return -1, "", errors.Wrap(err, "could not submit tx to horizon")
-		}
-	}
-
-	log.Printf("Propagated Transaction: %s, sequence: %d\n", resp.Hash, resp.Ledger)
-	return resp.Ledger, resp.Hash, nil
+	return SendTx(txe)
 }
 
-// SendTx broadcasts a multisig tx
+// SendTx broadcasts a multisig tx, resubmitting it with xlm.SubmitPolicy if horizon rejects it
+// for reasons that may be temporary
 func SendTx(txe string) (int32, string, error) {
 	var resp horizonprotocol.Transaction
-	resp, err := xlm.TestNetClient.SubmitTransactionXDR(txe)
-	if err != nil {
-		// might be a problem with horizon that causes this
-		log.Println("failed to broadcast multisig transaction the first time")
-		time.Sleep(5 * time.Second)
+	err := retry.Do(context.Background(), xlm.SubmitPolicy, func(ctx context.Context) error {
+		var err error
 		resp, err = xlm.TestNetClient.SubmitTransactionXDR(txe)
 		if err != nil {
-			log.Println(err)
-			return -1, "", errors.Wrap(err, "could not submit tx to horizon")
+			// might be a problem with horizon that causes this
+			logger.Warn("failed to broadcast multisig transaction", logger.Err(err))
 		}
+		return err
+	})
+	if err != nil {
+		logger.Error("could not submit tx to horizon", logger.Err(err))
+		return -1, "", errors.Wrap(err, "could not submit tx to horizon")
 	}
 
-	log.Printf("Propagated Transaction: %s, sequence: %d\n", resp.Hash, resp.Ledger)
+	logger.Info("propagated transaction", logger.F("hash", resp.Hash), logger.F("ledger", resp.Ledger))
 	return resp.Ledger, resp.Hash, nil
 }
 
 // Tx2of2 constructs a tx where the source account pubkey1 is the 2of2 account, we need 2 signers for this tx
+//
+// Deprecated: use Tx2of2Amount, floats can't represent most amounts exactly
 func Tx2of2(pubkey string, destination string, signer1 string, signer2 string, amountx float64, memo string) error {
-	amount, err := utils.ToString(amountx)
+	amount, err := utils.AmountFromFloat(amountx)
 	if err != nil {
 		return errors.Wrap(err, "could not convert to float, quitting")
 	}
+	return Tx2of2Amount(pubkey, destination, signer1, signer2, amount, memo)
+}
 
+// Tx2of2Amount constructs a tx where the source account pubkey1 is the 2of2 account, we need 2 signers for this tx
+func Tx2of2Amount(pubkey string, destination string, signer1 string, signer2 string, amount utils.Amount, memo string) error {
 	op := build.Payment{
 		Destination: destination,
-		Amount:      amount,
+		Amount:      amount.String(),
 		Asset:       build.NativeAsset{},
 	}
 
-	_, _, err = SendTx22(pubkey, signer1, signer2, memo, build.Operation(&op))
+	_, _, err := SendTx22(pubkey, signer1, signer2, memo, build.Operation(&op))
 	if err != nil {
 		return errors.Wrap(err, "could not send 22")
 	}
@@ -223,19 +220,25 @@ func Tx2of2(pubkey string, destination string, signer1 string, signer2 string, a
 }
 
 // Tx2of2Asset constructs a non XLM tx where the source account pubkey1 is the 2of2 account, we need 2 signers for this tx
+//
+// Deprecated: use Tx2of2AssetAmount, floats can't represent most amounts exactly
 func Tx2of2Asset(pubkey string, destination string, assetIssuer string, signer1 string, signer2 string, amountx float64, asset string, memo string) error {
-	amount, err := utils.ToString(amountx)
+	amount, err := utils.AmountFromFloat(amountx)
 	if err != nil {
 		return errors.Wrap(err, "could not convert to float, quitting")
 	}
+	return Tx2of2AssetAmount(pubkey, destination, assetIssuer, signer1, signer2, amount, asset, memo)
+}
 
+// Tx2of2AssetAmount constructs a non XLM tx where the source account pubkey1 is the 2of2 account, we need 2 signers for this tx
+func Tx2of2AssetAmount(pubkey string, destination string, assetIssuer string, signer1 string, signer2 string, amount utils.Amount, asset string, memo string) error {
 	op := build.Payment{
 		Destination: destination,
-		Amount:      amount,
+		Amount:      amount.String(),
 		Asset:       build.CreditAsset{Code: asset, Issuer: assetIssuer},
 	}
 
-	_, _, err = SendTx22(pubkey, signer1, signer2, memo, build.Operation(&op))
+	_, _, err := SendTx22(pubkey, signer1, signer2, memo, build.Operation(&op))
 	if err != nil {
 		return errors.Wrap(err, "could not send 22")
 	}
@@ -0,0 +1,65 @@
+package xlm
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Varunram/essentials/retry"
+	erpc "github.com/Varunram/essentials/rpc"
+	horizon "github.com/stellar/go/clients/horizonclient"
+)
+
+// SubmitPolicy is the policy transactions are resubmitted to horizon with. Each retry of
+// SendTx bumps the base fee of the transaction
+var SubmitPolicy = retry.Policy{
+	MaxAttempts: 3,
+	Initial:     time.Second,
+	Max:         10 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+	Retryable:   isRetryable,
+}
+
+// RequestPolicy is the policy failed reads from horizon are retried with
+var RequestPolicy = retry.Policy{
+	MaxAttempts: 5,
+	MaxElapsed:  time.Minute,
+	Initial:     500 * time.Millisecond,
+	Max:         10 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+	Retryable:   isRetryable,
+}
+
+// horizonError returns the horizon error in the causes of err
+func horizonError(err error) *horizon.Error {
+	switch herr := errors.Cause(err).(type) {
+	case *horizon.Error:
+		return herr
+	case horizon.Error:
+		return &herr
+	}
+	return nil
+}
+
+// isRetryable retries horizon errors caused by load on horizon or a fee that is too low,
+// other horizon errors won't go away by submitting again
+func isRetryable(err error) bool {
+	herr := horizonError(err)
+	if herr == nil {
+		return retry.IsRetryable(err)
+	}
+	if herr.Problem.Status == http.StatusTooManyRequests || herr.Problem.Status >= 500 {
+		return true
+	}
+	codes, cerr := herr.ResultCodes()
+	return cerr == nil && codes != nil && codes.TransactionCode == "tx_insufficient_fee"
+}
+
+// get reads a horizon endpoint, retrying with RequestPolicy
+func get(url string) ([]byte, error) {
+	return erpc.GetRequestContext(context.Background(), RequestPolicy, url)
+}
@@ -2,10 +2,10 @@ package stablecoin
 
 import (
 	"github.com/pkg/errors"
-	"log"
 	// "time"
 
 	tickers "github.com/Varunram/essentials/exchangetickers"
+	"github.com/Varunram/essentials/logger"
 	xlm "github.com/Varunram/essentials/xlm"
 	assets "github.com/Varunram/essentials/xlm/assets"
 )
@@ -19,7 +19,7 @@ func GetAnchorUSD(recpSeed string, amountUSD float64) (string, error) {
 	if err != nil {
 		return txhash, errors.Wrap(err, "couldn't trust anchorUSD")
 	}
-	log.Println("tx hash for trusting stableUSD: ", txhash)
+	logger.Info("trusted anchorUSD", logger.F("txhash", txhash))
 	// now send coins across and see if our tracker detects it
 	// the given amount is in USD, we need to convert it into XLM since we're sending XLM
 	exchangeRate, err := tickers.XLMUSD()
@@ -28,11 +28,11 @@ func GetAnchorUSD(recpSeed string, amountUSD float64) (string, error) {
 	}
 	amountXLM := exchangeRate * amountUSD
 
-	log.Println("Exchanging: ", amountXLM, " XLM for anchorUSD")
+	logger.Info("exchanging XLM for anchorUSD", logger.F("amount", amountXLM))
 	_, txhash, err = xlm.SendXLM(AnchorUSDAddress, amountXLM, recpSeed, "Exchange XLM for anchorUSD")
 	if err != nil {
 		return txhash, errors.Wrap(err, "couldn't send xlm")
 	}
-	log.Println("tx hash for sent xlm: ", txhash)
+	logger.Info("sent xlm to anchorUSD", logger.F("txhash", txhash))
 	return txhash, nil
 }
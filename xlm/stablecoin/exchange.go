@@ -1,11 +1,11 @@
 package stablecoin
 
 import (
-	"log"
 	"sync"
 
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
 	xlm "github.com/Varunram/essentials/xlm"
 	assets "github.com/Varunram/essentials/xlm/assets"
 	// utils "github.com/Varunram/essentials/utils"
@@ -50,10 +50,10 @@ func Exchange(recipientPK string, recipientSeed string, convAmount float64) erro
 
 	select {
 	case err := <-err1:
-		log.Println(err)
+		logger.Error("can't exchange xlm for stablecoin", logger.Err(err))
 		return err
 	case err := <-err2:
-		log.Println(err)
+		logger.Error("can't exchange xlm for stablecoin", logger.Err(err))
 		return err
 	default:
 		break
@@ -61,17 +61,18 @@ func Exchange(recipientPK string, recipientSeed string, convAmount float64) erro
 
 	_, err := assets.TrustAsset(StablecoinCode, StablecoinPublicKey, StablecoinTrustLimit, recipientSeed)
 	if err != nil {
-		log.Println(err)
+		logger.Error("couldn't trust asset", logger.Err(err))
 		return errors.Wrap(err, "couldn't trust asset")
 	}
-	log.Println("stableUSD trustline created")
+	logger.Info("stableUSD trustline created")
 
 	_, _, err = xlm.SendXLM(StablecoinPublicKey, convAmount, recipientSeed, "Exchange XLM for stablecoin")
 	if err != nil {
-		log.Println("error while sending XLM", StablecoinPublicKey, convAmount, recipientSeed, err)
+		logger.Error("error while sending XLM", logger.F("pubkey", StablecoinPublicKey), logger.F("amount", convAmount),
+			logger.Secret("seed", recipientSeed), logger.Err(err))
 		return errors.Wrap(err, "couldn't send xlm")
 	}
-	log.Println("sent xlm / waiting to receive stableUSD")
+	logger.Info("sent xlm / waiting to receive stableUSD")
 
 	return nil
 }
@@ -87,7 +88,7 @@ func OfferExchange(publicKey string, seed string, invAmount float64) error {
 
 	balance := xlm.GetAssetBalance(publicKey, StablecoinCode)
 	if balance < invAmount {
-		log.Println("Offering xlm to stableusd exchange to investor")
+		logger.Info("offering xlm to stableusd exchange to investor")
 		// user's stablecoin balance is less than the amount he wishes to invest, get stablecoin
 		// equal to the amount he wishes to exchange
 		diff := invAmount - balance + 10 // the extra 1 is to cover for fees
@@ -102,14 +103,14 @@ func OfferExchange(publicKey string, seed string, invAmount float64) error {
 		exchangeRate := tickers.ExchangeXLMforUSD(1)
 		// 1 xlm can fetch exchangeRate USD, how much xlm does diff USD need?
 		amountToExchange := diff / exchangeRate
-		log.Println(diff, exchangeRate, amountToExchange)
+		logger.Debug("exchanging xlm", logger.F("diff", diff), logger.F("rate", exchangeRate), logger.F("amount", amountToExchange))
 		err := Exchange(publicKey, seed, amountToExchange)
 		if err != nil {
 			return errors.Wrap(err, "Unable to exchange XLM for USD and automate payment. Please get more STABLEUSD to fulfil the payment")
 		}
 		time.Sleep(10 * time.Second) // 5 seconds for issuing stalbeusd to the person who's requested for it
 	} else {
-		log.Println("User has sufficient stablecoin balance, not exchanging xlm for usd")
+		logger.Info("user has sufficient stablecoin balance, not exchanging xlm for usd")
 	}
 
 	return nil
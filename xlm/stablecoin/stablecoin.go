@@ -3,11 +3,11 @@ package stablecoin
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"time"
 
 	tickers "github.com/Varunram/essentials/exchangetickers"
+	"github.com/Varunram/essentials/logger"
 	scan "github.com/Varunram/essentials/scan"
 	utils "github.com/Varunram/essentials/utils"
 	xlm "github.com/Varunram/essentials/xlm"
@@ -72,20 +72,16 @@ func ListenForPayments() {
 	ctx, cancel := context.WithCancel(context.Background()) // cancel
 	defer cancel()
 	go func() {
-		log.Println("monitoring payments made towards address")
+		logger.Info("monitoring payments made towards address", logger.F("pubkey", StablecoinPublicKey))
 		time.Sleep(5 * time.Second) // refresh the thread every 5 seconds to check for payments
 		// cancel() don't cancel, let it run indefinitely
 	}()
 
 	printHandler := func(op operations.Operation) {
 		/*
-			log.Println("stablecoin operation: ", op)
-			log.Println("PAGING TOKEN: ", op.PagingToken())
-			log.Println("GETTYPE TOKEN: ", op.GetType())
-			log.Println("GETID TOKEN: ", op.GetID())
-			log.Println("GetTransactionHash TOKEN: ", op.GetTransactionHash())
-			log.Println("IsTransactionSuccessful TOKEN: ", op.IsTransactionSuccessful())
-			log.Println("IsTransactionSuccessful TOKEN: ", op)
+			logger.Debug("stablecoin operation", logger.F("op", op), logger.F("paging_token", op.PagingToken()),
+				logger.F("type", op.GetType()), logger.F("id", op.GetID()), logger.F("txhash", op.GetTransactionHash()),
+				logger.F("successful", op.IsTransactionSuccessful()))
 		*/
 		if op.IsTransactionSuccessful() {
 			switch payment := op.(type) {
@@ -95,13 +91,13 @@ func ListenForPayments() {
 					amount, _ := utils.ToFloat(payment.Amount)
 					xlmWorth := tickers.ExchangeXLMforUSD(amount)
 
-					log.Println("Received request for stablecoin from", payee)
+					logger.Info("received request for stablecoin", logger.F("payee", payee), logger.F("amount", xlmWorth))
 
 					_, _, err := assets.SendAssetFromIssuer(StablecoinCode, payee, xlmWorth, StablecoinSeed, StablecoinPublicKey)
 					if err != nil {
-						log.Println("Error while sending USD Assets back to payee: ", payee, err)
+						logger.Error("error while sending USD Assets back to payee", logger.F("payee", payee), logger.Err(err))
 					}
-					log.Println("Sent STABLEUSD to: ", payee)
+					logger.Info("sent STABLEUSD", logger.F("payee", payee))
 				}
 			}
 		}
@@ -109,7 +105,7 @@ func ListenForPayments() {
 
 	err := client.StreamPayments(ctx, opRequest, printHandler)
 	if err != nil {
-		log.Println(err)
+		logger.Error("could not stream payments", logger.Err(err))
 		return
 	}
 	return
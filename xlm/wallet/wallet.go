@@ -1,18 +1,54 @@
 package wallet
 
 import (
-	"log"
-	"os"
-
 	"github.com/pkg/errors"
 
+	aead "github.com/Varunram/essentials/aead"
 	aes "github.com/Varunram/essentials/aes"
+	// register cc20 so that it can be selected with SetCipher
+	_ "github.com/Varunram/essentials/chacha20poly1305"
+	kdf "github.com/Varunram/essentials/kdf"
+	"github.com/Varunram/essentials/logger"
 	"github.com/stellar/go/keypair"
 )
 
 // the wallet package contains stellar specific wallet functions
 
-// NewSeedStore creates a new seed and stores the seed in an encrypted form in the passed path
+// KDF are the params used to derive the key that encrypts seeds. Seeds are unlocked rarely
+// so we can afford the more expensive profile
+var KDF = kdf.Sensitive
+
+// SetKDF sets the params used to derive the key that encrypts seeds
+func SetKDF(params kdf.Params) error {
+	if err := params.Validate(); err != nil {
+		return errors.Wrap(err, "invalid kdf params")
+	}
+	KDF = params
+	return nil
+}
+
+// Cipher is the name of the aead cipher used to encrypt seeds
+var Cipher = aes.Name
+
+// SetCipher sets the aead cipher used to encrypt seeds. Seeds are tagged with the cipher that
+// encrypted them, so seeds stored with a different cipher can still be retrieved and are
+// re-encrypted with the new cipher when they are read
+func SetCipher(name string) error {
+	if _, err := aead.New(name, ""); err != nil {
+		return err
+	}
+	Cipher = name
+	return nil
+}
+
+// newCipher returns the cipher used to encrypt seeds with the passed password
+func newCipher(password string) (aead.Cipher, error) {
+	return aead.NewTagged(Cipher, password, KDF)
+}
+
+// NewSeedStore creates a new seed and stores the seed in an encrypted form in the passed path.
+// It returns the public key and the seed. The seed is only logged redacted, so callers must
+// show or back up the returned seed themselves if it should be recoverable without the file
 func NewSeedStore(path string, password string) (string, string, error) {
 	// these can store the file in any path passed to them
 	var seed string
@@ -25,30 +61,24 @@ func NewSeedStore(path string, password string) (string, string, error) {
 	}
 	seed = pair.Seed()
 	publicKey = pair.Address()
-	log.Printf("\nTHE GENERATED SEED IS: %s\nAND YOUR PUBLIC KEY IS: %s\nKEEP IT SUPER SAFE OR YOU MIGHT NOT HAVE ACCESS TO THESE FUNDS AGAIN \n", seed, publicKey)
+	logger.Info("generated new seed", logger.F("pubkey", publicKey), logger.Secret("seed", seed))
 	err = StoreSeed(seed, password, path) // store the seed in a secure location
 	return publicKey, seed, err
 }
 
 // StoreSeed encrypts and stores the seed
 func StoreSeed(seed string, password string, path string) error {
-	// these can store the file ion any path passed to them
-	// now we can be sure we have the directory, check for seed
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		// file not created before, create
-		log.Println("file doesn't exist, creating a new one")
-		file, err := os.Create(path)
-		if err != nil {
-			log.Println("ERROR WHILE CREATING FILE: ", err)
-			return err
-		}
-		file.Close()
+	// these can store the file in any path passed to them. SealFile creates the file with
+	// 0600 permissions if it doesn't exist and replaces it atomically if it does
+	c, err := newCipher(password)
+	if err != nil {
+		return err
 	}
-	err := aes.EncryptFile(path, []byte(seed), password)
+	err = aead.SealFile(c, path, []byte(seed), nil, false)
 	if err != nil {
 		return errors.Wrap(err, "could not encrypt file")
 	}
-	_, err = aes.DecryptFile(path, password)
+	_, err = aead.OpenFile(c, path, nil)
 	return err
 }
 
@@ -56,7 +86,11 @@ func StoreSeed(seed string, password string, path string) error {
 func RetrieveSeed(path string, password string) (string, string, error) {
 	var publicKey string
 	var seed string
-	data, err := aes.DecryptFile(path, password)
+	c, err := newCipher(password)
+	if err != nil {
+		return publicKey, seed, err
+	}
+	data, err := aead.OpenFile(c, path, nil)
 	if err != nil {
 		return publicKey, seed, errors.Wrap(err, "could not decrypt file")
 	}
@@ -67,10 +101,48 @@ func RetrieveSeed(path string, password string) (string, string, error) {
 
 // DecryptSeed decrpyts the encrypted seed and returns the raw unencrypted seed
 func DecryptSeed(encryptedSeed []byte, seedpwd string) (string, error) {
-	data, err := aes.Decrypt(encryptedSeed, seedpwd)
+	c, err := newCipher(seedpwd)
+	if err != nil {
+		return "", err
+	}
+	data, err := c.Open(encryptedSeed, nil)
 	return string(data), err
 }
 
+// ChangePassword re-encrypts the seed stored in path with a new password using the current
+// Cipher and KDF. The original file is only replaced once the new one has been verified
+func ChangePassword(path string, oldpwd string, newpwd string) error {
+	return RotateSeed(path, oldpwd, newpwd, Cipher, KDF)
+}
+
+// RotateSeed re-encrypts the seed stored in path with a new password, cipher and KDF params.
+// The seed is decrypted with the old password and the cipher it was stored with
+func RotateSeed(path string, oldpwd string, newpwd string, cipherName string, params kdf.Params) error {
+	from, err := newCipher(oldpwd)
+	if err != nil {
+		return err
+	}
+	to, err := aead.NewTagged(cipherName, newpwd, params)
+	if err != nil {
+		return err
+	}
+	return aead.RotateFile(path, from, to, nil, false)
+}
+
+// RotateSeeds re-encrypts every .key file in dir from the old password to the new one using
+// the current Cipher and KDF. It returns the files that were rotated
+func RotateSeeds(dir string, oldpwd string, newpwd string) ([]string, error) {
+	from, err := newCipher(oldpwd)
+	if err != nil {
+		return nil, err
+	}
+	to, err := newCipher(newpwd)
+	if err != nil {
+		return nil, err
+	}
+	return aead.RotateDir(dir, aead.KeyExt, from, to, false)
+}
+
 // ReturnPubkey returns the pubkey when passed the seed
 func ReturnPubkey(seed string) (string, error) {
 	if len(seed) == 0 {
@@ -16,7 +16,17 @@ func TestWallet(t *testing.T) {
 		log.Fatal(err)
 	}
 
-	filepath := pwd + "/files/testseed.hex"
+	// work on a copy of the fixture since decrypting it upgrades the file in place
+	fixture, err := ioutil.ReadFile(pwd + "/files/testseed.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filepath := pwd + "/files/testseedcopy.hex"
+	err = ioutil.WriteFile(filepath, fixture, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filepath)
 	filepathdup := pwd + "/files/testseed2.hex"
 	// testseed1 already has a seed, we need to test if decrypted seeds and stored seeds match
 	// seed: SCLRCFCYJZ7YPQZPNZVR7Q2NXUJBBSHZJAZQZW2UGI57RFP3KA26MGGE
@@ -1,10 +1,12 @@
 package xlm
 
 import (
-	"log"
+	"context"
 
 	"github.com/pkg/errors"
 
+	"github.com/Varunram/essentials/logger"
+	"github.com/Varunram/essentials/retry"
 	utils "github.com/Varunram/essentials/utils"
 	horizon "github.com/stellar/go/clients/horizonclient"
 	"github.com/stellar/go/keypair"
@@ -37,92 +39,91 @@ func AccountExists(publicKey string) bool {
 // SendTx signs and broadcasts a given stellar tx
 func SendTx(mykp keypair.KP, sourceAccount *horizonprotocol.Account,
 	memo string, ops ...build.Operation) (int32, string, error) {
+	return SendTxContext(context.Background(), mykp, sourceAccount, memo, ops...)
+}
 
-	txparams := build.TransactionParams{
-		SourceAccount:        sourceAccount,
-		Operations:           ops,
-		Timebounds:           build.NewInfiniteTimeout(),
-		Memo:                 build.Memo(build.MemoText(memo)),
-		IncrementSequenceNum: true,
-		BaseFee:              1000,
-	}
-
-	tx, err := build.NewTransaction(txparams)
-	if err != nil {
-		return -1, "", errors.Wrap(err, "could not create a new transaction")
-	}
-
-	txsigned, err := tx.Sign(Passphrase, mykp.(*keypair.Full))
-	if err != nil {
-		log.Println(err)
-		return -1, "", errors.Wrap(err, "could not sign")
-	}
+// SendTxContext signs and broadcasts a given stellar tx, resubmitting it with SubmitPolicy and
+// a higher fee if horizon rejects it for reasons that may be temporary
+func SendTxContext(ctx context.Context, mykp keypair.KP, sourceAccount *horizonprotocol.Account,
+	memo string, ops ...build.Operation) (int32, string, error) {
 
-	txe, err := txsigned.Base64()
-	if err != nil {
-		log.Println(err)
-		return -1, "", errors.Wrap(err, "could not convert to base 64")
-	}
+	// building the tx increments the sequence number of the account, so every attempt
+	// needs to start from the original one
+	sequence := sourceAccount.Sequence
+	fee := int64(1000)
 
 	var resp horizonprotocol.Transaction
-	resp, err = TestNetClient.SubmitTransactionXDR(txe)
-	if err != nil {
-		// might be a problem with horizon that causes this or might be a fee problem
-		// bump fee
-		log.Println("failed to broadcast transaction the first time: ", err)
-
+	err := retry.Do(ctx, SubmitPolicy, func(ctx context.Context) error {
+		sourceAccount.Sequence = sequence
 		txparams := build.TransactionParams{
 			SourceAccount:        sourceAccount,
 			Operations:           ops,
 			Timebounds:           build.NewInfiniteTimeout(),
 			Memo:                 build.Memo(build.MemoText(memo)),
 			IncrementSequenceNum: true,
-			BaseFee:              10000,
+			BaseFee:              fee,
 		}
 
-		tx, err = build.NewTransaction(txparams)
+		tx, err := build.NewTransaction(txparams)
 		if err != nil {
-			return -1, "", errors.Wrap(err, "could not create a new transaction")
+			return retry.Permanent(errors.Wrap(err, "could not create a new transaction"))
 		}
 
-		txsigned, err = tx.Sign(Passphrase, mykp.(*keypair.Full))
+		txsigned, err := tx.Sign(Passphrase, mykp.(*keypair.Full))
 		if err != nil {
-			log.Println(err)
-			return -1, "", errors.Wrap(err, "could not sign")
+			logger.Error("could not sign transaction", logger.Err(err))
+			return retry.Permanent(errors.Wrap(err, "could not sign"))
 		}
 
-		txe, err = txsigned.Base64()
+		txe, err := txsigned.Base64()
 		if err != nil {
-			log.Println(err)
-			return -1, "", errors.Wrap(err, "could not convert to base 64")
+			logger.Error("could not convert transaction to base 64", logger.Err(err))
+			return retry.Permanent(errors.Wrap(err, "could not convert to base 64"))
 		}
 
 		resp, err = TestNetClient.SubmitTransactionXDR(txe)
 		if err != nil {
-			return -1, "", errors.Wrap(err, "could not propagate tx")
+			// might be a problem with horizon that causes this or might be a fee problem
+			// bump fee
+			logger.Warn("failed to broadcast transaction", logger.F("fee", fee), logger.Err(err))
+			fee *= 10
+			if fee > 10000 {
+				fee = 10000
+			}
+			return errors.Wrap(err, "could not propagate tx")
 		}
+		return nil
+	})
+	if err != nil {
+		return -1, "", err
 	}
 
-	log.Printf("Propagated Transaction: %s, sequence: %d\n", resp.Hash, resp.Ledger)
+	logger.Info("propagated transaction", logger.F("hash", resp.Hash), logger.F("ledger", resp.Ledger))
 	return resp.Ledger, resp.Hash, nil
 }
 
 // SendXLMCreateAccount creates and sends XLM to a new account
+//
+// Deprecated: use SendXLMCreateAccountAmount, floats can't represent most amounts exactly
 func SendXLMCreateAccount(destination string, amountx float64, seed string) (int32, string, error) {
-	// don't check if the account exists or not, hopefully it does
-	sourceAccount, mykp, err := ReturnSourceAccount(seed)
+	amount, err := utils.AmountFromFloat(amountx)
 	if err != nil {
-		return -1, "", errors.Wrap(err, "could not get source account of seed")
+		return -1, "", errors.Wrap(err, "could not convert amount to string")
 	}
+	return SendXLMCreateAccountAmount(destination, amount, seed)
+}
 
-	amount, err := utils.ToString(amountx)
+// SendXLMCreateAccountAmount creates and sends XLM to a new account
+func SendXLMCreateAccountAmount(destination string, amount utils.Amount, seed string) (int32, string, error) {
+	// don't check if the account exists or not, hopefully it does
+	sourceAccount, mykp, err := ReturnSourceAccount(seed)
 	if err != nil {
-		return -1, "", errors.Wrap(err, "could not convert amount to string")
+		return -1, "", errors.Wrap(err, "could not get source account of seed")
 	}
 
 	op := build.CreateAccount{
 		Destination: destination,
-		Amount:      amount,
+		Amount:      amount.String(),
 	}
 
 	memo := "create account"
@@ -153,7 +154,12 @@ func ReturnSourceAccountPubkey(pubkey string) (horizonprotocol.Account, error) {
 		client = horizon.DefaultPublicNetClient
 	}
 	ar := horizon.AccountRequest{AccountID: pubkey}
-	sourceAccount, err := client.AccountDetail(ar)
+	var sourceAccount horizonprotocol.Account
+	err := retry.Do(context.Background(), RequestPolicy, func(ctx context.Context) error {
+		var err error
+		sourceAccount, err = client.AccountDetail(ar)
+		return err
+	})
 	if err != nil {
 		return sourceAccount, errors.Wrap(err, "could not load client details, quitting")
 	}
@@ -161,23 +167,29 @@ func ReturnSourceAccountPubkey(pubkey string) (horizonprotocol.Account, error) {
 }
 
 // SendXLM sends xlm to a destination address
+//
+// Deprecated: use SendXLMAmount, floats can't represent most amounts exactly
 func SendXLM(destination string, amountx float64, seed string, memo string) (int32, string, error) {
-	// don't check if the account exists or not, hopefully it does
-	sourceAccount, mykp, err := ReturnSourceAccount(seed)
+	amount, err := utils.AmountFromFloat(amountx)
 	if err != nil {
-		log.Println(err)
-		return -1, "", errors.Wrap(err, "could not return source account")
+		logger.Error("could not convert amount to string", logger.Err(err))
+		return -1, "", errors.Wrap(err, "could not convert amount to string")
 	}
+	return SendXLMAmount(destination, amount, seed, memo)
+}
 
-	amount, err := utils.ToString(amountx)
+// SendXLMAmount sends xlm to a destination address
+func SendXLMAmount(destination string, amount utils.Amount, seed string, memo string) (int32, string, error) {
+	// don't check if the account exists or not, hopefully it does
+	sourceAccount, mykp, err := ReturnSourceAccount(seed)
 	if err != nil {
-		log.Println(err)
-		return -1, "", errors.Wrap(err, "could not convert amount to string")
+		logger.Error("could not return source account", logger.Err(err))
+		return -1, "", errors.Wrap(err, "could not return source account")
 	}
 
 	op := build.Payment{
 		Destination: destination,
-		Amount:      amount,
+		Amount:      amount.String(),
 		Asset:       build.NativeAsset{},
 	}
 
@@ -189,20 +201,23 @@ func RefillAccount(publicKey string, refillSeed string) error {
 	if Mainnet {
 		return errors.New("can't give free xlm on mainnet, quitting")
 	}
-	var err error
+	refill, err := utils.AmountFromFloat(RefillAmount)
+	if err != nil {
+		return errors.Wrap(err, "invalid refill amount")
+	}
 	if !AccountExists(publicKey) {
 		// there is no account under the user's name
 		// means we need to setup an account first
-		log.Println("Account does not exist, creating: ", publicKey)
-		_, _, err = SendXLMCreateAccount(publicKey, RefillAmount, refillSeed)
+		logger.Info("account does not exist, creating", logger.F("pubkey", publicKey))
+		_, _, err = SendXLMCreateAccountAmount(publicKey, refill, refillSeed)
 		if err != nil {
-			log.Println("Account Could not be created")
+			logger.Error("account could not be created", logger.F("pubkey", publicKey), logger.Err(err))
 			return errors.Wrap(err, "Account Could not be created")
 		}
 	}
-	balanceI, _ := utils.ToFloat(GetNativeBalance(publicKey))
-	if balanceI < 3 { // to setup trustlines
-		_, _, err = SendXLM(publicKey, RefillAmount, refillSeed, "Sending XLM to refill")
+	balance, err := GetNativeBalanceAmount(publicKey)
+	if err != nil || balance < 3*utils.One { // to setup trustlines
+		_, _, err = SendXLMAmount(publicKey, refill, refillSeed, "Sending XLM to refill")
 		if err != nil {
 			return errors.Wrap(err, "Account doesn't have funds or invalid seed")
 		}